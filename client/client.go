@@ -0,0 +1,528 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// routes of server used by Client
+const (
+	pathCSRF     = "/bellerophon/csrf"
+	pathToken    = "/bellerophon/token"
+	pathSignUp   = "/bellerophon/signup"
+	pathLoginMFA = "/bellerophon/login/mfa"
+	pathLogout   = "/bellerophon/logout"
+	pathSessions = "/api/v1/sessions"
+	pathMe       = "/api/v1/users/me"
+	pathPassword = "/api/v1/users/me/password"
+	pathSecret   = "/api/v1/users/me/secret"
+)
+
+const (
+	headerCSRF = "X-CSRF-Token"
+	// maxErrorBody - only the beginning of error answer is read
+	maxErrorBody = 64 << 10
+
+	defaultAttempts   = 3
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+)
+
+// Client - typed client of bellerophon, safe for concurrent use.
+// Session is kept in cookie (default) or in access and refresh tokens (WithBearer, WithAPIKey),
+// GET and PUT are repeated with backoff after network error, 429, 502, 503 and 504.
+// Errors of server are *Error, compared with sentinel errors by errors.Is
+type Client struct {
+	base string
+	http *http.Client
+	// bearer - Authorization: Bearer instead of cookie, apiKey - instead of tokens of LogIn
+	bearer bool
+	apiKey string
+	// attempts - of idempotent request including the first one
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+
+	mu      sync.Mutex
+	csrf    string
+	access  string
+	refresh string
+}
+
+type Option func(c *Client)
+
+// WithHTTPClient - transport, timeout and cookie jar of h, h itself is not changed
+func WithHTTPClient(h *http.Client) Option {
+	return func(c *Client) {
+		c.http = h
+	}
+}
+
+// WithBearer - LogIn takes access and refresh tokens, expired access token is refreshed once per request
+func WithBearer() Option {
+	return func(c *Client) {
+		c.bearer = true
+	}
+}
+
+// WithAPIKey - every request with API key (bk_...), LogIn is not needed
+func WithAPIKey(key string) Option {
+	return func(c *Client) {
+		c.bearer = true
+		c.apiKey = key
+	}
+}
+
+// WithRetry - attempts of idempotent request (1 - without repeat), pause grows from backoff up to maxBackoff
+func WithRetry(attempts int, backoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.attempts = max(attempts, 1)
+		c.backoff = backoff
+		c.maxBackoff = max(maxBackoff, backoff)
+	}
+}
+
+// New - client of server on baseURL, e.g. "https://example.com"
+func New(baseURL string, opts ...Option) (*Client, error) {
+	u, errURL := url.Parse(baseURL)
+	if errURL != nil {
+		return nil, errURL
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("bellerophon: unsupported scheme of url - %q", u.Scheme)
+	}
+
+	c := &Client{
+		base:       strings.TrimSuffix(u.String(), "/"),
+		http:       &http.Client{},
+		attempts:   defaultAttempts,
+		backoff:    defaultBackoff,
+		maxBackoff: defaultMaxBackoff,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// own copy: jar keeps cookies of session and CSRF, redirect of server is an answer
+	h := *c.http
+	if h.Jar == nil {
+		jar, errJar := cookiejar.New(nil)
+		if errJar != nil {
+			return nil, errJar
+		}
+
+		h.Jar = jar
+	}
+	h.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	c.http = &h
+
+	return c, nil
+}
+
+// NewUser - data of SignUp, password is sent as is over TLS
+type NewUser struct {
+	Login    string
+	Password string
+	Name     string
+	Surname  string
+	Email    string
+}
+
+// SignUp - new user, in private mode of server taken login or email is not an error
+func (c *Client) SignUp(ctx context.Context, u NewUser) error {
+	data := userData{
+		Direct:         directSignUp,
+		ChangeLogin:    &changeLogin{Login: u.Login},
+		ChangePassword: &changePassword{Hashed: plainPassword, PasswordOne: u.Password, PasswordTwo: u.Password},
+		ChangeName:     &changeName{Name: u.Name, Surname: u.Surname},
+		ChangeEmail:    &changeEmail{Email: u.Email},
+	}
+
+	return c.call(ctx, http.MethodPost, pathSignUp, &data, nil, http.StatusCreated, http.StatusAccepted)
+}
+
+// LogIn - new session or tokens, *MFARequiredError if user has 2FA
+func (c *Client) LogIn(ctx context.Context, login, password string) error {
+	if !c.bearer {
+		return c.call(ctx, http.MethodPost, pathSessions, &credentials{Login: login, Password: password}, nil, http.StatusCreated)
+	}
+
+	u := userData{
+		Direct:         directLogIn,
+		ChangeLogin:    &changeLogin{Login: login},
+		ChangePassword: &changePassword{Hashed: plainPassword, PasswordOne: password, PasswordTwo: password},
+	}
+
+	return c.logInTokens(ctx, tokenRequest{GrantType: "password", User: &u})
+}
+
+// LogInMFA - second step of LogIn with token of MFARequiredError and code of authenticator or recovery code
+func (c *Client) LogInMFA(ctx context.Context, mfaToken, code string) error {
+	if !c.bearer {
+		return c.call(ctx, http.MethodPost, pathLoginMFA, &mfaCode{Code: code, MFAToken: mfaToken}, nil, http.StatusSeeOther)
+	}
+
+	return c.logInTokens(ctx, tokenRequest{GrantType: "mfa", MFAToken: mfaToken, Code: code})
+}
+
+// LogOut - end of cookie session, tokens are only forgotten: server has no route to revoke them
+func (c *Client) LogOut(ctx context.Context) error {
+	if c.bearer {
+		c.forget()
+
+		return nil
+	}
+
+	return c.call(ctx, http.MethodGet, pathLogout, nil, nil, http.StatusSeeOther)
+}
+
+func (c *Client) GetProfile(ctx context.Context) (User, error) {
+	var user User
+	if errCall := c.call(ctx, http.MethodGet, pathMe, nil, &user, http.StatusOK); errCall != nil {
+		return User{}, errCall
+	}
+
+	return user, nil
+}
+
+// GetSecret - ErrNoSecret if user has no secret
+func (c *Client) GetSecret(ctx context.Context) (string, error) {
+	var s secret
+	if errCall := c.call(ctx, http.MethodGet, pathSecret, nil, &s, http.StatusOK); errCall != nil {
+		return "", errCall
+	}
+
+	return s.Secret, nil
+}
+
+func (c *Client) PutSecret(ctx context.Context, s string) error {
+	return c.call(ctx, http.MethodPut, pathSecret, &secret{Secret: s}, nil, http.StatusNoContent)
+}
+
+// ChangeLogin, ChangeName, ChangeEmail - server ends cookie session of change, next request needs LogIn,
+// tokens stay
+func (c *Client) ChangeLogin(ctx context.Context, login string) error {
+	return c.call(ctx, http.MethodPatch, pathMe, &userPatch{Login: &login}, nil, http.StatusOK)
+}
+
+func (c *Client) ChangeName(ctx context.Context, name, surname string) error {
+	return c.call(ctx, http.MethodPatch, pathMe, &userPatch{Name: &name, Surname: &surname}, nil, http.StatusOK)
+}
+
+func (c *Client) ChangeEmail(ctx context.Context, email string) error {
+	return c.call(ctx, http.MethodPatch, pathMe, &userPatch{Email: &email}, nil, http.StatusOK)
+}
+
+// ChangePassword - server ends all sessions and tokens of user, next request needs LogIn
+func (c *Client) ChangePassword(ctx context.Context, password string) error {
+	if errCall := c.call(ctx, http.MethodPut, pathPassword, &passwordChange{Password: password}, nil, http.StatusNoContent); errCall != nil {
+		return errCall
+	}
+
+	c.forget()
+
+	return nil
+}
+
+func (c *Client) DeleteAccount(ctx context.Context) error {
+	if errCall := c.call(ctx, http.MethodDelete, pathMe, nil, nil, http.StatusNoContent); errCall != nil {
+		return errCall
+	}
+
+	c.forget()
+
+	return nil
+}
+
+// call - request of user, answer with status from want is decoded into out (nil - skipped).
+// After csrf_failed token is taken again, after expired access token - refreshed, both once
+func (c *Client) call(ctx context.Context, method, path string, in, out any, want ...int) error {
+	var body []byte
+	if in != nil {
+		data, errJSON := json.Marshal(in)
+		if errJSON != nil {
+			return errJSON
+		}
+
+		body = data
+	}
+
+	for try := 0; ; try++ {
+		header := http.Header{}
+
+		access := c.authorize(header)
+		if access == "" && method != http.MethodGet {
+			token, errCSRF := c.csrfToken(ctx)
+			if errCSRF != nil {
+				return errCSRF
+			}
+
+			header.Set(headerCSRF, token)
+		}
+
+		res, errSend := c.send(ctx, method, path, body, header)
+		if errSend != nil {
+			return errSend
+		}
+
+		if slices.Contains(want, res.StatusCode) {
+			return decodeAnswer(res, out)
+		}
+
+		errRes := responseError(res)
+		res.Body.Close()
+
+		if try > 0 {
+			return errRes
+		}
+
+		switch {
+		case access == "" && errors.Is(errRes, ErrCSRF):
+			c.mu.Lock()
+			c.csrf = ""
+			c.mu.Unlock()
+
+		case access != "" && c.apiKey == "" && (errors.Is(errRes, ErrTokenExpired) || errors.Is(errRes, ErrInvalidToken)):
+			if errRefresh := c.refreshTokens(ctx, access); errRefresh != nil {
+				return errRes
+			}
+
+		default:
+			return errRes
+		}
+	}
+}
+
+// send - request with repeats of idempotent method, body of answer is to be closed by caller
+func (c *Client) send(ctx context.Context, method, path string, body []byte, header http.Header) (*http.Response, error) {
+	attempts := 1
+	if idempotent(method) {
+		attempts = c.attempts
+	}
+
+	for try := 1; ; try++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+
+		req, errReq := http.NewRequestWithContext(ctx, method, c.base+path, reader)
+		if errReq != nil {
+			return nil, errReq
+		}
+
+		req.Header = header.Clone()
+		req.Header.Set("Accept", "application/json, application/problem+json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		res, errDo := c.http.Do(req)
+
+		var pause time.Duration
+		switch {
+		case errDo != nil:
+			if ctx.Err() != nil || try >= attempts {
+				return nil, errDo
+			}
+		case try < attempts && retryable(res.StatusCode):
+			pause = retryAfter(res)
+			_, _ = io.Copy(io.Discard, io.LimitReader(res.Body, maxErrorBody))
+			res.Body.Close()
+		default:
+			return res, nil
+		}
+
+		if errWait := c.wait(ctx, try, pause); errWait != nil {
+			return nil, errWait
+		}
+	}
+}
+
+// wait - backoff with jitter before repeat, not shorter than Retry-After of server
+func (c *Client) wait(ctx context.Context, try int, retryAfter time.Duration) error {
+	pause := c.backoff << (try - 1)
+	if pause > c.maxBackoff || pause <= 0 {
+		pause = c.maxBackoff
+	}
+	pause = pause/2 + rand.N(pause/2+1)
+	pause = max(pause, retryAfter)
+
+	timer := time.NewTimer(pause)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+func (c *Client) logInTokens(ctx context.Context, t tokenRequest) error {
+	tokens, errGrant := c.grant(ctx, t)
+	if errGrant != nil {
+		return errGrant
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.access, c.refresh = tokens.AccessToken, tokens.RefreshToken
+
+	return nil
+}
+
+// grant - new tokens by POST pathToken, not repeated: refresh token is valid once
+func (c *Client) grant(ctx context.Context, t tokenRequest) (tokenResponse, error) {
+	body, errJSON := json.Marshal(&t)
+	if errJSON != nil {
+		return tokenResponse{}, errJSON
+	}
+
+	res, errSend := c.send(ctx, http.MethodPost, pathToken, body, http.Header{})
+	if errSend != nil {
+		return tokenResponse{}, errSend
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return tokenResponse{}, responseError(res)
+	}
+
+	var tokens tokenResponse
+	if errDec := decodeAnswer(res, &tokens); errDec != nil {
+		return tokenResponse{}, errDec
+	}
+
+	return tokens, nil
+}
+
+// refreshTokens - new tokens instead of used access token, nothing if other request has already refreshed it
+func (c *Client) refreshTokens(ctx context.Context, used string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.access != used {
+		return nil
+	}
+	if c.refresh == "" {
+		return ErrUnauthorized
+	}
+
+	tokens, errGrant := c.grant(ctx, tokenRequest{GrantType: "refresh_token", RefreshToken: c.refresh})
+	if errGrant != nil {
+		return errGrant
+	}
+
+	c.access, c.refresh = tokens.AccessToken, tokens.RefreshToken
+
+	return nil
+}
+
+// authorize - Authorization of request, returns its token, empty for cookie session
+func (c *Client) authorize(header http.Header) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	token := c.access
+	if c.apiKey != "" {
+		token = c.apiKey
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+
+	return token
+}
+
+// csrfToken - token for header, cookie of token is kept by jar
+func (c *Client) csrfToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token := c.csrf
+	c.mu.Unlock()
+
+	if token != "" {
+		return token, nil
+	}
+
+	res, errSend := c.send(ctx, http.MethodGet, pathCSRF, nil, http.Header{})
+	if errSend != nil {
+		return "", errSend
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return "", responseError(res)
+	}
+
+	var t csrfToken
+	if errDec := decodeAnswer(res, &t); errDec != nil {
+		return "", errDec
+	}
+
+	c.mu.Lock()
+	c.csrf = t.Token
+	c.mu.Unlock()
+
+	return t.Token, nil
+}
+
+// forget - tokens are revoked by server after new password and delete
+func (c *Client) forget() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.access, c.refresh = "", ""
+}
+
+func decodeAnswer(res *http.Response, out any) error {
+	defer res.Body.Close()
+
+	if out == nil {
+		_, _ = io.Copy(io.Discard, res.Body)
+
+		return nil
+	}
+
+	if errDec := json.NewDecoder(res.Body).Decode(out); errDec != nil {
+		return fmt.Errorf("%w: %d %v", ErrUnexpectedAnswer, res.StatusCode, errDec)
+	}
+
+	return nil
+}
+
+// idempotent - methods repeated after failure, DELETE is not: account deleted by the first attempt
+// would answer 404 to the repeat
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodOptions:
+		return true
+	}
+
+	return false
+}
+
+func retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,318 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/app"
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+const password = "Tr0ub4dor&3"
+
+// newServer - bellerophon with memory store
+func newServer(t *testing.T) *httptest.Server {
+	cookies, errCookies := source.NewRandomCookieCodec()
+	require.NoError(t, errCookies)
+	// test server is http, client with Secure cookies sends nothing
+	cookies.Secure = false
+
+	a, errApp := app.NewApplication(source.NewMemorySource(), app.WithCookieCodec(cookies))
+	require.NoError(t, errApp)
+
+	r := mux.NewRouter()
+	a.Routes(r)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func newClient(t *testing.T, url string, opts ...Option) *Client {
+	c, errNew := New(url, opts...)
+	require.NoError(t, errNew)
+
+	return c
+}
+
+func loko() NewUser {
+	return NewUser{Login: "Loko", Password: password, Name: "Pavel", Email: "loko@example.com"}
+}
+
+func TestCookieSession(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, newServer(t).URL)
+
+	require.NoError(t, c.SignUp(ctx, loko()))
+	assert.ErrorIs(t, c.SignUp(ctx, loko()), ErrLoginTaken)
+	assert.ErrorIs(t, c.SignUp(ctx, loko()), ErrTaken)
+
+	_, errProfile := c.GetProfile(ctx)
+	assert.ErrorIs(t, errProfile, ErrUnauthorized)
+
+	assert.ErrorIs(t, c.LogIn(ctx, "Loko", "wrong-password"), ErrInvalidCredentials)
+	require.NoError(t, c.LogIn(ctx, "Loko", password))
+
+	_, errSecret := c.GetSecret(ctx)
+	assert.ErrorIs(t, errSecret, ErrNoSecret)
+
+	require.NoError(t, c.PutSecret(ctx, "in the garden"))
+	secret, errSecret := c.GetSecret(ctx)
+	require.NoError(t, errSecret)
+	assert.Equal(t, "in the garden", secret)
+
+	// every change of profile ends the session
+	require.NoError(t, c.ChangeLogin(ctx, "Loko2"))
+	_, errProfile = c.GetProfile(ctx)
+	assert.ErrorIs(t, errProfile, ErrUnauthorized)
+
+	require.NoError(t, c.LogIn(ctx, "Loko2", password))
+	require.NoError(t, c.ChangeName(ctx, "Pasha", "Petrov"))
+	require.NoError(t, c.LogIn(ctx, "Loko2", password))
+	require.NoError(t, c.ChangeEmail(ctx, "loko2@example.com"))
+	require.NoError(t, c.LogIn(ctx, "Loko2", password))
+
+	user, errProfile := c.GetProfile(ctx)
+	require.NoError(t, errProfile)
+	assert.Equal(t, User{ID: user.ID, Login: "Loko2", Name: "Pasha", Surname: "Petrov", Email: "loko2@example.com"}, user)
+
+	// the lost CSRF token is taken again
+	c.csrf = "stale"
+	require.NoError(t, c.PutSecret(ctx, "in the house"))
+
+	require.NoError(t, c.ChangePassword(ctx, "n3w-Secret-Pass"))
+	_, errProfile = c.GetProfile(ctx)
+	assert.ErrorIs(t, errProfile, ErrUnauthorized)
+
+	require.NoError(t, c.LogIn(ctx, "Loko2", "n3w-Secret-Pass"))
+	require.NoError(t, c.LogOut(ctx))
+	_, errProfile = c.GetProfile(ctx)
+	assert.ErrorIs(t, errProfile, ErrUnauthorized)
+
+	require.NoError(t, c.LogIn(ctx, "Loko2", "n3w-Secret-Pass"))
+	require.NoError(t, c.DeleteAccount(ctx))
+	assert.ErrorIs(t, c.LogIn(ctx, "Loko2", "n3w-Secret-Pass"), ErrInvalidCredentials)
+}
+
+func TestBearerTokens(t *testing.T) {
+	ctx := context.Background()
+	c := newClient(t, newServer(t).URL, WithBearer())
+
+	weak := loko()
+	weak.Password = "loko2024"
+
+	errWeak := c.SignUp(ctx, weak)
+	var errPolicy *Error
+	require.ErrorAs(t, errWeak, &errPolicy)
+	assert.ErrorIs(t, errWeak, ErrPasswordPolicy)
+	assert.Equal(t, http.StatusUnprocessableEntity, errPolicy.Status)
+	assert.NotEmpty(t, errPolicy.Violations)
+
+	require.NoError(t, c.SignUp(ctx, loko()))
+	require.NoError(t, c.LogIn(ctx, "Loko", password))
+	require.NotEmpty(t, c.access)
+	require.NotEmpty(t, c.refresh)
+
+	require.NoError(t, c.PutSecret(ctx, "in the garden"))
+
+	// broken access token is replaced by refresh token
+	c.access = "broken"
+	secret, errSecret := c.GetSecret(ctx)
+	require.NoError(t, errSecret)
+	assert.Equal(t, "in the garden", secret)
+	assert.NotEqual(t, "broken", c.access)
+
+	require.NoError(t, c.LogOut(ctx))
+	_, errProfile := c.GetProfile(ctx)
+	assert.ErrorIs(t, errProfile, ErrUnauthorized)
+}
+
+func TestRetryIdempotent(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) < 3 {
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte(`{"status": 503, "code": "unavailable", "detail": "service is unavailable, try later"}`))
+
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"secret": "in the garden"}`))
+	}))
+	defer srv.Close()
+
+	c := newClient(t, srv.URL, WithAPIKey("bk_test"), WithRetry(3, time.Millisecond, 5*time.Millisecond))
+
+	secret, errSecret := c.GetSecret(context.Background())
+	require.NoError(t, errSecret)
+	assert.Equal(t, "in the garden", secret)
+	assert.Equal(t, int32(3), calls.Load())
+
+	// PATCH is not repeated
+	calls.Store(0)
+	errPatch := c.ChangeLogin(context.Background(), "Loko")
+	assert.ErrorIs(t, errPatch, ErrUnavailable)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// DELETE is not repeated
+	calls.Store(0)
+	errDelete := c.DeleteAccount(context.Background())
+	assert.ErrorIs(t, errDelete, ErrUnavailable)
+	assert.Equal(t, int32(1), calls.Load())
+
+	// the last answer is returned after all attempts
+	calls.Store(-10)
+	_, errSecret = c.GetSecret(context.Background())
+	assert.ErrorIs(t, errSecret, ErrUnavailable)
+	assert.Equal(t, int32(-7), calls.Load())
+}
+
+func TestContextCancel(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	c := newClient(t, srv.URL, WithAPIKey("bk_test"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, errSecret := c.GetSecret(ctx)
+	assert.True(t, errors.Is(errSecret, context.DeadlineExceeded), errSecret)
+	assert.Less(t, time.Since(start), time.Second)
+
+	canceled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+
+	_, errProfile := c.GetProfile(canceled)
+	assert.ErrorIs(t, errProfile, context.Canceled)
+}
+
+func TestErrorOfAnswer(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.Header().Set("Retry-After", "7")
+		w.WriteHeader(http.StatusTooManyRequests)
+		_, _ = w.Write([]byte(`{"type": "urn:bellerophon:problem:too_many_attempts", "title": "Too Many Requests", "status": 429, "code": "too_many_attempts", "retry_after": 7}`))
+	}))
+	defer srv.Close()
+
+	// POST is not repeated
+	c := newClient(t, srv.URL, WithBearer())
+
+	errLogIn := c.LogIn(context.Background(), "Loko", password)
+
+	var e *Error
+	require.ErrorAs(t, errLogIn, &e)
+	assert.Equal(t, http.StatusTooManyRequests, e.Status)
+	assert.Equal(t, 7*time.Second, e.RetryAfter)
+	assert.ErrorIs(t, errLogIn, ErrTooManyAttempts)
+	assert.NotErrorIs(t, errLogIn, ErrRateLimited)
+}
+
+func TestCodesOfServer(t *testing.T) {
+	for code, e := range map[string]*Error{
+		app.CodeInvalidRequest:     ErrInvalidRequest,
+		app.CodeUnauthorized:       ErrUnauthorized,
+		app.CodeInvalidCredentials: ErrInvalidCredentials,
+		app.CodeInvalidToken:       ErrInvalidToken,
+		app.CodeTokenExpired:       ErrTokenExpired,
+		app.CodeTokenReused:        ErrTokenReused,
+		app.CodeInvalidAPIKey:      ErrInvalidAPIKey,
+		app.CodeForbidden:          ErrForbidden,
+		app.CodeCSRF:               ErrCSRF,
+		app.CodeNotFound:           ErrNotFound,
+		app.CodeNoSecret:           ErrNoSecret,
+		app.CodeConflict:           ErrConflict,
+		app.CodeTaken:              ErrTaken,
+		app.CodeLoginTaken:         ErrLoginTaken,
+		app.CodeEmailTaken:         ErrEmailTaken,
+		app.CodePasswordPolicy:     ErrPasswordPolicy,
+		app.CodePrehashRejected:    ErrPrehashRejected,
+		app.CodeInvalidMFACode:     ErrInvalidMFACode,
+		app.CodeTooManyAttempts:    ErrTooManyAttempts,
+		app.CodeRateLimited:        ErrRateLimited,
+		app.CodeUnavailable:        ErrUnavailable,
+		app.CodeInternal:           ErrInternal,
+	} {
+		assert.Equal(t, code, e.Code)
+	}
+}
+
+// jsonFields - names of json fields of struct v
+func jsonFields(v any) []string {
+	var fields []string
+
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		fields = append(fields, name)
+	}
+
+	return fields
+}
+
+func TestWireSchemas(t *testing.T) {
+	res, errGet := http.Get(newServer(t).URL + "/openapi.json")
+	require.NoError(t, errGet)
+	defer res.Body.Close()
+
+	var doc struct {
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]any `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&doc))
+
+	// every field of client is in schema of server, server may send more
+	for name, v := range map[string]any{
+		"User":              User{},
+		"PasswordViolation": PasswordViolation{},
+		"UserSourceData":    userData{},
+		"ChangeLogin":       changeLogin{},
+		"ChangePassword":    changePassword{},
+		"ChangeName":        changeName{},
+		"ChangeEmail":       changeEmail{},
+		"CSRFToken":         csrfToken{},
+		"TokenRequest":      tokenRequest{},
+		"TokenResponse":     tokenResponse{},
+		"MFACode":           mfaCode{},
+		"MFAPending":        mfaPending{},
+		"Credentials":       credentials{},
+		"UserPatch":         userPatch{},
+		"PasswordChange":    passwordChange{},
+		"Secret":            secret{},
+		"Problem":           problem{},
+	} {
+		schema, ok := doc.Components.Schemas[name]
+		if !assert.True(t, ok, "schema %s", name) {
+			continue
+		}
+
+		var properties []string
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+
+		assert.Subset(t, properties, jsonFields(v), name)
+	}
+}
@@ -0,0 +1,156 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sentinel errors by stable code of server, compared by errors.Is
+var (
+	ErrInvalidRequest     = &Error{Code: "invalid_request"}
+	ErrUnauthorized       = &Error{Code: "unauthorized"}
+	ErrInvalidCredentials = &Error{Code: "invalid_credentials"}
+	ErrInvalidToken       = &Error{Code: "invalid_token"}
+	ErrTokenExpired       = &Error{Code: "token_expired"}
+	ErrTokenReused        = &Error{Code: "token_reused"}
+	ErrInvalidAPIKey      = &Error{Code: "invalid_api_key"}
+	ErrForbidden          = &Error{Code: "forbidden"}
+	ErrCSRF               = &Error{Code: "csrf_failed"}
+	ErrNotFound           = &Error{Code: "not_found"}
+	ErrNoSecret           = &Error{Code: "no_secret"}
+	ErrConflict           = &Error{Code: "conflict"}
+	// ErrTaken - login or email is taken, ErrLoginTaken and ErrEmailTaken are ErrTaken
+	ErrTaken            = &Error{Code: "taken"}
+	ErrLoginTaken       = &Error{Code: "login_taken"}
+	ErrEmailTaken       = &Error{Code: "email_taken"}
+	ErrPasswordPolicy   = &Error{Code: "password_policy"}
+	ErrPrehashRejected  = &Error{Code: "prehash_rejected"}
+	ErrInvalidMFACode   = &Error{Code: "invalid_mfa_code"}
+	ErrTooManyAttempts  = &Error{Code: "too_many_attempts"}
+	ErrRateLimited      = &Error{Code: "rate_limited"}
+	ErrUnavailable      = &Error{Code: "unavailable"}
+	ErrInternal         = &Error{Code: "internal"}
+	ErrUnexpectedAnswer = errors.New("bellerophon: unexpected answer")
+)
+
+// parentCodes - code of error is also code of parent
+var parentCodes = map[string]string{
+	"login_taken": "taken",
+	"email_taken": "taken",
+}
+
+// Error - error answer of server (problem+json), Code is stable, Detail may change.
+// Answer without problem+json has empty Code
+type Error struct {
+	Status     int
+	Code       string
+	Title      string
+	Detail     string
+	Violations []PasswordViolation
+	// RetryAfter - for ErrTooManyAttempts and ErrRateLimited
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("bellerophon: %d %s", e.Status, e.Code)
+	}
+
+	return fmt.Sprintf("bellerophon: %d %s - %s", e.Status, e.Code, e.Detail)
+}
+
+// Is - errors with the same code are equal, status is not compared
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok || t.Code == "" {
+		return false
+	}
+
+	return t.Code == e.Code || t.Code == parentCodes[e.Code]
+}
+
+// MFARequiredError - password is right, login ends by LogInMFA with Token and code of authenticator
+type MFARequiredError struct {
+	Token string
+}
+
+func (e *MFARequiredError) Error() string {
+	return "bellerophon: second factor is required"
+}
+
+// problem - body of error answer
+type problem struct {
+	Title      string              `json:"title"`
+	Status     int                 `json:"status"`
+	Detail     string              `json:"detail"`
+	Code       string              `json:"code"`
+	Violations []PasswordViolation `json:"violations"`
+	RetryAfter int                 `json:"retry_after"`
+}
+
+// mfaPending - answer of login with 2FA
+type mfaPending struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// responseError - error of answer with unexpected status, body is read
+func responseError(res *http.Response) error {
+	body, errRead := io.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	if errRead != nil {
+		return fmt.Errorf("bellerophon: read answer %d - %w", res.StatusCode, errRead)
+	}
+
+	e := &Error{Status: res.StatusCode, Title: http.StatusText(res.StatusCode), RetryAfter: retryAfter(res)}
+
+	media, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	switch media {
+	case "application/problem+json":
+		var p problem
+		if errDec := json.Unmarshal(body, &p); errDec != nil {
+			return fmt.Errorf("%w: %d %v", ErrUnexpectedAnswer, res.StatusCode, errDec)
+		}
+
+		e.Code, e.Title, e.Detail, e.Violations = p.Code, p.Title, p.Detail, p.Violations
+		if e.RetryAfter == 0 {
+			e.RetryAfter = time.Duration(p.RetryAfter) * time.Second
+		}
+
+	case "application/json":
+		var pending mfaPending
+		if json.Unmarshal(body, &pending) == nil && pending.MFARequired {
+			return &MFARequiredError{Token: pending.MFAToken}
+		}
+
+		e.Detail = strings.TrimSpace(string(body))
+
+	default:
+		if res.StatusCode == http.StatusSeeOther {
+			// cookie session is missing or ended, server sends to login
+			e.Code = ErrUnauthorized.Code
+
+			break
+		}
+
+		e.Detail = strings.TrimSpace(string(body))
+	}
+
+	return e
+}
+
+// retryAfter - Retry-After in seconds, zero without header
+func retryAfter(res *http.Response) time.Duration {
+	seconds, errParse := strconv.Atoi(res.Header.Get("Retry-After"))
+	if errParse != nil || seconds < 0 {
+		return 0
+	}
+
+	return time.Duration(seconds) * time.Second
+}
@@ -0,0 +1,88 @@
+package client
+
+// Types of requests and answers copy schemas of iternal/app/openapi.json, the client does not import
+// packages of server, so its users do not link drivers of DB and hashers of passwords.
+// TestWireSchemas compares json fields of every type with its schema
+
+// User - schema User, answer of GetProfile
+type User struct {
+	ID      int    `json:"id,omitempty"`
+	Login   string `json:"login"`
+	Name    string `json:"name"`
+	Surname string `json:"surname,omitempty"`
+	Email   string `json:"email"`
+}
+
+// PasswordViolation - schema PasswordViolation, broken rule of password policy in Error.Violations
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// "direct" of userData and "hashed" of changePassword
+const (
+	directSignUp = 1
+	directLogIn  = 2
+	// plainPassword - password is sent as is over TLS, server hashes it
+	plainPassword = 110
+)
+
+type (
+	// userData - schema UserSourceData of signup and of grant "password"
+	userData struct {
+		Direct         int             `json:"direct"`
+		ChangeLogin    *changeLogin    `json:"change_login,omitempty"`
+		ChangePassword *changePassword `json:"change_password,omitempty"`
+		ChangeName     *changeName     `json:"change_name,omitempty"`
+		ChangeEmail    *changeEmail    `json:"change_email,omitempty"`
+	}
+	changeLogin struct {
+		Login string `json:"login"`
+	}
+	changePassword struct {
+		Hashed      int    `json:"hashed"`
+		PasswordOne string `json:"password_one"`
+		PasswordTwo string `json:"password_two"`
+	}
+	changeName struct {
+		Name    string `json:"first_name"`
+		Surname string `json:"last_name,omitempty"`
+	}
+	changeEmail struct {
+		Email string `json:"email"`
+	}
+	csrfToken struct {
+		Token string `json:"csrf_token"`
+	}
+	tokenRequest struct {
+		GrantType    string    `json:"grant_type"`
+		User         *userData `json:"user,omitempty"`
+		RefreshToken string    `json:"refresh_token,omitempty"`
+		MFAToken     string    `json:"mfa_token,omitempty"`
+		Code         string    `json:"code,omitempty"`
+	}
+	tokenResponse struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	mfaCode struct {
+		Code     string `json:"code"`
+		MFAToken string `json:"mfa_token,omitempty"`
+	}
+	credentials struct {
+		Login    string `json:"login"`
+		Password string `json:"password"`
+	}
+	userPatch struct {
+		Login   *string `json:"login,omitempty"`
+		Name    *string `json:"first_name,omitempty"`
+		Surname *string `json:"last_name,omitempty"`
+		Email   *string `json:"email,omitempty"`
+	}
+	passwordChange struct {
+		Password string `json:"password"`
+	}
+	secret struct {
+		Secret string `json:"secret"`
+	}
+)
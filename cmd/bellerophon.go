@@ -1,41 +1,157 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"expvar"
+	"fmt"
 	"github.com/gorilla/mux"
 	_ "github.com/lib/pq"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Ekvo/bellerophon/iternal/app"
+	"github.com/Ekvo/bellerophon/iternal/config"
 	"github.com/Ekvo/bellerophon/iternal/connect"
+	"github.com/Ekvo/bellerophon/iternal/migrate"
 	"github.com/Ekvo/bellerophon/iternal/source"
 )
 
+const usage = `usage:
+  bellerophon                           start server
+  bellerophon migrate up|down|status    manage schema of DB`
+
 func main() {
 	conn, errCon := connect.NewConnect("./iternal/connect/connectData.json")
 	if errCon != nil {
 		log.Fatalf("no connect data - %v", errCon)
 	}
 
-	db, errDB := sql.Open("postgres", conn.String())
-	if errDB != nil {
-		log.Fatalf("no open DB - %v", errDB)
+	if len(os.Args) > 1 {
+		if os.Args[1] != "migrate" || len(os.Args) != 3 {
+			log.Fatal(usage)
+		}
+
+		if err := migrateCommand(conn, os.Args[2]); err != nil {
+			log.Fatalf("migrate %s - %v", os.Args[2], err)
+		}
+
+		return
 	}
-	defer func() {
-		err := db.Close()
-		if err != nil {
-			log.Printf("sql.DB Close - %v", err)
+
+	conf, errConf := config.NewConfig("./iternal/config/config.json")
+	if errConf != nil {
+		log.Fatalf("no config - %v", errConf)
+	}
+
+	hasher, errHasher := source.NewPasswordHasher(conf.PasswordHasher)
+	if errHasher != nil {
+		log.Fatalf("config - %v", errHasher)
+	}
+
+	if len(conf.CookieKeys) == 0 {
+		log.Print("no cookie_keys in config - cookies are signed by random key and will be lost on exit")
+	}
+
+	cookies, errCookies := conf.CookieCodec()
+	if errCookies != nil {
+		log.Fatalf("config - %v", errCookies)
+	}
+
+	if len(conf.JWTKeys) == 0 {
+		log.Print("no jwt_keys in config - access tokens are signed by random key and will be lost on exit")
+	}
+
+	tokens, errTokens := conf.JWTSigner()
+	if errTokens != nil {
+		log.Fatalf("config - %v", errTokens)
+	}
+
+	var (
+		s        source.Store
+		sessions source.SessionStore   = source.NewMemorySessions()
+		refresh  source.RefreshStore   = source.NewMemoryRefreshTokens()
+		apiKeys  source.APIKeyStore    = source.NewMemoryAPIKeys()
+		mfa      source.MFAStore       = source.NewMemoryMFA()
+		attempts source.AttemptStore   = source.NewMemoryAttempts()
+		rates    source.RateLimitStore = source.NewMemoryRateLimits()
+	)
+
+	switch conn.Driver {
+	case connect.DriverMemory:
+		log.Print("data is stored in memory and will be lost on exit")
+
+		s = source.NewMemorySource()
+	default:
+		db, errDB := sql.Open(conn.Driver, conn.DataSourceName())
+		if errDB != nil {
+			log.Fatalf("no open DB - %v", errDB)
+		}
+		defer func() {
+			err := db.Close()
+			if err != nil {
+				log.Printf("sql.DB Close - %v", err)
+			}
+		}()
+
+		if err := checkSchema(db, conn.Driver); err != nil {
+			log.Fatalf("schema of DB - %v", err)
+		}
+
+		if conn.Driver == connect.DriverSqlite {
+			s = source.NewLiteSource(db)
+		} else {
+			s = source.NewSqlSource(db)
 		}
-	}()
 
-	s := source.NewSqlSource(db)
-	a := app.NewApplication(s)
+		apiKeys = source.NewSqlAPIKeys(db)
+		mfa = source.NewSqlMFA(db)
+
+		if conf.SessionStore == config.StoreSql {
+			sessions = source.NewSqlSessions(db)
+			refresh = source.NewSqlRefreshTokens(db)
+		}
+		if conf.LoginAttemptsStore == config.StoreSql {
+			attempts = source.NewSqlAttempts(db)
+		}
+		if conf.RateLimitStore == config.StoreSql {
+			rates = source.NewSqlRateLimits(db)
+		}
+	}
+
+	a, errApp := app.NewApplication(s,
+		app.WithPasswordHasher(hasher),
+		app.WithSessionStore(sessions),
+		app.WithCookieCodec(cookies),
+		app.WithJWTSigner(tokens),
+		app.WithRefreshStore(refresh),
+		app.WithAPIKeyStore(apiKeys),
+		app.WithMFAStore(mfa),
+		app.WithIssuer(conf.TOTPIssuer),
+		app.WithLoginThrottle(attempts, conf.LoginThrottle.Policy(), conf.IPThrottle.Policy()),
+		app.WithRateLimits(rates, conf.RouteLimits()),
+		app.WithSignUpMode(conf.SignUpResponse),
+		app.WithPasswordPolicy(conf.PasswordPolicy.Policy()),
+		app.WithPrehashMode(conf.PrehashMode, conf.PrehashDeprecation, conf.PrehashSunset),
+		app.WithSessionLifetime(conf.SessionIdleTimeout.Duration, conf.SessionAbsoluteLifetime.Duration),
+		app.WithTokenLifetime(conf.AccessTokenLifetime.Duration, conf.RefreshTokenLifetime.Duration))
+	if errApp != nil {
+		log.Fatalf("no application - %v", errApp)
+	}
+
 	r := mux.NewRouter()
 
 	a.Routes(r)
 
+	janitor := app.NewJanitor(sessions, conf.JanitorInterval.Duration)
+	janitor.SweepRefreshTokens(refresh)
+	janitor.SweepLoginAttempts(attempts, max(conf.LoginThrottle.Window.Duration, conf.LoginThrottle.Lockout.Duration,
+		conf.IPThrottle.Window.Duration, conf.IPThrottle.Lockout.Duration))
+	janitor.SweepRateLimits(rates)
 	srv := http.Server{
 		Addr:         "127.0.0.1:8000",
 		Handler:      r,
@@ -43,7 +159,138 @@ func main() {
 		WriteTimeout: 60 * time.Second,
 	}
 
-	if err := srv.ListenAndServe(); err != nil {
-		log.Fatalf("start server error - %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	janitor.Start()
+	defer janitor.Stop()
+
+	errServe := make(chan error, 2)
+	go func() {
+		errServe <- srv.ListenAndServe()
+	}()
+
+	// counters of janitor and runtime only on admin listener, not on public router
+	var admin *http.Server
+	if conf.DebugAddr != "" {
+		expvar.Publish("sessions", expvar.Func(func() any {
+			return map[string]int64{
+				"evicted": janitor.Evicted(),
+				"live":    janitor.Live(),
+			}
+		}))
+
+		debug := mux.NewRouter()
+		debug.Handle("/debug/vars", expvar.Handler()).Methods("GET")
+
+		admin = &http.Server{
+			Addr:         conf.DebugAddr,
+			Handler:      debug,
+			ReadTimeout:  10 * time.Second,
+			WriteTimeout: 10 * time.Second,
+		}
+		go func() {
+			errServe <- admin.ListenAndServe()
+		}()
 	}
+
+	select {
+	case err := <-errServe:
+		log.Printf("start server error - %v", err)
+
+		return
+	case <-ctx.Done():
+	}
+
+	log.Print("shutdown server")
+
+	ctxShutdown, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := srv.Shutdown(ctxShutdown); err != nil {
+		log.Printf("shutdown server error - %v", err)
+	}
+	if admin != nil {
+		if err := admin.Shutdown(ctxShutdown); err != nil {
+			log.Printf("shutdown admin server error - %v", err)
+		}
+	}
+}
+
+// checkSchema - server does not start on DB with migrations behind source.SchemaVersion
+func checkSchema(db *sql.DB, driver string) error {
+	m, errMig := migrate.New(db, driver)
+	if errMig != nil {
+		return errMig
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	version, errVer := m.Version(ctx)
+	if errVer != nil {
+		return errVer
+	}
+	if version < source.SchemaVersion {
+		return fmt.Errorf("version %d is behind expected %d, run: bellerophon migrate up", version, source.SchemaVersion)
+	}
+
+	return nil
+}
+
+func migrateCommand(conn *connect.Connect, command string) error {
+	if conn.Driver == connect.DriverMemory {
+		return fmt.Errorf("driver %q has no schema", conn.Driver)
+	}
+
+	db, errDB := sql.Open(conn.Driver, conn.DataSourceName())
+	if errDB != nil {
+		return errDB
+	}
+	defer db.Close()
+
+	m, errMig := migrate.New(db, conn.Driver)
+	if errMig != nil {
+		return errMig
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	switch command {
+	case "up":
+		applied, err := m.Up(ctx)
+		for _, mig := range applied {
+			fmt.Printf("up   %04d_%s\n", mig.Version, mig.Name)
+		}
+
+		return err
+	case "down":
+		mig, err := m.Down(ctx)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("down %04d_%s\n", mig.Version, mig.Name)
+
+		return nil
+	case "status":
+		states, err := m.Status(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, st := range states {
+			applied := "pending"
+			if st.AppliedAt != "" {
+				applied = "applied " + st.AppliedAt
+			}
+
+			fmt.Printf("%04d_%-20s %s\n", st.Version, st.Name, applied)
+		}
+
+		return nil
+	}
+
+	return fmt.Errorf("unknown command %q\n%s", command, usage)
 }
@@ -0,0 +1,165 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// scopeAccount - scope of account management (API keys, 2FA), is never given to API key,
+// so a key can't create keys with more rights or turn off 2FA
+const scopeAccount = "account"
+
+// APIKeyRequest - body of POST pathAPIKeys, key without ExpiresAt does not expire
+type APIKeyRequest struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// APIKeyCreated - Key is shown only once, server keeps only its hash
+type APIKeyCreated struct {
+	Key string `json:"key"`
+	source.APIKey
+}
+
+// APIKeys - GET list of keys of user, POST new key
+func (a *Application) APIKeys(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: APIKeys on url:%s with Metod:%s", r.URL.Path, r.Method)
+
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		writeError(w, ErrNoPrincipal, http.StatusUnauthorized)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if r.Method == http.MethodGet {
+		list, errList := a.apiKeys.List(ctx, p.UserID)
+		if errList != nil {
+			writeError(w, errList, http.StatusInternalServerError)
+
+			return
+		}
+
+		_ = encode(w, &list, http.StatusOK)
+
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var k APIKeyRequest
+		httpStatus, errDec := decode(r, &k)
+		if errDec != nil {
+			writeError(w, errDec, httpStatus)
+
+			return
+		}
+
+		if len(k.Name) < 1 {
+			writeError(w, errors.New("empty name"), http.StatusBadRequest)
+
+			return
+		}
+		if len(k.Scopes) < 1 {
+			writeError(w, errors.New("empty scopes"), http.StatusBadRequest)
+
+			return
+		}
+
+		now := a.now()
+		if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+			writeError(w, errors.New("expires_at is in the past"), http.StatusBadRequest)
+
+			return
+		}
+
+		key, record, errKey := source.NewAPIKey(p.UserID, k.Name, k.Scopes, now, k.ExpiresAt)
+		if errors.Is(errKey, source.ErrUnknownScope) {
+			writeError(w, errKey, http.StatusBadRequest)
+
+			return
+		}
+		if errKey != nil {
+			writeError(w, errKey, http.StatusInternalServerError)
+
+			return
+		}
+
+		if errCreate := a.apiKeys.Create(ctx, record); errCreate != nil {
+			writeError(w, errCreate, http.StatusInternalServerError)
+
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		_ = encode(w, &APIKeyCreated{Key: key, APIKey: record}, http.StatusCreated)
+
+		return
+	}
+
+	writeError(w, fmt.Errorf("unexepted Metod - %s on url - %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+}
+
+// APIKeyRevoke - DELETE key of user by id
+func (a *Application) APIKeyRevoke(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: APIKeyRevoke on url:%s", r.URL.Path)
+
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		writeError(w, ErrNoPrincipal, http.StatusUnauthorized)
+
+		return
+	}
+
+	id := mux.Vars(r)["id"]
+
+	errRevoke := a.apiKeys.Revoke(r.Context(), p.UserID, id)
+	if errors.Is(errRevoke, source.ErrNotFound) {
+		writeError(w, errRevoke, http.StatusNotFound)
+
+		return
+	}
+	if errRevoke != nil {
+		writeError(w, errRevoke, http.StatusInternalServerError)
+
+		return
+	}
+
+	msg := source.Message{Msg: fmt.Sprintf("api key id=%s revoked", id)}
+	_ = encode(w, &msg, http.StatusOK)
+}
+
+// apiKeyPrincipal - principal with scopes of API key
+func (a *Application) apiKeyPrincipal(ctx context.Context, key string) (Principal, error) {
+	id, secret, errParse := source.ParseAPIKey(key)
+	if errParse != nil {
+		return Principal{}, errParse
+	}
+
+	k, errGet := a.apiKeys.Get(ctx, id)
+	if errors.Is(errGet, source.ErrNotFound) {
+		return Principal{}, source.ErrAPIKeyInvalid
+	}
+	if errGet != nil {
+		return Principal{}, errGet
+	}
+
+	if errVerify := k.Verify(secret, a.now()); errVerify != nil {
+		return Principal{}, errVerify
+	}
+
+	// empty list of scopes must not become full access
+	scopes := append([]string{}, k.Scopes...)
+
+	return Principal{UserID: k.UserID, Scopes: scopes}, nil
+}
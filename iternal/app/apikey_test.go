@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// serveWithSession - request through router with cookie of new session of user
+func serveWithSession(t *testing.T, userID int, method, path, body string) *httptest.ResponseRecorder {
+	token, sessionID, errToken := source.NewSessionToken()
+	require.NoError(t, errToken)
+
+	errSession := a.sessions.Create(context.Background(), source.Session{ID: sessionID, UserID: userID, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(defaultIdleTimeout)})
+	require.NoError(t, errSession)
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.AddCookie(&http.Cookie{Name: source.MarkCookieUser, Value: sessionCookie(t, token)})
+	withCSRF(t, req)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func serveWithKey(key, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+key)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestAPIKeyScopes(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	id, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+	require.NoError(t, s.InfoChangeByID(ctx, strconv.Itoa(id), "new secret Loko"))
+
+	w := serveWithSession(t, id, http.MethodPost, pathAPIKeys, `{"name":"ci","scopes":["secret:read","profile:write"]}`)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created APIKeyCreated
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+	require.True(t, strings.HasPrefix(created.Key, source.APIKeyPrefix))
+	assert.Equal(t, "ci", created.Name)
+	assert.Nil(t, created.ExpiresAt)
+
+	// read of secret is allowed
+	w = serveWithKey(created.Key, http.MethodGet, pathMain, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	arrData, errData := io.ReadAll(w.Body)
+	require.NoError(t, errData)
+	assert.Equal(t, `{"message":"new secret Loko"}`, strings.TrimSpace(string(arrData)))
+
+	// write of secret and key management are not
+	w = serveWithKey(created.Key, http.MethodPut, pathMain, `{"message":"by key"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), `scope="secret:write"`)
+
+	w = serveWithKey(created.Key, http.MethodGet, pathAPIKeys, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	w = serveWithKey(created.Key, http.MethodGet, pathUserID, "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// profile:write changes name, but not password
+	w = serveWithKey(created.Key, http.MethodPut, pathUserID, fmt.Sprintf(`{"direct":%d,"change_name":{"first_name":"Paul"}}`, source.NewName))
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	w = serveWithKey(created.Key, http.MethodPut, pathUserID, fmt.Sprintf(`{"direct":%d}`, source.UserDelete))
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	_, errUser := s.UserData(ctx, strconv.Itoa(id))
+	assert.NoError(t, errUser)
+
+	w = serveWithKey(created.Key+"x", http.MethodGet, pathMain, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestAPIKeyListRevokeExpiry(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+	// clock goes back in the test, buckets of rate limits would be empty
+	WithRateLimits(source.NewMemoryRateLimits(), nil)(a)
+
+	id, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+	require.NoError(t, s.InfoChangeByID(ctx, strconv.Itoa(id), "new secret Loko"))
+
+	for _, body := range []string{
+		`{"name":"","scopes":["secret:read"]}`,
+		`{"name":"ci","scopes":[]}`,
+		`{"name":"ci","scopes":["admin"]}`,
+		`{"name":"ci","scopes":["account"]}`,
+		fmt.Sprintf(`{"name":"ci","scopes":["secret:read"],"expires_at":"%s"}`, now.Add(-time.Hour).Format(time.RFC3339)),
+	} {
+		w := serveWithSession(t, id, http.MethodPost, pathAPIKeys, body)
+		assert.Equal(t, http.StatusBadRequest, w.Code, body)
+	}
+
+	body := fmt.Sprintf(`{"name":"ci","scopes":["secret:read"],"expires_at":"%s"}`, now.Add(time.Hour).Format(time.RFC3339))
+
+	w := serveWithSession(t, id, http.MethodPost, pathAPIKeys, body)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var created APIKeyCreated
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&created))
+
+	w = serveWithSession(t, id, http.MethodGet, pathAPIKeys, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var list []source.APIKey
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&list))
+	require.Len(t, list, 1)
+	assert.Equal(t, created.ID, list[0].ID)
+	assert.NotContains(t, w.Body.String(), created.Key)
+
+	w = serveWithKey(created.Key, http.MethodGet, pathMain, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	now = now.Add(time.Hour)
+
+	w = serveWithKey(created.Key, http.MethodGet, pathMain, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	now = now.Add(-time.Hour)
+
+	// only owner revokes key
+	w = serveWithSession(t, id+1, http.MethodDelete, strings.Replace(pathAPIKey, "{id}", created.ID, 1), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serveWithSession(t, id, http.MethodDelete, strings.Replace(pathAPIKey, "{id}", created.ID, 1), "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w = serveWithKey(created.Key, http.MethodGet, pathMain, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
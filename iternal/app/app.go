@@ -3,50 +3,341 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"log"
 	"mime"
+	"net"
 	"net/http"
-	"net/url"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/Ekvo/bellerophon/iternal/service"
 	"github.com/Ekvo/bellerophon/iternal/source"
 )
 
+var (
+	// ErrInvalidCredentials - the same answer for unknown login and wrong password
+	ErrInvalidCredentials = service.ErrInvalidCredentials
+	// ErrInternal - text of answer instead of raw error of DB
+	ErrInternal    = errors.New("internal server error")
+	ErrNoPrincipal = errors.New("no authorized user")
+)
+
+const (
+	// SignUpExplicit - SignUp answers 409 when login or email is taken
+	SignUpExplicit = "explicit"
+	// SignUpPrivate - SignUp answers 202 with the same message for new and taken login or email
+	SignUpPrivate = "private"
+)
+
 type Application struct {
-	source *source.SqlSource
-	cashe  map[string]time.Time
+	source   source.Store
+	users    *service.Service
+	sessions source.SessionStore
+	cookies  *source.CookieCodec
+	tokens   *source.JWTSigner
+	refresh  source.RefreshStore
+	apiKeys  source.APIKeyStore
+	mfa      source.MFAStore
+	attempts source.AttemptStore
+	// loginPolicy, ipPolicy - limits of failed logins of one login and of one IP
+	loginPolicy source.LoginPolicy
+	ipPolicy    source.LoginPolicy
+	audit       func(e AuditEvent)
+	rates       source.RateLimitStore
+	// rateLimits - limits of routes by names source.RateRoute*
+	rateLimits map[string]source.RouteLimits
+	// signUpMode - SignUpExplicit or SignUpPrivate
+	signUpMode string
+	// prehashMode, prehashDeprecation, prehashSunset - passwords hashed by client (source.Hashed)
+	prehashMode        string
+	prehashDeprecation time.Time
+	prehashSunset      time.Time
+	// issuer - name of service in authenticator app
+	issuer string
+
+	// idleTimeout - session ends without requests, every request moves the end
+	idleTimeout time.Duration
+	// absoluteLifetime - session ends after login in any case
+	absoluteLifetime time.Duration
+	// accessLifetime, refreshLifetime - of tokens from pathToken
+	accessLifetime  time.Duration
+	refreshLifetime time.Duration
+	now             func() time.Time
+}
+
+type Option func(a *Application)
+
+// WithPasswordHasher - replaces default argon2id hasher
+func WithPasswordHasher(h source.PasswordHasher) Option {
+	return func(a *Application) {
+		service.WithHasher(h)(a.users)
+	}
+}
+
+// WithCookieCodec - replaces default codec with one random key
+func WithCookieCodec(c *source.CookieCodec) Option {
+	return func(a *Application) {
+		a.cookies = c
+	}
+}
+
+// WithJWTSigner - replaces default signer of access tokens with one random HS256 key
+func WithJWTSigner(s *source.JWTSigner) Option {
+	return func(a *Application) {
+		a.tokens = s
+	}
+}
+
+// WithRefreshStore - replaces default in-memory refresh tokens
+func WithRefreshStore(r source.RefreshStore) Option {
+	return func(a *Application) {
+		a.refresh = r
+		service.WithRefreshTokens(r)(a.users)
+	}
+}
+
+// WithAPIKeyStore - replaces default in-memory API keys
+func WithAPIKeyStore(k source.APIKeyStore) Option {
+	return func(a *Application) {
+		a.apiKeys = k
+		service.WithAPIKeys(k)(a.users)
+	}
+}
+
+// WithMFAStore - replaces default in-memory TOTP secrets
+func WithMFAStore(m source.MFAStore) Option {
+	return func(a *Application) {
+		a.mfa = m
+		service.WithMFA(m)(a.users)
+	}
 }
 
-func NewApplication(s *source.SqlSource) *Application {
-	return &Application{
-		source: s,
-		cashe:  make(map[string]time.Time),
+// WithLoginThrottle - replaces default in-memory counters of failed logins and default limits
+func WithLoginThrottle(attempts source.AttemptStore, perLogin, perIP source.LoginPolicy) Option {
+	return func(a *Application) {
+		a.attempts = attempts
+		a.loginPolicy = perLogin
+		a.ipPolicy = perIP
 	}
 }
 
+// WithAudit - receiver of events of brute-force protection, by default they are written to log
+func WithAudit(audit func(e AuditEvent)) Option {
+	return func(a *Application) {
+		a.audit = audit
+	}
+}
+
+// WithRateLimits - replaces default in-memory buckets and source.DefaultRateLimits,
+// route absent in limits has no limit
+func WithRateLimits(rates source.RateLimitStore, limits map[string]source.RouteLimits) Option {
+	return func(a *Application) {
+		a.rates = rates
+		a.rateLimits = limits
+	}
+}
+
+// WithSignUpMode - SignUpExplicit (default) or SignUpPrivate, which does not show taken emails and logins
+func WithSignUpMode(mode string) Option {
+	return func(a *Application) {
+		a.signUpMode = mode
+	}
+}
+
+// WithPasswordPolicy - replaces source.DefaultPasswordPolicy
+func WithPasswordPolicy(p source.PasswordPolicy) Option {
+	return func(a *Application) {
+		service.WithPasswordPolicy(p)(a.users)
+	}
+}
+
+// WithPrehashMode - PrehashDeprecated (default), PrehashAllow or PrehashReject for passwords hashed by client,
+// not zero deprecation - date of header Deprecation (start of application by default),
+// with not zero sunset deprecated mode rejects them since sunset
+func WithPrehashMode(mode string, deprecation, sunset time.Time) Option {
+	return func(a *Application) {
+		a.prehashMode = mode
+		if !deprecation.IsZero() {
+			a.prehashDeprecation = deprecation
+		}
+		a.prehashSunset = sunset
+	}
+}
+
+// WithIssuer - name of service in authenticator app, "bellerophon" by default
+func WithIssuer(issuer string) Option {
+	return func(a *Application) {
+		a.issuer = issuer
+	}
+}
+
+// WithTokenLifetime - lifetime of access token and of every refresh token after rotation
+func WithTokenLifetime(access, refresh time.Duration) Option {
+	return func(a *Application) {
+		a.accessLifetime = access
+		a.refreshLifetime = refresh
+	}
+}
+
+// WithSessionLifetime - idle timeout is moved by activity of user, absolute lifetime - is not
+func WithSessionLifetime(idle, absolute time.Duration) Option {
+	return func(a *Application) {
+		a.idleTimeout = idle
+		a.absoluteLifetime = absolute
+	}
+}
+
+// WithClock - source of current time, for tests
+func WithClock(now func() time.Time) Option {
+	return func(a *Application) {
+		a.now = now
+	}
+}
+
+// WithSessionStore - replaces default in-memory sessions,
+// SqlSessions keeps sessions after restart and shares them between instances
+func WithSessionStore(s source.SessionStore) Option {
+	return func(a *Application) {
+		a.sessions = s
+		service.WithSessions(s)(a.users)
+	}
+}
+
+// NewApplication - returns error if random keys of cookies or tokens are not created
+func NewApplication(s source.Store, opts ...Option) (*Application, error) {
+	cookies, errCookies := source.NewRandomCookieCodec()
+	if errCookies != nil {
+		return nil, fmt.Errorf("no random key for cookies - %w", errCookies)
+	}
+
+	key, errKey := source.NewJWTKey("random", source.AlgHS256)
+	if errKey != nil {
+		return nil, fmt.Errorf("no random key for tokens - %w", errKey)
+	}
+
+	tokens, errTokens := source.NewJWTSigner([]source.JWTKey{key})
+	if errTokens != nil {
+		return nil, fmt.Errorf("no signer of tokens - %w", errTokens)
+	}
+
+	sessions := source.NewMemorySessions()
+	refresh := source.NewMemoryRefreshTokens()
+	apiKeys := source.NewMemoryAPIKeys()
+	mfa := source.NewMemoryMFA()
+	users := service.New(s, service.WithSessions(sessions), service.WithRefreshTokens(refresh),
+		service.WithAPIKeys(apiKeys), service.WithMFA(mfa))
+
+	a := &Application{
+		source:   s,
+		users:    users,
+		sessions: sessions,
+		cookies:  cookies,
+		tokens:   tokens,
+		refresh:  refresh,
+		apiKeys:  apiKeys,
+		mfa:      mfa,
+		attempts: source.NewMemoryAttempts(),
+		issuer:   "bellerophon",
+
+		loginPolicy: source.DefaultLoginPolicy,
+		ipPolicy:    source.DefaultIPPolicy,
+		audit:       logAudit,
+		rates:       source.NewMemoryRateLimits(),
+		rateLimits:  source.DefaultRateLimits,
+		signUpMode:  SignUpExplicit,
+
+		prehashMode:        PrehashDeprecated,
+		prehashDeprecation: time.Now().UTC().Truncate(time.Second),
+
+		idleTimeout:      defaultIdleTimeout,
+		absoluteLifetime: defaultAbsoluteLifetime,
+		accessLifetime:   defaultAccessLifetime,
+		refreshLifetime:  defaultRefreshLifetime,
+		now:              time.Now,
+	}
+
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	// expiration of cookies and tokens follows clock of application, also changed later by WithClock
+	clock := func() time.Time { return a.now() }
+	a.cookies.SetClock(clock)
+	a.tokens.SetClock(clock)
+
+	return a, nil
+}
+
 const (
 	pathLogin  = "/bellerophon/login"
 	pathLogout = "/bellerophon/logout"
 	pathSignUp = "/bellerophon/signup"
 	pathMain   = "/bellerophon/my/main"
 	pathUserID = "/bellerophon/ownid"
+	pathCSRF   = "/bellerophon/csrf"
+	pathToken  = "/bellerophon/token"
+
+	pathAPIKeys = "/bellerophon/apikeys"
+	pathAPIKey  = "/bellerophon/apikeys/{id}"
+
+	pathLoginMFA    = "/bellerophon/login/mfa"
+	pathTOTP        = "/bellerophon/mfa/totp"
+	pathTOTPConfirm = "/bellerophon/mfa/totp/confirm"
+	pathTOTPDisable = "/bellerophon/mfa/totp/disable"
 )
 
-func (a Application) Routes(r *mux.Router) {
-	r.HandleFunc(pathSignUp, a.SignUp).Methods("POST")
-	r.HandleFunc(pathLogin, a.LogIn).Methods("GET", "POST")
+// Routes - every handler with non-GET method is wrapped by csrf,
+// except Token, which neither reads nor sets cookies.
+// Every authorized route needs its own scope from API key
+func (a *Application) Routes(r *mux.Router) {
+	r.HandleFunc(pathOpenAPI, a.OpenAPI).Methods("GET")
+	r.HandleFunc(pathCSRF, a.CSRF).Methods("GET")
+	r.HandleFunc(pathToken, a.Token).Methods("POST")
+
+	r.HandleFunc(pathSignUp, a.limitIP(source.RateRouteSignUp, a.csrf(a.SignUp))).Methods("POST")
+	r.HandleFunc(pathLogin, a.csrf(a.LogIn)).Methods("GET", "POST")
+	r.HandleFunc(pathLoginMFA, a.csrf(a.LogInMFA)).Methods("POST")
 	r.HandleFunc(pathLogout, a.LogOut).Methods("GET")
 
-	r.HandleFunc(pathMain, a.authorization(a.Main)).Methods("GET", "PUT")
-	r.HandleFunc(pathUserID, a.authorization(a.OwnID)).Methods("GET", "PUT")
+	main := func(scope string, next http.HandlerFunc) http.HandlerFunc {
+		return a.limitIP(source.RateRouteMain, a.authorization(scope, a.limitUser(source.RateRouteMain, next)))
+	}
+	ownID := func(scope string, next http.HandlerFunc) http.HandlerFunc {
+		return a.limitIP(source.RateRouteOwnID, a.authorization(scope, a.limitUser(source.RateRouteOwnID, next)))
+	}
+
+	r.HandleFunc(pathMain, main(source.ScopeSecretRead, a.Main)).Methods("GET")
+	r.HandleFunc(pathMain, main(source.ScopeSecretWrite, a.csrf(a.Main))).Methods("PUT")
+	r.HandleFunc(pathUserID, ownID(source.ScopeProfileRead, a.OwnID)).Methods("GET")
+	r.HandleFunc(pathUserID, ownID(source.ScopeProfileWrite, a.csrf(a.OwnID))).Methods("PUT")
+
+	account := func(next http.HandlerFunc) http.HandlerFunc {
+		return a.limitIP(source.RateRouteAccount, a.authorization(scopeAccount, a.limitUser(source.RateRouteAccount, next)))
+	}
+
+	r.HandleFunc(pathAPIKeys, account(a.APIKeys)).Methods("GET")
+	r.HandleFunc(pathAPIKeys, account(a.csrf(a.APIKeys))).Methods("POST")
+	r.HandleFunc(pathAPIKey, account(a.csrf(a.APIKeyRevoke))).Methods("DELETE")
+
+	r.HandleFunc(pathTOTP, account(a.csrf(a.TOTPEnroll))).Methods("POST")
+	r.HandleFunc(pathTOTPConfirm, account(a.csrf(a.TOTPConfirm))).Methods("POST")
+	r.HandleFunc(pathTOTPDisable, account(a.csrf(a.TOTPDisable))).Methods("POST")
+
+	a.routesV1(r)
 }
 
-const livingTime = 60 * time.Minute
+const (
+	defaultIdleTimeout      = 60 * time.Minute
+	defaultAbsoluteLifetime = 12 * time.Hour
+	defaultAccessLifetime   = 15 * time.Minute
+	defaultRefreshLifetime  = 30 * 24 * time.Hour
+)
 
-func (a Application) LogIn(w http.ResponseWriter, r *http.Request) {
+func (a *Application) LogIn(w http.ResponseWriter, r *http.Request) {
 	log.Printf("handle task: LogIn on url:%s", r.URL.Path)
 
 	if r.Method == http.MethodGet {
@@ -60,110 +351,103 @@ func (a Application) LogIn(w http.ResponseWriter, r *http.Request) {
 		var u source.UserSourceData
 		httpStatus, errDec := decode(r, &u)
 		if errDec != nil {
-			http.Error(w, errDec.Error(), httpStatus)
+			writeError(w, errDec, httpStatus)
 
 			return
 		}
 
-		if u.Direct != source.UserConnect {
-			http.Error(w, source.IncorrectDirectUserStruct.Error(), http.StatusBadRequest)
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
 
+		if !a.prehashAccepted(w, r, u.ChangePassword) {
 			return
 		}
 
-		if errHash := u.HashPassword(); errHash != nil {
-			http.Error(w, errHash.Error(), http.StatusBadRequest)
+		user, errCheck := a.authenticate(ctx, r, &u)
+		if errCheck != nil {
+			writeUserError(w, errCheck)
 
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
-		defer cancel()
-
-		user, errUser := a.source.UserLogin(ctx, &u)
-		if errUser != nil {
-			http.Error(w, errUser.Error(), http.StatusInternalServerError)
+		mfaToken, pending, errPending := a.mfaPending(ctx, user.ID)
+		if errPending != nil {
+			writeError(w, errPending, http.StatusInternalServerError)
 
 			return
 		}
+		if pending {
+			errCookie := a.cookies.SetCookie(w, source.MarkCookieMFA, strconv.Itoa(user.ID), a.now().Add(mfaPendingLifetime))
+			if errCookie != nil {
+				writeError(w, errCookie, http.StatusInternalServerError)
 
-		token := u.Login + u.PasswordOne
-		tokenHash := source.HashData(token)
-
-		startTime := time.Now()
-		exploration := startTime.Add(livingTime)
+				return
+			}
 
-		a.cashe[tokenHash] = exploration
+			_ = encode(w, &MFAPending{MFARequired: true, MFAToken: mfaToken}, http.StatusAccepted)
 
-		cookieU := http.Cookie{
-			Name:    source.MarkCookieUser,
-			Value:   url.QueryEscape(tokenHash),
-			Expires: exploration,
+			return
 		}
-		http.SetCookie(w, &cookieU)
 
-		cookieID := http.Cookie{
-			Name:    source.MarkCookieID,
-			Value:   url.QueryEscape(strconv.Itoa(user.ID)),
-			Expires: exploration,
+		if httpStatus, errSession := a.startSession(ctx, w, r, user.ID); errSession != nil {
+			writeError(w, errSession, httpStatus)
+
+			return
 		}
-		http.SetCookie(w, &cookieID)
 
 		http.Redirect(w, r, pathMain, http.StatusSeeOther)
 
 		return
 	}
 
-	http.Error(w, fmt.Sprintf("unexepted Metod - %s on url - %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+	writeError(w, fmt.Errorf("unexepted Metod - %s on url - %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
 }
 
-func (a Application) LogOut(w http.ResponseWriter, r *http.Request) {
+func (a *Application) LogOut(w http.ResponseWriter, r *http.Request) {
 	log.Printf("handle tsk: LogOut ou url:%s", r.URL.Path)
 
-	tokenU, _ := source.ReadCookie(r, source.MarkCookieUser)
+	tokenU, _ := a.cookies.ReadCookie(r, source.MarkCookieUser)
 	if len(tokenU) > 0 {
-		if _, ex := a.cashe[tokenU]; !ex {
-			http.Error(w, fmt.Sprintf("cashe - empty, cookie - not empty:%s", tokenU), http.StatusInternalServerError)
+		errRevoke := a.sessions.Revoke(r.Context(), source.SessionID(tokenU))
+		if errRevoke != nil {
+			writeError(w, errRevoke, http.StatusInternalServerError)
 
 			return
 		}
-
-		delete(a.cashe, tokenU)
 	}
 
-	source.CleanCookie(w, r)
+	a.cookies.CleanCookie(w, r)
 	http.Redirect(w, r, pathLogin, http.StatusSeeOther)
 }
 
-func (a Application) SignUp(w http.ResponseWriter, r *http.Request) {
+func (a *Application) SignUp(w http.ResponseWriter, r *http.Request) {
 	log.Printf("handle task: SignUp on url:%s", r.URL.Path)
 
 	var u source.UserSourceData
 	httpStatus, errDec := decode(r, &u)
 	if errDec != nil {
-		http.Error(w, errDec.Error(), httpStatus)
-
-		return
-	}
-
-	if u.Direct != source.UserCreate {
-		http.Error(w, source.IncorrectDirectUserStruct.Error(), http.StatusBadRequest)
+		writeError(w, errDec, httpStatus)
 
 		return
 	}
 
-	if errHash := u.HashPassword(); errHash != nil {
-		http.Error(w, errHash.Error(), http.StatusBadRequest)
-
+	if !a.prehashAccepted(w, r, u.ChangePassword) {
 		return
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 1*time.Second)
 	defer cancel()
 
-	id, errDBUser := a.source.UserCreate(ctx, &u)
-	if errDBUser != nil {
-		http.Error(w, errDBUser.Error(), http.StatusInternalServerError)
+	id, errRegister := a.users.RegisterUser(ctx, u)
+	if a.signUpMode == SignUpPrivate && (errRegister == nil || errors.Is(errRegister, service.ErrTaken)) {
+		// taken login or email is answered as new user, owner of email learns the rest by mail
+		msg := source.Message{Msg: "request for new user is accepted"}
+		_ = encode(w, &msg, http.StatusAccepted)
+
+		return
+	}
+	if errRegister != nil {
+		writeUserError(w, errRegister)
 
 		return
 	}
@@ -172,12 +456,12 @@ func (a Application) SignUp(w http.ResponseWriter, r *http.Request) {
 	_ = encode(w, &msg, http.StatusCreated)
 }
 
-func (a Application) Main(w http.ResponseWriter, r *http.Request) {
+func (a *Application) Main(w http.ResponseWriter, r *http.Request) {
 	log.Printf("handle task: Main on url:%s with Metod:%s", r.URL.Path, r.Method)
 
-	tokenID, errT := source.ReadCookie(r, source.MarkCookieID)
-	if errT != nil {
-		http.Error(w, errT.Error(), http.StatusInternalServerError)
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		writeError(w, ErrNoPrincipal, http.StatusUnauthorized)
 
 		return
 	}
@@ -186,9 +470,9 @@ func (a Application) Main(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if r.Method == http.MethodGet {
-		secret, errDB := a.source.InfoByID(ctx, tokenID)
-		if errDB != nil {
-			http.Error(w, errDB.Error(), http.StatusNoContent)
+		secret, errSecret := a.users.Secret(ctx, p.UserID)
+		if errSecret != nil {
+			writeUserError(w, errSecret)
 
 			return
 		}
@@ -203,14 +487,13 @@ func (a Application) Main(w http.ResponseWriter, r *http.Request) {
 		var secret source.Message
 		httpStatus, errDec := decode(r, &secret)
 		if errDec != nil {
-			http.Error(w, errDec.Error(), httpStatus)
+			writeError(w, errDec, httpStatus)
 
 			return
 		}
 
-		errDB := a.source.InfoChangeByID(ctx, tokenID, secret.Msg)
-		if errDB != nil {
-			http.Error(w, errDB.Error(), http.StatusInternalServerError)
+		if errSecret := a.users.UpdateSecret(ctx, p.UserID, secret.Msg); errSecret != nil {
+			writeUserError(w, errSecret)
 
 			return
 		}
@@ -221,15 +504,16 @@ func (a Application) Main(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Error(w, fmt.Sprintf("unexepted Metod - %s on url - %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+	writeError(w, fmt.Errorf("unexepted Metod - %s on url - %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
 }
 
-func (a Application) OwnID(w http.ResponseWriter, r *http.Request) {
+func (a *Application) OwnID(w http.ResponseWriter, r *http.Request) {
 	log.Printf("handle task: OwnID on url:%s with Metod^%s", r.URL.Path, r.Method)
 
-	tokenID, errT := source.ReadCookie(r, source.MarkCookieID)
-	if errT != nil {
-		http.Error(w, errT.Error(), http.StatusInternalServerError)
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		writeError(w, ErrNoPrincipal, http.StatusUnauthorized)
+
 		return
 	}
 
@@ -237,9 +521,9 @@ func (a Application) OwnID(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	if r.Method == http.MethodGet {
-		user, errUser := a.source.UserData(ctx, tokenID)
+		user, errUser := a.users.Profile(ctx, p.UserID)
 		if errUser != nil {
-			http.Error(w, errUser.Error(), http.StatusInternalServerError)
+			writeUserError(w, errUser)
 
 			return
 		}
@@ -253,150 +537,194 @@ func (a Application) OwnID(w http.ResponseWriter, r *http.Request) {
 		var u source.UserSourceData
 		httpStatus, errDec := decode(r, &u)
 		if errDec != nil {
-			http.Error(w, errDec.Error(), httpStatus)
+			writeError(w, errDec, httpStatus)
 
 			return
 		}
 
-		id, errID := strconv.Atoi(tokenID)
-		if errID != nil {
-			http.Error(w, errID.Error(), http.StatusInternalServerError)
+		// password and account are changed only by user himself, not by API key
+		if (u.Direct == source.NewPassword || u.Direct == source.UserDelete) && p.Scopes != nil {
+			writeError(w, errors.New("api key can't change password or delete user"), http.StatusForbidden)
 
 			return
 		}
 
-		u.ID = id
+		u.ID = p.UserID
 		m := source.Message{}
-		httpStatus = http.StatusCreated
+
+		var errChange error
 
 		switch u.Direct {
 
 		case source.NewLogin:
-			if len(u.Login) < 1 {
-				http.Error(w, fmt.Sprint("empty login"), http.StatusBadRequest)
-
-				return
-			}
-
-			errUpdate := a.source.UserDataLoginUpdate(ctx, &u)
-			if errUpdate != nil {
-				http.Error(w, errUpdate.Error(), http.StatusInternalServerError)
-
-				return
-			}
-
+			_, errChange = a.users.UpdateProfile(ctx, u.ID, p.SessionID, service.ProfilePatch{Login: &u.Login})
 			m.Msg = fmt.Sprintf("user login with id=%d updated", u.ID)
 
 		case source.NewPassword:
-			if len(u.PasswordOne) < 1 {
-				http.Error(w, fmt.Sprint("empty password"), http.StatusBadRequest)
-
-				return
-			}
-			if u.PasswordOne != u.PasswordTwo {
-				http.Error(w, fmt.Sprint("passwords not rqual"), http.StatusBadRequest)
-
-				return
-			}
-
-			if errStatusHash := u.HashPassword(); errStatusHash != nil {
-				http.Error(w, errStatusHash.Error(), http.StatusBadRequest)
-
-				return
-			}
-
-			errUpdate := a.source.UserDataPasswordUpdate(ctx, &u)
-			if errUpdate != nil {
-				http.Error(w, errUpdate.Error(), http.StatusInternalServerError)
-
+			if !a.prehashAccepted(w, r, u.ChangePassword) {
 				return
 			}
 
+			errChange = a.users.ChangePassword(ctx, u.ID, u.ChangePassword)
 			m.Msg = fmt.Sprintf("user password with id=%d updated", u.ID)
 
 		case source.NewName:
-			if len(u.Name) < 1 {
-				http.Error(w, fmt.Sprint("empty name"), http.StatusBadRequest)
-
-				return
-			}
-
-			errUpdate := a.source.UserDataNameUpdate(ctx, &u)
-			if errUpdate != nil {
-				http.Error(w, errUpdate.Error(), http.StatusInternalServerError)
-
-				return
-			}
-
+			_, errChange = a.users.UpdateProfile(ctx, u.ID, p.SessionID, service.ProfilePatch{Name: &u.Name, Surname: &u.Surname})
 			m.Msg = fmt.Sprintf("user Name and Surname with id=%d updated", u.ID)
 
 		case source.NewEmail:
-			if len(u.Email) < 1 {
-				http.Error(w, fmt.Sprint("empty emal"), http.StatusBadRequest)
-
-				return
-			}
-
-			errUpdate := a.source.UserDataEmailUpdate(ctx, &u)
-			if errUpdate != nil {
-				http.Error(w, errUpdate.Error(), http.StatusInternalServerError)
-
-				return
-			}
-
+			_, errChange = a.users.UpdateProfile(ctx, u.ID, p.SessionID, service.ProfilePatch{Email: &u.Email})
 			m.Msg = fmt.Sprintf("user email with id=%d updated", u.ID)
 
 		case source.UserDelete:
-			errDelete := a.source.UserDataDelete(ctx, strconv.Itoa(u.ID))
-			if errDelete != nil {
-				http.Error(w, errDelete.Error(), http.StatusInternalServerError)
-
-				return
-			}
-
+			errChange = a.users.DeleteAccount(ctx, u.ID)
 			m.Msg = fmt.Sprintf("user with id=%d deleted", u.ID)
-			httpStatus = http.StatusOK
 
 		default:
-			http.Error(w, fmt.Sprintf("unsupported direction=%d", u.Direct), http.StatusBadRequest)
+			writeError(w, fmt.Errorf("unsupported direction=%d", u.Direct), http.StatusBadRequest)
+
+			return
+		}
+		if errChange != nil {
+			writeUserError(w, errChange)
 
 			return
 		}
 
-		tokenU, _ := source.ReadCookie(r, source.MarkCookieUser)
-		delete(a.cashe, tokenU)
-		source.CleanCookie(w, r)
+		// legacy answers: 201 for change, 200 for delete
+		httpStatus = http.StatusCreated
+		if u.Direct == source.UserDelete {
+			httpStatus = http.StatusOK
+		}
+
+		// service has closed the session: after change of profile - current, otherwise - all of user
+		a.cookies.CleanCookie(w, r)
 
 		_ = encode(w, &m, httpStatus)
 
 		return
 	}
 
-	http.Error(w, fmt.Sprintf("unexepted Metod - %s on url - %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+	writeError(w, fmt.Errorf("unexepted Metod - %s on url - %s", r.Method, r.URL.Path), http.StatusMethodNotAllowed)
+}
+
+// startSession - new session of user and its cookie, on error - http status for answer
+func (a *Application) startSession(ctx context.Context, w http.ResponseWriter, r *http.Request, userID int) (int, error) {
+	token, sessionID, errToken := source.NewSessionToken()
+	if errToken != nil {
+		return http.StatusInternalServerError, errToken
+	}
+
+	startTime := a.now()
+	exploration := a.sessionExpiry(startTime, startTime)
+
+	session := source.Session{
+		ID:        sessionID,
+		UserID:    userID,
+		CreatedAt: startTime,
+		ExpiresAt: exploration,
+		UserAgent: r.UserAgent(),
+		IP:        clientIP(r),
+	}
+	if errSession := a.sessions.Create(ctx, session); errSession != nil {
+		return http.StatusInternalServerError, errSession
+	}
+
+	if errCookie := a.cookies.SetCookie(w, source.MarkCookieUser, token, exploration); errCookie != nil {
+		return http.StatusInternalServerError, errCookie
+	}
+
+	return http.StatusOK, nil
 }
 
-func (a Application) authorization(next http.HandlerFunc) http.HandlerFunc {
+// authorization - principal by cookie or by Authorization: Bearer,
+// principal of API key must have scope of route
+func (a *Application) authorization(scope string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		log.Printf("handle task: authorization on url:%s with Metod:%s", r.URL.Path, r.Method)
 
-		tokenU, err := source.ReadCookie(r, source.MarkCookieUser)
+		if bearer(r) {
+			a.bearerAuthorization(scope, next, w, r)
+
+			return
+		}
+
+		tokenU, err := a.cookies.ReadCookie(r, source.MarkCookieUser)
 		if err != nil {
-			http.Redirect(w, r, pathLogin, http.StatusSeeOther)
+			if !errors.Is(err, http.ErrNoCookie) {
+				log.Printf("authorization: cookie %s - %v", source.MarkCookieUser, err)
+			}
+			unauthenticated(w, r)
 
 			return
 		}
 
-		if life, ex := a.cashe[tokenU]; !ex || life.Before(time.Now()) {
-			delete(a.cashe, tokenU)
-			http.Redirect(w, r, pathLogin, http.StatusSeeOther)
+		sessionID := source.SessionID(tokenU)
+		session, errSession := a.sessions.Get(r.Context(), sessionID)
+		now := a.now()
+		if errSession != nil || !session.ExpiresAt.After(now) {
+			if errSession == nil {
+				_ = a.sessions.Revoke(r.Context(), sessionID)
+			}
+			unauthenticated(w, r)
 
 			return
 		}
 
-		next(w, r)
+		// sliding expiry, writes only when the end moves noticeably
+		exploration := a.sessionExpiry(session.CreatedAt, now)
+		if exploration.Sub(session.ExpiresAt) > a.idleTimeout/touchPart {
+			errTouch := a.sessions.Touch(r.Context(), sessionID, exploration)
+			if errTouch == nil {
+				errTouch = a.cookies.SetCookie(w, source.MarkCookieUser, tokenU, exploration)
+			}
+			if errTouch != nil {
+				log.Printf("touch session of user id=%d - %v", session.UserID, errTouch)
+			}
+		}
+
+		ctx := withPrincipal(r.Context(), Principal{UserID: session.UserID, SessionID: sessionID})
+
+		next(w, r.WithContext(ctx))
 	}
 }
 
+// unauthenticated - answer without session: /api/v1 gets 401 problem+json, other routes are sent to login
+func unauthenticated(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.URL.Path, pathV1) {
+		writeError(w, ErrNoPrincipal, http.StatusUnauthorized)
+
+		return
+	}
+
+	http.Redirect(w, r, pathLogin, http.StatusSeeOther)
+}
+
+// touchPart - session is prolonged when at least 1/touchPart of idle timeout has passed
+const touchPart = 10
+
+// sessionExpiry - end of session on activity at now: idle timeout, but not later than absolute lifetime
+func (a *Application) sessionExpiry(created, now time.Time) time.Time {
+	idle := now.Add(a.idleTimeout)
+	absolute := created.Add(a.absoluteLifetime)
+
+	if idle.After(absolute) {
+		return absolute
+	}
+
+	return idle
+}
+
+// clientIP - address of the peer without port
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
 func decode(r *http.Request, obj any) (int, error) {
 	media := r.Header.Get("Content-Type")
 
@@ -416,7 +744,7 @@ func decode(r *http.Request, obj any) (int, error) {
 		return http.StatusBadRequest, errDec
 	}
 
-	return http.StatusCreated, nil
+	return http.StatusOK, nil
 }
 
 func encode(w http.ResponseWriter, obj any, status int) error {
@@ -3,7 +3,6 @@ package app
 import (
 	"bytes"
 	"context"
-	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/gorilla/mux"
@@ -12,50 +11,45 @@ import (
 	"io"
 	"net/http"
 	"net/http/cookiejar"
+	"net/http/httptest"
 	"strconv"
 	"strings"
 	"testing"
 	"time"
 
-	"github.com/Ekvo/bellerophon/iternal/connect"
 	"github.com/Ekvo/bellerophon/iternal/source"
 )
 
 var (
-	db     *sql.DB           = nil
-	s      *source.SqlSource = nil
-	a      *Application      = nil
-	r      *mux.Router       = nil
-	srv    *http.Server      = nil
-	client *http.Client      = nil
-	jar    *cookiejar.Jar    = nil
+	s      source.Store     = nil
+	a      *Application     = nil
+	r      *mux.Router      = nil
+	srv    *httptest.Server = nil
+	client *http.Client     = nil
+	jar    *cookiejar.Jar   = nil
 )
 
 func startBaseAndServAndClient() error {
-	conn, errCon := connect.NewConnect("../connect/connectData.json")
-	if errCon != nil {
-		return errCon
+	s = source.NewMemorySource()
+
+	cookies, errCookies := source.NewRandomCookieCodec()
+	if errCookies != nil {
+		return errCookies
 	}
+	// test server is http, client with Secure cookies sends nothing
+	cookies.Secure = false
 
-	var errDB error = nil
+	var errApp error = nil
 
-	db, errDB = sql.Open("postgres", conn.String())
-	if errDB != nil {
-		return errDB
+	a, errApp = NewApplication(s, WithCookieCodec(cookies))
+	if errApp != nil {
+		return errApp
 	}
-
-	s = source.NewSqlSource(db)
-	a = NewApplication(s)
 	r = mux.NewRouter()
 
 	a.Routes(r)
 
-	srv = &http.Server{
-		Addr:         "127.0.0.1:8000",
-		Handler:      r,
-		ReadTimeout:  10 * time.Second,
-		WriteTimeout: 10 * time.Second,
-	}
+	srv = httptest.NewServer(r)
 
 	var errJar error = nil
 
@@ -95,6 +89,25 @@ func newUser(direct int) *source.UserSourceData {
 	}
 }
 
+// sessionCookie - value of cookie with session token signed by codec of application
+func sessionCookie(t *testing.T, token string) string {
+	value, errEnc := a.cookies.Encode(source.MarkCookieUser, token, time.Now().Add(defaultIdleTimeout))
+	require.NoError(t, errEnc)
+
+	return value
+}
+
+// withCSRF - adds token of double-submit check to state-changing request
+func withCSRF(t *testing.T, req *http.Request) {
+	const token = "test-csrf-token"
+
+	value, errEnc := a.cookies.Encode(source.MarkCookieCSRF, token, time.Now().Add(time.Hour))
+	require.NoError(t, errEnc)
+
+	req.AddCookie(&http.Cookie{Name: source.MarkCookieCSRF, Value: value})
+	req.Header.Set(HeaderCSRF, token)
+}
+
 func getNumberFromBody(data string) (string, error) {
 	arr := []byte{}
 
@@ -118,20 +131,7 @@ func getNumberFromBody(data string) (string, error) {
 func TestSignUpApprove(t *testing.T) {
 	errStart := startBaseAndServAndClient()
 	require.NoError(t, errStart)
-	defer db.Close()
-
-	go func() {
-		if errListen := srv.ListenAndServe(); errListen != nil {
-			assert.ErrorIs(t, errListen, http.ErrServerClosed)
-		}
-	}()
-	defer func() {
-		if err := srv.Close(); err != nil {
-			assert.NoError(t, err)
-		}
-	}()
-
-	time.Sleep(1 * time.Second)
+	defer srv.Close()
 
 	user := newUser(source.UserCreate)
 
@@ -141,8 +141,9 @@ func TestSignUpApprove(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 
-	req, errReq := http.NewRequestWithContext(ctx, http.MethodPost, "http://127.0.0.1:8000"+pathSignUp, bytes.NewReader(data))
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+pathSignUp, bytes.NewReader(data))
 	require.NoError(t, errReq)
+	withCSRF(t, req)
 	req.Header.Set("Content-Type", "application/json")
 
 	res, errRes := client.Do(req)
@@ -171,20 +172,7 @@ func TestSignUpApprove(t *testing.T) {
 func TestLoginAndAutorizationAndMainApprove(t *testing.T) {
 	errStart := startBaseAndServAndClient()
 	require.NoError(t, errStart)
-	defer db.Close()
-
-	go func() {
-		if errListen := srv.ListenAndServe(); errListen != nil {
-			assert.ErrorIs(t, errListen, http.ErrServerClosed)
-		}
-	}()
-	defer func() {
-		if err := srv.Close(); err != nil {
-			assert.NoError(t, err)
-		}
-	}()
-
-	time.Sleep(1 * time.Second)
+	defer srv.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
@@ -204,8 +192,9 @@ func TestLoginAndAutorizationAndMainApprove(t *testing.T) {
 	data, errMar := json.Marshal(userLogin)
 	require.NoError(t, errMar)
 
-	req, errReq := http.NewRequestWithContext(ctx, http.MethodPost, "http://127.0.0.1:8000"+pathLogin, bytes.NewReader(data))
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+pathLogin, bytes.NewReader(data))
 	require.NoError(t, errReq)
+	withCSRF(t, req)
 	req.Header.Set("Content-Type", "application/json")
 
 	res, errRes := client.Do(req)
@@ -229,20 +218,7 @@ func TestLoginAndAutorizationAndMainApprove(t *testing.T) {
 func TestLoginAndOwnIDAndNewLogin(t *testing.T) {
 	errStart := startBaseAndServAndClient()
 	require.NoError(t, errStart)
-	defer db.Close()
-
-	go func() {
-		if err := srv.ListenAndServe(); err != nil {
-			require.ErrorIs(t, err, http.ErrServerClosed)
-		}
-	}()
-	defer func() {
-		if err := srv.Close(); err != nil {
-			assert.NoError(t, err)
-		}
-	}()
-
-	time.Sleep(1 * time.Second)
+	defer srv.Close()
 
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
@@ -262,11 +238,13 @@ func TestLoginAndOwnIDAndNewLogin(t *testing.T) {
 
 	const tokU = "a1271fc76143dbce8cccce94e3ac04b55eb381fcacc377d355fd10a87ace401e"
 
-	req, errReq := http.NewRequestWithContext(ctx, http.MethodPut, "http://127.0.0.1:8000"+pathUserID, bytes.NewReader(data))
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodPut, srv.URL+pathUserID, bytes.NewReader(data))
 	require.NoError(t, errReq)
-	req.Header.Set("Cookie", fmt.Sprintf("tokenU=%s; tokenID=%s", tokU, strID))
+	req.Header.Set("Cookie", fmt.Sprintf("tokenU=%s", sessionCookie(t, tokU)))
+	withCSRF(t, req)
 	req.Header.Set("Content-Type", "application/json")
-	a.cashe[tokU] = time.Now().Add(livingTime)
+	errSession := a.sessions.Create(ctx, source.Session{ID: source.SessionID(tokU), UserID: id, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(defaultIdleTimeout)})
+	require.NoError(t, errSession)
 
 	res, errRes := client.Do(req)
 	require.NoError(t, errRes)
@@ -282,10 +260,10 @@ func TestLoginAndOwnIDAndNewLogin(t *testing.T) {
 
 	assert.Equal(t, wont, get)
 
-	life, ex := a.cashe[tokU]
+	session, errSession := a.sessions.Get(ctx, source.SessionID(tokU))
 
-	assert.False(t, ex)
-	assert.Empty(t, life)
+	assert.ErrorIs(t, errSession, source.ErrNotFound)
+	assert.Empty(t, session)
 
 	cookies := res.Cookies()
 	assert.NotNil(t, cookies)
@@ -296,3 +274,454 @@ func TestLoginAndOwnIDAndNewLogin(t *testing.T) {
 
 	_ = s.UserDataDelete(ctx, strID)
 }
+
+func TestLoginRehashLegacyPassword(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	// password stored by old versions - bare HashData
+	user := newUser(source.UserCreate)
+
+	id, errCreate := s.UserCreate(ctx, user)
+	require.NoError(t, errCreate)
+
+	errSecret := s.InfoChangeByID(ctx, strconv.Itoa(id), "new secret Loko")
+	require.NoError(t, errSecret)
+
+	data, errMar := json.Marshal(newUser(source.UserConnect))
+	require.NoError(t, errMar)
+
+	for i := 0; i < 2; i++ {
+		req, errReq := http.NewRequestWithContext(ctx, http.MethodPost, srv.URL+pathLogin, bytes.NewReader(data))
+		require.NoError(t, errReq)
+		withCSRF(t, req)
+		req.Header.Set("Content-Type", "application/json")
+
+		res, errRes := client.Do(req)
+		require.NoError(t, errRes)
+		res.Body.Close()
+
+		require.Equal(t, http.StatusOK, res.StatusCode)
+
+		stored, errLogin := s.UserLogin(ctx, user)
+		require.NoError(t, errLogin)
+		assert.True(t, strings.HasPrefix(stored.HashPassword, "$argon2id$"))
+	}
+}
+
+func TestLoginRandomSessionToken(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	id, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	data, errMar := json.Marshal(newUser(source.UserConnect))
+	require.NoError(t, errMar)
+
+	tokens := map[string]struct{}{}
+
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, pathLogin, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "bellerophon-test")
+
+		w := httptest.NewRecorder()
+		a.LogIn(w, req)
+
+		require.Equal(t, http.StatusSeeOther, w.Code)
+
+		token := ""
+		for _, c := range w.Result().Cookies() {
+			if c.Name == source.MarkCookieUser {
+				assert.True(t, c.HttpOnly)
+				assert.Equal(t, http.SameSiteLaxMode, c.SameSite)
+				assert.Equal(t, "/", c.Path)
+
+				var errDec error
+				token, errDec = a.cookies.Decode(c.Name, c.Value)
+				require.NoError(t, errDec)
+			}
+		}
+		require.NotEmpty(t, token)
+		assert.NotEqual(t, source.HashData(newUser(source.UserConnect).Login+newUser(source.UserConnect).PasswordOne), token)
+
+		session, errSession := a.sessions.Get(ctx, source.SessionID(token))
+		require.NoError(t, errSession)
+		assert.Equal(t, id, session.UserID)
+		assert.Equal(t, "bellerophon-test", session.UserAgent)
+		assert.NotEmpty(t, session.IP)
+		assert.True(t, session.ExpiresAt.After(session.CreatedAt))
+
+		tokens[token] = struct{}{}
+	}
+
+	// token differs on every login
+	assert.Len(t, tokens, 2)
+}
+
+func TestIDCookieIgnored(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	owner := newUser(source.UserCreate)
+
+	idOwner, errCreate := s.UserCreate(ctx, owner)
+	require.NoError(t, errCreate)
+	require.NoError(t, s.InfoChangeByID(ctx, strconv.Itoa(idOwner), "secret of owner"))
+
+	victim := newUser(source.UserCreate)
+	victim.Login = "Victim"
+	victim.Email = "victim@gmail.com"
+
+	idVictim, errCreate := s.UserCreate(ctx, victim)
+	require.NoError(t, errCreate)
+	require.NoError(t, s.InfoChangeByID(ctx, strconv.Itoa(idVictim), "secret of victim"))
+
+	const tokU = "owner-session-token"
+	errSession := a.sessions.Create(ctx, source.Session{ID: source.SessionID(tokU), UserID: idOwner, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(defaultIdleTimeout)})
+	require.NoError(t, errSession)
+
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+pathMain, nil)
+	require.NoError(t, errReq)
+	req.Header.Set("Cookie", fmt.Sprintf("tokenU=%s; tokenID=%d", sessionCookie(t, tokU), idVictim))
+
+	res, errRes := client.Do(req)
+	require.NoError(t, errRes)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	arrData, errData := io.ReadAll(res.Body)
+	require.NoError(t, errData)
+
+	assert.Equal(t, `{"message":"secret of owner"}`, strings.TrimSpace(string(arrData)))
+
+	// handler without authorization middleware has no user
+	w := httptest.NewRecorder()
+	a.Main(w, httptest.NewRequest(http.MethodGet, pathMain, nil))
+
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestSessionSlidingAndAbsoluteExpiry(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+	WithSessionLifetime(30*time.Minute, 2*time.Hour)(a)
+
+	id, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+	require.NoError(t, s.InfoChangeByID(ctx, strconv.Itoa(id), "new secret Loko"))
+
+	data, errMar := json.Marshal(newUser(source.UserConnect))
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPost, pathLogin, bytes.NewReader(data))
+	withCSRF(t, req)
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+
+	var cookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == source.MarkCookieUser {
+			cookie = c
+		}
+	}
+	require.NotNil(t, cookie)
+	assert.WithinDuration(t, now.Add(30*time.Minute), cookie.Expires, time.Second)
+
+	token, errDec := a.cookies.Decode(cookie.Name, cookie.Value)
+	require.NoError(t, errDec)
+
+	main := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, pathMain, nil)
+		req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	// activity every 20 minutes keeps session alive longer than idle timeout
+	for i := 0; i < 4; i++ {
+		now = now.Add(20 * time.Minute)
+
+		w = main()
+		require.Equal(t, http.StatusOK, w.Code, "after %v", time.Duration(i+1)*20*time.Minute)
+
+		refreshed := w.Result().Cookies()
+		require.Len(t, refreshed, 1)
+		assert.WithinDuration(t, now.Add(30*time.Minute), refreshed[0].Expires, time.Second)
+
+		// value of cookie has its own expiration, so client sends the refreshed one
+		cookie = refreshed[0]
+	}
+
+	// 95 minutes after login: next refresh is capped by absolute lifetime
+	now = now.Add(15 * time.Minute)
+
+	w = main()
+	require.Equal(t, http.StatusOK, w.Code)
+
+	session, errSession := a.sessions.Get(ctx, source.SessionID(token))
+	require.NoError(t, errSession)
+	assert.WithinDuration(t, session.CreatedAt.Add(2*time.Hour), session.ExpiresAt, time.Second)
+
+	now = session.CreatedAt.Add(2 * time.Hour)
+
+	w = main()
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	// cookie signed for longer time does not prolong session
+	cookie.Value, errDec = a.cookies.Encode(cookie.Name, token, now.Add(time.Hour))
+	require.NoError(t, errDec)
+
+	w = main()
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	_, errSession = a.sessions.Get(ctx, source.SessionID(token))
+	assert.ErrorIs(t, errSession, source.ErrNotFound)
+}
+
+func TestSessionIdleExpiry(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+
+	const tokU = "idle-session-token"
+
+	session := source.Session{
+		ID:        source.SessionID(tokU),
+		UserID:    1,
+		CreatedAt: now,
+		ExpiresAt: now.Add(defaultIdleTimeout),
+	}
+	require.NoError(t, a.sessions.Create(ctx, session))
+
+	now = now.Add(defaultIdleTimeout + time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, pathMain, nil)
+	req.AddCookie(&http.Cookie{Name: source.MarkCookieUser, Value: sessionCookie(t, tokU)})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, pathLogin, w.Header().Get("Location"))
+}
+
+func TestUnsignedCookieRejected(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	id, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+	require.NoError(t, s.InfoChangeByID(ctx, strconv.Itoa(id), "new secret Loko"))
+
+	const tokU = "unsigned-session-token"
+	errSession := a.sessions.Create(ctx, source.Session{ID: source.SessionID(tokU), UserID: id, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(defaultIdleTimeout)})
+	require.NoError(t, errSession)
+
+	signed := sessionCookie(t, tokU)
+
+	// value signed for other cookie
+	moved, errEnc := a.cookies.Encode("tokenOther", tokU, time.Now().Add(defaultIdleTimeout))
+	require.NoError(t, errEnc)
+
+	for _, value := range []string{tokU, moved} {
+		req := httptest.NewRequest(http.MethodGet, pathMain, nil)
+		req.AddCookie(&http.Cookie{Name: source.MarkCookieUser, Value: value})
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusSeeOther, w.Code)
+		assert.Equal(t, pathLogin, w.Header().Get("Location"))
+	}
+
+	req := httptest.NewRequest(http.MethodGet, pathMain, nil)
+	req.AddCookie(&http.Cookie{Name: source.MarkCookieUser, Value: signed})
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+// countingHasher - counts Verify calls of hasher
+type countingHasher struct {
+	source.PasswordHasher
+	verified int
+}
+
+func (h *countingHasher) Verify(password, encoded string) (bool, bool, error) {
+	h.verified++
+
+	return h.PasswordHasher.Verify(password, encoded)
+}
+
+func TestLoginUniformErrors(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	hasher := &countingHasher{PasswordHasher: source.NewArgon2idHasher()}
+	WithPasswordHasher(hasher)(a)
+
+	_, errCreate := s.UserCreate(context.Background(), newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	unknown := postLogin(t, "Nobody", "qwert1234", "192.0.2.30")
+	wrong := postLogin(t, "Loko", "wrong", "192.0.2.30")
+
+	assert.Equal(t, http.StatusUnauthorized, unknown.Code)
+	assert.Equal(t, unknown.Code, wrong.Code)
+	body := unknown.Body.String()
+	assert.Equal(t, body, wrong.Body.String())
+
+	problem := decodeProblem(t, unknown)
+	assert.Equal(t, CodeInvalidCredentials, problem.Code)
+	assert.Equal(t, ErrInvalidCredentials.Error(), problem.Detail)
+
+	// password of unknown login is verified against dummy hash
+	assert.Equal(t, 2, hasher.verified)
+
+	w, _ := postToken(t, TokenRequest{GrantType: GrantPassword, User: &source.UserSourceData{
+		Direct:         source.UserConnect,
+		ChangeLogin:    source.ChangeLogin{Login: "Nobody"},
+		ChangePassword: newUser(source.UserConnect).ChangePassword,
+	}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, body, w.Body.String())
+}
+
+func TestSignUpModes(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	signUp := func(login, email string) *httptest.ResponseRecorder {
+		u := newUser(source.UserCreate)
+		u.Login = login
+		u.Email = email
+
+		data, errMar := json.Marshal(u)
+		require.NoError(t, errMar)
+
+		req := httptest.NewRequest(http.MethodPost, pathSignUp, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		withCSRF(t, req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := signUp("Loko", "genus1991@gmail.com")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w = signUp("Other", "genus1991@gmail.com")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.NotContains(t, w.Body.String(), source.ErrDuplicate.Error())
+
+	WithSignUpMode(SignUpPrivate)(a)
+
+	taken := signUp("Other", "genus1991@gmail.com")
+	fresh := signUp("Fresh", "fresh@gmail.com")
+
+	assert.Equal(t, http.StatusAccepted, taken.Code)
+	assert.Equal(t, fresh.Code, taken.Code)
+	assert.Equal(t, fresh.Body.String(), taken.Body.String())
+
+	_, errUser := s.UserLogin(context.Background(), &source.UserSourceData{ChangeLogin: source.ChangeLogin{Login: "Fresh"}})
+	assert.NoError(t, errUser)
+}
+
+func TestPasswordPolicySignUpAndNewPassword(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	signUp := func(password string) *httptest.ResponseRecorder {
+		u := newUser(source.UserCreate)
+		u.ChangePassword = source.ChangePassword{Hashed: source.NoHashed, PasswordOne: password, PasswordTwo: password}
+
+		data, errMar := json.Marshal(u)
+		require.NoError(t, errMar)
+
+		req := httptest.NewRequest(http.MethodPost, pathSignUp, bytes.NewReader(data))
+		req.Header.Set("Content-Type", "application/json")
+		withCSRF(t, req)
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w := signUp("loko2024")
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	var rejected Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&rejected))
+
+	var codes []string
+	for _, v := range rejected.Violations {
+		codes = append(codes, v.Code)
+	}
+	assert.Equal(t, []string{source.ViolationPersonal}, codes)
+
+	w = signUp("Tr0ub4dor&3")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	id, errID := getNumberFromBody(w.Body.String())
+	require.NoError(t, errID)
+
+	userID, errAtoi := strconv.Atoi(id)
+	require.NoError(t, errAtoi)
+
+	// client hashed password is checked by the list of breached passwords
+	breached := source.HashData("password1")
+	w = serveWithSession(t, userID, http.MethodPut, pathUserID,
+		fmt.Sprintf(`{"direct":%d,"change_password":{"hashed":%d,"password_one":"%s","password_two":"%s"}}`, source.NewPassword, source.Hashed, breached, breached))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), source.ViolationBreached)
+
+	w = serveWithSession(t, userID, http.MethodPut, pathUserID,
+		fmt.Sprintf(`{"direct":%d,"change_password":{"hashed":%d,"password_one":"Pavel-secret-7","password_two":"Pavel-secret-7"}}`, source.NewPassword, source.NoHashed))
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), source.ViolationPersonal)
+
+	w = serveWithSession(t, userID, http.MethodPut, pathUserID,
+		fmt.Sprintf(`{"direct":%d,"change_password":{"hashed":%d,"password_one":"n3w-Secret","password_two":"n3w-Secret"}}`, source.NewPassword, source.NoHashed))
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
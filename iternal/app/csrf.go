@@ -0,0 +1,93 @@
+package app
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// HeaderCSRF - header with token from GET pathCSRF, needed by every state-changing request
+const HeaderCSRF = "X-CSRF-Token"
+
+const csrfTokenSize = 32
+
+var ErrCSRF = errors.New("csrf token is missing or wrong")
+
+// CSRFToken - answer of GET pathCSRF
+type CSRFToken struct {
+	Token  string `json:"csrf_token"`
+	Header string `json:"header"`
+}
+
+// CSRF - gives token for double-submit check, token is kept in signed cookie
+// and the same value must come back in HeaderCSRF
+func (a *Application) CSRF(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: CSRF on url:%s", r.URL.Path)
+
+	token, errRead := a.cookies.ReadCookie(r, source.MarkCookieCSRF)
+	if errRead != nil {
+		buf := make([]byte, csrfTokenSize)
+		if _, errRand := rand.Read(buf); errRand != nil {
+			writeError(w, errRand, http.StatusInternalServerError)
+
+			return
+		}
+
+		token = base64.RawURLEncoding.EncodeToString(buf)
+	}
+
+	// expiration is renewed on every call
+	errCookie := a.cookies.SetCookie(w, source.MarkCookieCSRF, token, a.now().Add(a.absoluteLifetime))
+	if errCookie != nil {
+		writeError(w, errCookie, http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = encode(w, &CSRFToken{Token: token, Header: HeaderCSRF}, http.StatusOK)
+}
+
+// csrf - rejects state-changing request without token of cookie in HeaderCSRF,
+// requests with Authorization: Bearer do not use cookies and are not checked
+func (a *Application) csrf(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if safeMethod(r.Method) || bearer(r) {
+			next(w, r)
+
+			return
+		}
+
+		token, errRead := a.cookies.ReadCookie(r, source.MarkCookieCSRF)
+		sent := r.Header.Get(HeaderCSRF)
+		if errRead != nil || sent == "" || subtle.ConstantTimeCompare([]byte(token), []byte(sent)) != 1 {
+			log.Printf("handle task: csrf on url:%s with Metod:%s - %v", r.URL.Path, r.Method, ErrCSRF)
+			writeError(w, ErrCSRF, http.StatusForbidden)
+
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+
+	return false
+}
+
+func bearer(r *http.Request) bool {
+	scheme, _, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+
+	return ok && strings.EqualFold(scheme, "Bearer")
+}
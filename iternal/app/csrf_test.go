@@ -0,0 +1,130 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+func getCSRFToken(t *testing.T, ctx context.Context) string {
+	req, errReq := http.NewRequestWithContext(ctx, http.MethodGet, srv.URL+pathCSRF, nil)
+	require.NoError(t, errReq)
+
+	res, errRes := client.Do(req)
+	require.NoError(t, errRes)
+	defer res.Body.Close()
+
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	var token CSRFToken
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&token))
+	require.NotEmpty(t, token.Token)
+	assert.Equal(t, HeaderCSRF, token.Header)
+
+	return token.Token
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	id, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	const tokU = "csrf-session-token"
+	errSession := a.sessions.Create(ctx, source.Session{ID: source.SessionID(tokU), UserID: id, CreatedAt: time.Now(), ExpiresAt: time.Now().Add(defaultIdleTimeout)})
+	require.NoError(t, errSession)
+
+	srvURL, errURL := url.Parse(srv.URL)
+	require.NoError(t, errURL)
+	jar.SetCookies(srvURL, []*http.Cookie{{Name: source.MarkCookieUser, Value: sessionCookie(t, tokU)}})
+
+	token := getCSRFToken(t, ctx)
+	// the same token while cookie lives
+	assert.Equal(t, token, getCSRFToken(t, ctx))
+
+	putSecret := func(header string) int {
+		req, errReq := http.NewRequestWithContext(ctx, http.MethodPut, srv.URL+pathMain, bytes.NewReader([]byte(`{"message":"csrf secret"}`)))
+		require.NoError(t, errReq)
+		req.Header.Set("Content-Type", "application/json")
+		if header != "" {
+			req.Header.Set(HeaderCSRF, header)
+		}
+
+		res, errRes := client.Do(req)
+		require.NoError(t, errRes)
+		res.Body.Close()
+
+		return res.StatusCode
+	}
+
+	assert.Equal(t, http.StatusForbidden, putSecret(""))
+	assert.Equal(t, http.StatusForbidden, putSecret(token+"x"))
+
+	secret, errInfo := s.InfoByID(ctx, strconv.Itoa(id))
+	assert.ErrorIs(t, errInfo, source.ErrNotFound)
+	assert.Empty(t, secret)
+
+	assert.Equal(t, http.StatusCreated, putSecret(token))
+
+	secret, errInfo = s.InfoByID(ctx, strconv.Itoa(id))
+	require.NoError(t, errInfo)
+	assert.Equal(t, "csrf secret", secret)
+}
+
+func TestCSRFTokenWithoutCookie(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	data, errMar := json.Marshal(newUser(source.UserCreate))
+	require.NoError(t, errMar)
+
+	// header alone, cookie of other site is not sent
+	req := httptest.NewRequest(http.MethodPost, pathSignUp, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderCSRF, "test-csrf-token")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// GET is not checked
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, pathLogin, nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestCSRFBearerExempt(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	data, errMar := json.Marshal(newUser(source.UserCreate))
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPost, pathSignUp, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer some.api.token")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+}
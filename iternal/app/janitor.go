@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// Janitor - background sweep of expired sessions from SessionStore and, when set by Sweep* methods,
+// of expired refresh tokens, old failed logins and idle buckets of rate limits
+type Janitor struct {
+	sessions source.SessionStore
+	refresh  source.RefreshStore
+	attempts source.AttemptStore
+	// attemptsKeep - failed logins older than this are removed
+	attemptsKeep time.Duration
+	rates        source.RateLimitStore
+	interval     time.Duration
+	now          func() time.Time
+
+	evicted atomic.Int64
+	live    atomic.Int64
+
+	started atomic.Bool
+	once    sync.Once
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+// defaultJanitorInterval - period of sweep when interval of NewJanitor is not positive
+const defaultJanitorInterval = 5 * time.Minute
+
+func NewJanitor(sessions source.SessionStore, interval time.Duration) *Janitor {
+	if interval <= 0 {
+		interval = defaultJanitorInterval
+	}
+
+	return &Janitor{
+		sessions: sessions,
+		interval: interval,
+		now:      time.Now,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// SweepRefreshTokens - expired refresh tokens are removed by the same sweep, call before Start
+func (j *Janitor) SweepRefreshTokens(r source.RefreshStore) {
+	j.refresh = r
+}
+
+// SweepLoginAttempts - counters of failed logins without failures for keep are removed by the same sweep,
+// call before Start
+func (j *Janitor) SweepLoginAttempts(a source.AttemptStore, keep time.Duration) {
+	j.attempts = a
+	j.attemptsKeep = keep
+}
+
+// SweepRateLimits - full buckets are removed by the same sweep, call before Start
+func (j *Janitor) SweepRateLimits(r source.RateLimitStore) {
+	j.rates = r
+}
+
+// Start - runs sweep every interval until Stop
+func (j *Janitor) Start() {
+	if !j.started.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer close(j.done)
+
+		ticker := time.NewTicker(j.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-j.stop:
+				return
+			case <-ticker.C:
+				ctx, cancel := context.WithTimeout(context.Background(), j.interval)
+				if err := j.Sweep(ctx); err != nil {
+					log.Printf("janitor sweep - %v", err)
+				}
+				cancel()
+			}
+		}
+	}()
+}
+
+// Stop - waits for the current sweep, safe to call more than once
+func (j *Janitor) Stop() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+
+	if j.started.Load() {
+		<-j.done
+	}
+}
+
+// Sweep - runs every sweep even if some of them fail, errors of all are joined
+func (j *Janitor) Sweep(ctx context.Context) error {
+	var errs []error
+
+	n, errDelete := j.sessions.DeleteExpired(ctx, j.now())
+	if errDelete != nil {
+		errs = append(errs, errDelete)
+	} else {
+		j.evicted.Add(int64(n))
+	}
+
+	live, errCount := j.sessions.Count(ctx)
+	if errCount != nil {
+		errs = append(errs, errCount)
+	} else {
+		j.live.Store(int64(live))
+	}
+
+	if j.refresh != nil {
+		if _, errRefresh := j.refresh.DeleteExpired(ctx, j.now()); errRefresh != nil {
+			errs = append(errs, errRefresh)
+		}
+	}
+
+	if j.attempts != nil {
+		if _, errAttempts := j.attempts.DeleteBefore(ctx, j.now().Add(-j.attemptsKeep)); errAttempts != nil {
+			errs = append(errs, errAttempts)
+		}
+	}
+
+	if j.rates != nil {
+		if _, errRates := j.rates.DeleteFull(ctx, j.now()); errRates != nil {
+			errs = append(errs, errRates)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Evicted - number of sessions removed since start
+func (j *Janitor) Evicted() int64 {
+	return j.evicted.Load()
+}
+
+// Live - number of sessions after the last sweep
+func (j *Janitor) Live() int64 {
+	return j.live.Load()
+}
@@ -0,0 +1,132 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+func TestJanitorSweep(t *testing.T) {
+	ctx := context.Background()
+	sessions := source.NewMemorySessions()
+
+	now := time.Now()
+
+	for i := 0; i < 5; i++ {
+		s := source.Session{
+			ID:        source.SessionID(strconv.Itoa(i)),
+			UserID:    1,
+			CreatedAt: now.Add(-time.Hour),
+			ExpiresAt: now.Add(time.Duration(i-3) * time.Minute),
+		}
+		require.NoError(t, sessions.Create(ctx, s))
+	}
+
+	j := NewJanitor(sessions, time.Hour)
+	j.now = func() time.Time { return now }
+
+	require.NoError(t, j.Sweep(ctx))
+	assert.Equal(t, int64(3), j.Evicted())
+	assert.Equal(t, int64(2), j.Live())
+
+	j.now = func() time.Time { return now.Add(time.Hour) }
+
+	require.NoError(t, j.Sweep(ctx))
+	assert.Equal(t, int64(5), j.Evicted())
+	assert.Equal(t, int64(0), j.Live())
+}
+
+func TestJanitorStartStop(t *testing.T) {
+	ctx := context.Background()
+	sessions := source.NewMemorySessions()
+
+	expired := source.Session{
+		ID:        source.SessionID("expired"),
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	require.NoError(t, sessions.Create(ctx, expired))
+
+	j := NewJanitor(sessions, 10*time.Millisecond)
+	j.Start()
+
+	assert.Eventually(t, func() bool { return j.Evicted() == 1 }, time.Second, 10*time.Millisecond)
+
+	j.Stop()
+	j.Stop()
+
+	// stop without start does not block
+	NewJanitor(sessions, time.Second).Stop()
+}
+
+func TestJanitorSweepLoginAttempts(t *testing.T) {
+	ctx := context.Background()
+	attempts := source.NewMemoryAttempts()
+
+	now := time.Now()
+
+	_, errOld := attempts.Fail(ctx, "login:old", now.Add(-2*time.Hour), now.Add(-3*time.Hour))
+	require.NoError(t, errOld)
+	_, errNew := attempts.Fail(ctx, "login:new", now, now.Add(-time.Hour))
+	require.NoError(t, errNew)
+
+	j := NewJanitor(source.NewMemorySessions(), time.Hour)
+	j.SweepLoginAttempts(attempts, time.Hour)
+	j.now = func() time.Time { return now }
+
+	require.NoError(t, j.Sweep(ctx))
+
+	_, errGet := attempts.Get(ctx, "login:old")
+	assert.ErrorIs(t, errGet, source.ErrNotFound)
+
+	_, errGet = attempts.Get(ctx, "login:new")
+	assert.NoError(t, errGet)
+}
+
+// failingRefresh - RefreshStore whose sweep always fails
+type failingRefresh struct {
+	source.RefreshStore
+}
+
+var errSweep = errors.New("sweep failed")
+
+func (failingRefresh) DeleteExpired(context.Context, time.Time) (int, error) {
+	return 0, errSweep
+}
+
+func TestJanitorSweepAfterError(t *testing.T) {
+	ctx := context.Background()
+	attempts := source.NewMemoryAttempts()
+
+	now := time.Now()
+
+	_, errOld := attempts.Fail(ctx, "login:old", now.Add(-2*time.Hour), now.Add(-3*time.Hour))
+	require.NoError(t, errOld)
+
+	j := NewJanitor(source.NewMemorySessions(), time.Hour)
+	j.SweepRefreshTokens(failingRefresh{})
+	j.SweepLoginAttempts(attempts, time.Hour)
+	j.now = func() time.Time { return now }
+
+	assert.ErrorIs(t, j.Sweep(ctx), errSweep)
+
+	// failed sweep of refresh tokens does not stop sweep of failed logins
+	_, errGet := attempts.Get(ctx, "login:old")
+	assert.ErrorIs(t, errGet, source.ErrNotFound)
+}
+
+func TestJanitorDefaultInterval(t *testing.T) {
+	for _, interval := range []time.Duration{0, -time.Second} {
+		j := NewJanitor(source.NewMemorySessions(), interval)
+		assert.Equal(t, defaultJanitorInterval, j.interval)
+
+		// ticker of Start panics on not positive interval
+		j.Start()
+		j.Stop()
+	}
+}
@@ -0,0 +1,339 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+const (
+	// mfaPendingLifetime - time for second step of login after password
+	mfaPendingLifetime = 5 * time.Minute
+	recoveryCodesCount = 10
+)
+
+var ErrMFACode = errors.New("mfa: wrong code")
+
+// MFAPending - answer of first step of login for user with 2FA,
+// MFAToken is for clients without cookies (Token with GrantMFA)
+type MFAPending struct {
+	MFARequired bool   `json:"mfa_required"`
+	MFAToken    string `json:"mfa_token"`
+}
+
+// MFACode - TOTP code or recovery code,
+// MFAToken is needed by LogInMFA only when there is no cookie from LogIn
+type MFACode struct {
+	Code     string `json:"code"`
+	MFAToken string `json:"mfa_token,omitempty"`
+}
+
+// TOTPEnrollment - secret for manual input and URI for QR code
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+// RecoveryCodes - shown once after confirmation of TOTP
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// LogInMFA - second step of login: code of user with token of the first step, then session as in LogIn
+func (a *Application) LogInMFA(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: LogInMFA on url:%s", r.URL.Path)
+
+	var c MFACode
+	httpStatus, errDec := decode(r, &c)
+	if errDec != nil {
+		writeError(w, errDec, httpStatus)
+
+		return
+	}
+
+	mfaToken := c.MFAToken
+	if mfaToken == "" {
+		if cookie, errCookie := r.Cookie(source.MarkCookieMFA); errCookie == nil {
+			mfaToken = cookie.Value
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	userID, httpStatus, errVerify := a.verifyMFALogin(ctx, clientIP(r), mfaToken, c.Code)
+	if errVerify != nil {
+		writeError(w, errVerify, httpStatus)
+
+		return
+	}
+
+	if httpStatus, errSession := a.startSession(ctx, w, r, userID); errSession != nil {
+		writeError(w, errSession, httpStatus)
+
+		return
+	}
+
+	a.cookies.DeleteCookie(w, source.MarkCookieMFA)
+	http.Redirect(w, r, pathMain, http.StatusSeeOther)
+}
+
+// TOTPEnroll - new secret, 2FA is on only after TOTPConfirm
+func (a *Application) TOTPEnroll(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: TOTPEnroll on url:%s", r.URL.Path)
+
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		writeError(w, ErrNoPrincipal, http.StatusUnauthorized)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	user, errUser := a.users.Profile(ctx, p.UserID)
+	if errUser != nil {
+		writeUserError(w, errUser)
+
+		return
+	}
+
+	secret, errSecret := source.NewTOTPSecret()
+	if errSecret != nil {
+		writeError(w, errSecret, http.StatusInternalServerError)
+
+		return
+	}
+
+	errEnroll := a.mfa.Enroll(ctx, p.UserID, secret)
+	if errors.Is(errEnroll, source.ErrDuplicate) {
+		writeError(w, errors.New("2FA is already on"), http.StatusConflict)
+
+		return
+	}
+	if errEnroll != nil {
+		writeError(w, errEnroll, http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = encode(w, &TOTPEnrollment{Secret: secret, URI: source.TOTPURI(a.issuer, user.Login, secret)}, http.StatusCreated)
+}
+
+// TOTPConfirm - first code from authenticator app turns 2FA on, answer has recovery codes
+func (a *Application) TOTPConfirm(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: TOTPConfirm on url:%s", r.URL.Path)
+
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		writeError(w, ErrNoPrincipal, http.StatusUnauthorized)
+
+		return
+	}
+
+	var c MFACode
+	httpStatus, errDec := decode(r, &c)
+	if errDec != nil {
+		writeError(w, errDec, httpStatus)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	mfa, errGet := a.mfa.Get(ctx, p.UserID)
+	if errors.Is(errGet, source.ErrNotFound) || (errGet == nil && mfa.Confirmed) {
+		writeError(w, errors.New("no enrollment of TOTP"), http.StatusConflict)
+
+		return
+	}
+	if errGet != nil {
+		writeError(w, errGet, http.StatusInternalServerError)
+
+		return
+	}
+
+	var step int64
+	httpStatus, errCode := a.throttledMFA(ctx, p.UserID, clientIP(r), func() (int, error) {
+		var match bool
+		if step, match = source.VerifyTOTP(mfa.Secret, c.Code, a.now()); !match {
+			return http.StatusBadRequest, ErrMFACode
+		}
+
+		return http.StatusOK, nil
+	})
+	if errCode != nil {
+		writeError(w, errCode, httpStatus)
+
+		return
+	}
+
+	codes, hashes, errCodes := source.NewRecoveryCodes(recoveryCodesCount)
+	if errCodes != nil {
+		writeError(w, errCodes, http.StatusInternalServerError)
+
+		return
+	}
+
+	if errConfirm := a.mfa.Confirm(ctx, p.UserID, step, hashes); errConfirm != nil {
+		writeError(w, errConfirm, http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = encode(w, &RecoveryCodes{Codes: codes}, http.StatusOK)
+}
+
+// TOTPDisable - turns 2FA off by TOTP code or recovery code
+func (a *Application) TOTPDisable(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: TOTPDisable on url:%s", r.URL.Path)
+
+	p, ok := PrincipalFrom(r.Context())
+	if !ok {
+		writeError(w, ErrNoPrincipal, http.StatusUnauthorized)
+
+		return
+	}
+
+	var c MFACode
+	httpStatus, errDec := decode(r, &c)
+	if errDec != nil {
+		writeError(w, errDec, httpStatus)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	httpStatus, errCode := a.throttledMFA(ctx, p.UserID, clientIP(r), func() (int, error) {
+		return a.verifyMFACode(ctx, p.UserID, c.Code)
+	})
+	if errCode != nil {
+		writeError(w, errCode, httpStatus)
+
+		return
+	}
+
+	if errDisable := a.mfa.Disable(ctx, p.UserID); errDisable != nil {
+		writeError(w, errDisable, http.StatusInternalServerError)
+
+		return
+	}
+
+	msg := source.Message{Msg: fmt.Sprintf("2FA of user id=%d is off", p.UserID)}
+	_ = encode(w, &msg, http.StatusOK)
+}
+
+// mfaPending - token of the first step of login when user has 2FA on
+func (a *Application) mfaPending(ctx context.Context, userID int) (string, bool, error) {
+	mfa, errGet := a.mfa.Get(ctx, userID)
+	if errors.Is(errGet, source.ErrNotFound) || (errGet == nil && !mfa.Confirmed) {
+		return "", false, nil
+	}
+	if errGet != nil {
+		return "", false, errGet
+	}
+
+	token, errEnc := a.cookies.Encode(source.MarkCookieMFA, strconv.Itoa(userID), a.now().Add(mfaPendingLifetime))
+	if errEnc != nil {
+		return "", false, errEnc
+	}
+
+	return token, true, nil
+}
+
+// verifyMFALogin - user of token of the first step of login, if code is right,
+// wrong codes are counted for user and IP as failed logins
+func (a *Application) verifyMFALogin(ctx context.Context, ip, mfaToken, code string) (int, int, error) {
+	value, errToken := a.cookies.Decode(source.MarkCookieMFA, mfaToken)
+	if errToken != nil {
+		return 0, http.StatusUnauthorized, errToken
+	}
+
+	userID, errID := strconv.Atoi(value)
+	if errID != nil {
+		return 0, http.StatusUnauthorized, source.ErrCookieTampered
+	}
+
+	httpStatus, errCode := a.throttledMFA(ctx, userID, ip, func() (int, error) {
+		return a.verifyMFACode(ctx, userID, code)
+	})
+	if errCode != nil {
+		return 0, httpStatus, errCode
+	}
+
+	return userID, http.StatusOK, nil
+}
+
+// throttledMFA - check of code of user behind counters of user and IP, wrong code (401 or ErrMFACode)
+// is counted as failed login, so guesses of codes are delayed and locked the same way
+func (a *Application) throttledMFA(ctx context.Context, userID int, ip string, check func() (int, error)) (int, error) {
+	keys := a.mfaKeys(userID, ip)
+
+	reserved, errBlocked := a.reserve(ctx, keys, ip)
+	if errBlocked != nil {
+		return throttleStatus(errBlocked), errBlocked
+	}
+
+	httpStatus, errCode := check()
+	if httpStatus == http.StatusUnauthorized || errors.Is(errCode, ErrMFACode) {
+		a.loginFailed(keys, reserved, ip)
+
+		return httpStatus, errCode
+	}
+	if errCode != nil {
+		a.release(ctx, keys)
+
+		return httpStatus, errCode
+	}
+
+	a.loginSucceeded(ctx, keys)
+
+	return http.StatusOK, nil
+}
+
+// verifyMFACode - TOTP code, every code is accepted once, or recovery code, which is removed
+func (a *Application) verifyMFACode(ctx context.Context, userID int, code string) (int, error) {
+	mfa, errGet := a.mfa.Get(ctx, userID)
+	if errors.Is(errGet, source.ErrNotFound) || (errGet == nil && !mfa.Confirmed) {
+		return http.StatusConflict, fmt.Errorf("2FA is off")
+	}
+	if errGet != nil {
+		return http.StatusInternalServerError, errGet
+	}
+
+	if step, match := source.VerifyTOTP(mfa.Secret, code, a.now()); match {
+		errStep := a.mfa.UseStep(ctx, userID, step)
+		if errors.Is(errStep, source.ErrCodeReused) {
+			return http.StatusUnauthorized, errStep
+		}
+		if errStep != nil {
+			return http.StatusInternalServerError, errStep
+		}
+
+		return http.StatusOK, nil
+	}
+
+	errRecovery := a.mfa.UseRecoveryCode(ctx, userID, source.RecoveryCodeHash(code))
+	if errors.Is(errRecovery, source.ErrNotFound) {
+		return http.StatusUnauthorized, ErrMFACode
+	}
+	if errRecovery != nil {
+		return http.StatusInternalServerError, errRecovery
+	}
+
+	log.Printf("recovery code of user id=%d is used", userID)
+
+	return http.StatusOK, nil
+}
@@ -0,0 +1,257 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// enableTOTP - 2FA on for user through handlers, returns secret and recovery codes
+func enableTOTP(t *testing.T, userID int, now time.Time) (string, []string) {
+	w := serveWithSession(t, userID, http.MethodPost, pathTOTP, "")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var enrollment TOTPEnrollment
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&enrollment))
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+
+	w = serveWithSession(t, userID, http.MethodPost, pathTOTPConfirm, `{"code":"000000x"}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	code, errCode := source.TOTPCode(enrollment.Secret, source.TOTPStep(now))
+	require.NoError(t, errCode)
+
+	w = serveWithSession(t, userID, http.MethodPost, pathTOTPConfirm, fmt.Sprintf(`{"code":"%s"}`, code))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var recovery RecoveryCodes
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&recovery))
+	require.Len(t, recovery.Codes, recoveryCodesCount)
+
+	return enrollment.Secret, recovery.Codes
+}
+
+func logInFirstStep(t *testing.T) (*httptest.ResponseRecorder, MFAPending) {
+	data, errMar := json.Marshal(newUser(source.UserConnect))
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPost, pathLogin, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	withCSRF(t, req)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var pending MFAPending
+	if w.Code == http.StatusAccepted {
+		require.NoError(t, json.NewDecoder(bytes.NewReader(w.Body.Bytes())).Decode(&pending))
+	}
+
+	return w, pending
+}
+
+func logInSecondStep(t *testing.T, body MFACode, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	data, errMar := json.Marshal(body)
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPost, pathLoginMFA, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	withCSRF(t, req)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+
+	id, errCreate := s.UserCreate(context.Background(), newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	secret, recovery := enableTOTP(t, id, now)
+
+	w := serveWithSession(t, id, http.MethodPost, pathTOTP, "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+
+	// password is not enough
+	w, pending := logInFirstStep(t)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	assert.True(t, pending.MFARequired)
+	assert.NotEmpty(t, pending.MFAToken)
+
+	var mfaCookie *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		require.NotEqual(t, source.MarkCookieUser, c.Name)
+		if c.Name == source.MarkCookieMFA {
+			mfaCookie = c
+		}
+	}
+	require.NotNil(t, mfaCookie)
+
+	// code of confirmation is already used
+	code, errCode := source.TOTPCode(secret, source.TOTPStep(now))
+	require.NoError(t, errCode)
+
+	w = logInSecondStep(t, MFACode{Code: code}, mfaCookie)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	now = now.Add(source.TOTPPeriod)
+
+	code, errCode = source.TOTPCode(secret, source.TOTPStep(now))
+	require.NoError(t, errCode)
+
+	w = logInSecondStep(t, MFACode{Code: code})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = logInSecondStep(t, MFACode{Code: code}, mfaCookie)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, pathMain, w.Header().Get("Location"))
+
+	var session bool
+	for _, c := range w.Result().Cookies() {
+		if c.Name == source.MarkCookieUser && c.Value != "" {
+			session = true
+		}
+	}
+	assert.True(t, session)
+
+	// replay of the same code
+	w = logInSecondStep(t, MFACode{Code: code, MFAToken: pending.MFAToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// recovery code works once
+	w = logInSecondStep(t, MFACode{Code: recovery[0], MFAToken: pending.MFAToken})
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	w = logInSecondStep(t, MFACode{Code: recovery[0], MFAToken: pending.MFAToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// token of the first step expires
+	now = now.Add(mfaPendingLifetime)
+
+	w = logInSecondStep(t, MFACode{Code: recovery[1], MFAToken: pending.MFAToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	// session of deleted user
+	w = serveWithSession(t, id+1000, http.MethodPost, pathTOTP, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, CodeNotFound, decodeProblem(t, w).Code)
+}
+
+func TestTokenWithTOTPAndDisable(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+
+	id, errCreate := s.UserCreate(context.Background(), newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	secret, _ := enableTOTP(t, id, now)
+
+	w, _ := postToken(t, TokenRequest{GrantType: GrantPassword, User: newUser(source.UserConnect)})
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var pending MFAPending
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&pending))
+	require.True(t, pending.MFARequired)
+
+	now = now.Add(source.TOTPPeriod)
+
+	code, errCode := source.TOTPCode(secret, source.TOTPStep(now))
+	require.NoError(t, errCode)
+
+	w, tokens := postToken(t, TokenRequest{GrantType: GrantMFA, MFAToken: pending.MFAToken, Code: "123"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w, tokens = postToken(t, TokenRequest{GrantType: GrantMFA, MFAToken: pending.MFAToken, Code: code})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// user has no secret yet
+	w = getMainBearer(t, tokens.AccessToken)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	// disable needs a new code
+	w = serveWithSession(t, id, http.MethodPost, pathTOTPDisable, fmt.Sprintf(`{"code":"%s"}`, code))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	now = now.Add(source.TOTPPeriod)
+
+	code, errCode = source.TOTPCode(secret, source.TOTPStep(now))
+	require.NoError(t, errCode)
+
+	w = serveWithSession(t, id, http.MethodPost, pathTOTPDisable, fmt.Sprintf(`{"code":"%s"}`, code))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	_, errGet := a.mfa.Get(context.Background(), id)
+	assert.ErrorIs(t, errGet, source.ErrNotFound)
+
+	w, _ = postToken(t, TokenRequest{GrantType: GrantPassword, User: newUser(source.UserConnect)})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w, _ = logInFirstStep(t)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+}
+
+func TestTOTPDisableThrottle(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+	WithAudit(func(e AuditEvent) {})(a)
+
+	id, errCreate := s.UserCreate(context.Background(), newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	secret, _ := enableTOTP(t, id, now)
+
+	policy := source.LoginPolicy{FreeFailures: 2, BaseDelay: time.Minute, MaxDelay: time.Minute, MaxFailures: 5, Lockout: time.Hour, Window: time.Hour}
+	WithLoginThrottle(source.NewMemoryAttempts(), policy, source.DefaultIPPolicy)(a)
+
+	// stolen session guesses codes
+	for i := 1; i <= 3; i++ {
+		w := serveWithSession(t, id, http.MethodPost, pathTOTPDisable, `{"code":"00000000"}`)
+		assert.Equal(t, http.StatusUnauthorized, w.Code, i)
+	}
+
+	w := serveWithSession(t, id, http.MethodPost, pathTOTPDisable, `{"code":"00000000"}`)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	// right code waits too, 2FA stays on
+	now = now.Add(source.TOTPPeriod)
+
+	code, errCode := source.TOTPCode(secret, source.TOTPStep(now))
+	require.NoError(t, errCode)
+
+	w = serveWithSession(t, id, http.MethodPost, pathTOTPDisable, fmt.Sprintf(`{"code":"%s"}`, code))
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	mfa, errGet := a.mfa.Get(context.Background(), id)
+	require.NoError(t, errGet)
+	assert.True(t, mfa.Confirmed)
+}
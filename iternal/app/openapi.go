@@ -0,0 +1,26 @@
+package app
+
+import (
+	_ "embed"
+	"log"
+	"net/http"
+)
+
+const pathOpenAPI = "/openapi.json"
+
+// openAPI - OpenAPI 3.1 document of every route of Routes, test checks it against router
+//
+//go:embed openapi.json
+var openAPI []byte
+
+// OpenAPI - description of API for clients and generators of code
+func (a *Application) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: OpenAPI on url:%s", r.URL.Path)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	if _, errWrite := w.Write(openAPI); errWrite != nil {
+		log.Printf("write openapi error - %v", errWrite)
+	}
+}
@@ -0,0 +1,188 @@
+package app
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// openAPIDoc - part of document checked by tests
+type openAPIDoc struct {
+	OpenAPI    string                                `json:"openapi"`
+	Paths      map[string]map[string]json.RawMessage `json:"paths"`
+	Components struct {
+		Schemas map[string]struct {
+			Properties map[string]json.RawMessage `json:"properties"`
+		} `json:"schemas"`
+	} `json:"components"`
+}
+
+func getOpenAPI(t *testing.T) (openAPIDoc, any) {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, pathOpenAPI, nil))
+
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "application/json", w.Header().Get("Content-Type"))
+
+	var doc openAPIDoc
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+
+	var raw any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &raw))
+
+	return doc, raw
+}
+
+// jsonFields - names of fields of v in json, fields of embedded struct without name are fields of v
+func jsonFields(v any) []string {
+	var fields []string
+
+	typ := reflect.TypeOf(v)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		switch {
+		case name == "-" || !f.IsExported():
+			continue
+		case name == "" && f.Anonymous:
+			fields = append(fields, jsonFields(reflect.Zero(f.Type).Interface())...)
+		case name == "":
+			fields = append(fields, f.Name)
+		default:
+			fields = append(fields, name)
+		}
+	}
+
+	return fields
+}
+
+// refs - every "$ref" of document
+func refs(node any, found []string) []string {
+	switch n := node.(type) {
+	case map[string]any:
+		for key, value := range n {
+			if ref, ok := value.(string); ok && key == "$ref" {
+				found = append(found, ref)
+			}
+			found = refs(value, found)
+		}
+	case []any:
+		for _, value := range n {
+			found = refs(value, found)
+		}
+	}
+
+	return found
+}
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	doc, _ := getOpenAPI(t)
+	assert.Equal(t, "3.1.0", doc.OpenAPI)
+
+	var routes []string
+	errWalk := r.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, errPath := route.GetPathTemplate()
+		if errPath != nil {
+			return errPath
+		}
+
+		methods, errMethods := route.GetMethods()
+		if errMethods != nil {
+			return errMethods
+		}
+
+		for _, method := range methods {
+			routes = append(routes, method+" "+path)
+		}
+
+		return nil
+	})
+	require.NoError(t, errWalk)
+	require.NotEmpty(t, routes)
+
+	var documented []string
+	for path, item := range doc.Paths {
+		for method := range item {
+			switch method {
+			case "get", "put", "post", "delete", "patch", "head", "options", "trace":
+				documented = append(documented, strings.ToUpper(method)+" "+path)
+			}
+		}
+	}
+
+	sort.Strings(routes)
+	sort.Strings(documented)
+
+	// both directions: route without description and description without route
+	assert.Equal(t, routes, documented)
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	doc, raw := getOpenAPI(t)
+
+	for name, v := range map[string]any{
+		"UserSourceData":    source.UserSourceData{},
+		"ChangeLogin":       source.ChangeLogin{},
+		"ChangePassword":    source.ChangePassword{},
+		"ChangeName":        source.ChangeName{},
+		"ChangeEmail":       source.ChangeEmail{},
+		"User":              source.User{},
+		"Message":           source.Message{},
+		"Problem":           Problem{},
+		"PasswordViolation": source.PasswordViolation{},
+		"CSRFToken":         CSRFToken{},
+		"TokenRequest":      TokenRequest{},
+		"TokenResponse":     TokenResponse{},
+		"MFAPending":        MFAPending{},
+		"MFACode":           MFACode{},
+		"TOTPEnrollment":    TOTPEnrollment{},
+		"RecoveryCodes":     RecoveryCodes{},
+		"APIKey":            source.APIKey{},
+		"APIKeyRequest":     APIKeyRequest{},
+		"APIKeyCreated":     APIKeyCreated{},
+		"Credentials":       Credentials{},
+		"UserPatch":         UserPatch{},
+		"PasswordChange":    PasswordChange{},
+		"Secret":            Secret{},
+	} {
+		schema, ok := doc.Components.Schemas[name]
+		if !assert.True(t, ok, "schema %s", name) {
+			continue
+		}
+
+		var properties []string
+		for property := range schema.Properties {
+			properties = append(properties, property)
+		}
+
+		assert.ElementsMatch(t, jsonFields(v), properties, "schema %s", name)
+	}
+
+	root := raw.(map[string]any)
+	for _, ref := range refs(root, nil) {
+		kind, name, ok := strings.Cut(strings.TrimPrefix(ref, "#/components/"), "/")
+		require.True(t, ok, ref)
+
+		components, _ := root["components"].(map[string]any)
+		defined, _ := components[kind].(map[string]any)
+		assert.Contains(t, defined, name, "no target of %s", ref)
+	}
+}
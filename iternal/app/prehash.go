@@ -0,0 +1,48 @@
+package app
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// modes of passwords hashed by client (source.Hashed)
+const (
+	// PrehashAllow - accepted without headers
+	PrehashAllow = "allow"
+	// PrehashDeprecated - accepted with headers Deprecation and Sunset until sunset, rejected after it
+	PrehashDeprecated = "deprecated"
+	// PrehashReject - only plain passwords (source.NoHashed) over TLS
+	PrehashReject = "reject"
+)
+
+var ErrPrehashRejected = errors.New("password hashed by client is not accepted, send plain password with \"hashed\":110 over TLS")
+
+// prehashAccepted - hash of client is deprecated: SHA-256 of password is as good as password
+// for anyone who sees it. Checks mode of password of request, marks answer for deprecated mode,
+// answers 400 for rejected one
+func (a *Application) prehashAccepted(w http.ResponseWriter, r *http.Request, c source.ChangePassword) bool {
+	if c.Hashed != source.Hashed || a.prehashMode == PrehashAllow {
+		return true
+	}
+
+	sunset := !a.prehashSunset.IsZero() && !a.now().Before(a.prehashSunset)
+
+	if a.prehashMode == PrehashReject || sunset {
+		writeError(w, ErrPrehashRejected, http.StatusBadRequest)
+
+		return false
+	}
+
+	log.Printf("deprecated: password hashed by client on url:%s from %s", r.URL.Path, clientIP(r))
+
+	w.Header().Set("Deprecation", fmt.Sprintf("@%d", a.prehashDeprecation.Unix()))
+	if !a.prehashSunset.IsZero() {
+		w.Header().Set("Sunset", a.prehashSunset.UTC().Format(http.TimeFormat))
+	}
+
+	return true
+}
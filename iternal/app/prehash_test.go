@@ -0,0 +1,99 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+func postLoginPassword(t *testing.T, c source.ChangePassword) *httptest.ResponseRecorder {
+	u := newUser(source.UserConnect)
+	u.ChangePassword = c
+
+	data, errMar := json.Marshal(u)
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPost, pathLogin, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	withCSRF(t, req)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestPrehashDeprecation(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+
+	sunset := now.Add(30 * time.Minute)
+	deprecation := time.Date(2026, time.October, 18, 0, 0, 0, 0, time.UTC)
+	WithPrehashMode(PrehashDeprecated, deprecation, sunset)(a)
+
+	// user of old client with hashed password
+	_, errCreate := s.UserCreate(context.Background(), newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	hashed := newUser(source.UserConnect).ChangePassword
+	plain := source.ChangePassword{Hashed: source.NoHashed, PasswordOne: "qwert1234", PasswordTwo: "qwert1234"}
+
+	w := postLoginPassword(t, hashed)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, "@1792281600", w.Header().Get("Deprecation"))
+	assert.Equal(t, sunset.UTC().Format(http.TimeFormat), w.Header().Get("Sunset"))
+
+	// the same user with plain password
+	w = postLoginPassword(t, plain)
+	require.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+
+	now = sunset
+
+	w = postLoginPassword(t, hashed)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, CodePrehashRejected, decodeProblem(t, w).Code)
+
+	w = postLoginPassword(t, plain)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	WithPrehashMode(PrehashAllow, time.Time{}, time.Time{})(a)
+
+	w = postLoginPassword(t, hashed)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+}
+
+func TestPrehashRejectMode(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	WithPrehashMode(PrehashReject, time.Time{}, time.Time{})(a)
+
+	data, errMar := json.Marshal(newUser(source.UserCreate))
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPost, pathSignUp, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	withCSRF(t, req)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, _ = postToken(t, TokenRequest{GrantType: GrantPassword, User: newUser(source.UserConnect)})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
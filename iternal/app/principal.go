@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+type ctxKey int
+
+const principalKey ctxKey = iota
+
+// Principal - user authenticated by authorization middleware,
+// handlers take identity of user only from here, SessionID is empty for bearer token.
+// Scopes is nil for user himself (cookie, access token) and is limited for API key
+type Principal struct {
+	UserID    int
+	SessionID string
+	Scopes    []string
+}
+
+// Allowed - principal may use route with scope
+func (p Principal) Allowed(scope string) bool {
+	return p.Scopes == nil || source.HasScope(p.Scopes, scope)
+}
+
+func withPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+
+	return p, ok
+}
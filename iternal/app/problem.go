@@ -0,0 +1,192 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/Ekvo/bellerophon/iternal/service"
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// ContentTypeProblem - media type of every error answer (RFC 7807)
+const ContentTypeProblem = "application/problem+json"
+
+// codes of Problem, stable for clients: text of Detail may change, Code does not
+const (
+	CodeInvalidRequest     = "invalid_request"
+	CodeUnsupportedMedia   = "unsupported_media_type"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeInvalidToken       = "invalid_token"
+	CodeTokenExpired       = "token_expired"
+	CodeTokenReused        = "token_reused"
+	CodeInvalidAPIKey      = "invalid_api_key"
+	CodeForbidden          = "forbidden"
+	CodeCSRF               = "csrf_failed"
+	CodeNotFound           = "not_found"
+	CodeNoSecret           = "no_secret"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeConflict           = "conflict"
+	CodeTaken              = "taken"
+	CodeLoginTaken         = "login_taken"
+	CodeEmailTaken         = "email_taken"
+	CodePasswordPolicy     = "password_policy"
+	CodePrehashRejected    = "prehash_rejected"
+	CodeInvalidMFACode     = "invalid_mfa_code"
+	CodeTooManyAttempts    = "too_many_attempts"
+	CodeRateLimited        = "rate_limited"
+	CodeUnavailable        = "unavailable"
+	CodeInternal           = "internal"
+)
+
+// Problem - body of error answer, Type is "urn:bellerophon:problem:<code>",
+// Violations - for CodePasswordPolicy, RetryAfter (seconds) - for CodeTooManyAttempts and CodeRateLimited
+type Problem struct {
+	Type       string                     `json:"type"`
+	Title      string                     `json:"title"`
+	Status     int                        `json:"status"`
+	Detail     string                     `json:"detail,omitempty"`
+	Code       string                     `json:"code"`
+	Violations []source.PasswordViolation `json:"violations,omitempty"`
+	RetryAfter int                        `json:"retry_after,omitempty"`
+}
+
+// knownErrors - sentinel errors with status and code, more specific first,
+// Detail of answer is text of sentinel, not of wrapped driver error
+var knownErrors = []struct {
+	err    error
+	status int
+	code   string
+}{
+	{service.ErrInvalidCredentials, http.StatusUnauthorized, CodeInvalidCredentials},
+	{service.ErrLoginTaken, http.StatusConflict, CodeLoginTaken},
+	{service.ErrEmailTaken, http.StatusConflict, CodeEmailTaken},
+	{service.ErrTaken, http.StatusConflict, CodeTaken},
+	{service.ErrUserNotFound, http.StatusNotFound, CodeNotFound},
+	{service.ErrNoSecret, http.StatusNotFound, CodeNoSecret},
+	{service.ErrConflict, http.StatusConflict, CodeConflict},
+	{service.ErrUnavailable, http.StatusServiceUnavailable, CodeUnavailable},
+	{source.ErrDuplicateLogin, http.StatusConflict, CodeLoginTaken},
+	{source.ErrDuplicateEmail, http.StatusConflict, CodeEmailTaken},
+	{source.ErrDuplicate, http.StatusConflict, CodeConflict},
+	{source.ErrNotFound, http.StatusNotFound, CodeNotFound},
+	{source.ErrConflict, http.StatusConflict, CodeConflict},
+	{source.ErrInvalidData, http.StatusBadRequest, CodeInvalidRequest},
+	{source.ErrUnavailable, http.StatusServiceUnavailable, CodeUnavailable},
+	{source.ErrTokenReused, http.StatusUnauthorized, CodeTokenReused},
+	{source.ErrTokenExpired, http.StatusUnauthorized, CodeTokenExpired},
+	{source.ErrTokenInvalid, http.StatusUnauthorized, CodeInvalidToken},
+	{source.ErrAPIKeyExpired, http.StatusUnauthorized, CodeInvalidAPIKey},
+	{source.ErrAPIKeyInvalid, http.StatusUnauthorized, CodeInvalidAPIKey},
+	{source.ErrCodeReused, http.StatusUnauthorized, CodeInvalidMFACode},
+	{ErrMFACode, http.StatusUnauthorized, CodeInvalidMFACode},
+	{ErrCSRF, http.StatusForbidden, CodeCSRF},
+	{ErrPrehashRejected, http.StatusBadRequest, CodePrehashRejected},
+	{ErrRateLimited, http.StatusTooManyRequests, CodeRateLimited},
+	{ErrNoPrincipal, http.StatusUnauthorized, CodeUnauthorized},
+	{ErrInternal, http.StatusInternalServerError, CodeInternal},
+}
+
+// statusCodes - code of error without own code
+var statusCodes = map[int]string{
+	http.StatusBadRequest:           CodeInvalidRequest,
+	http.StatusUnauthorized:         CodeUnauthorized,
+	http.StatusForbidden:            CodeForbidden,
+	http.StatusNotFound:             CodeNotFound,
+	http.StatusMethodNotAllowed:     CodeMethodNotAllowed,
+	http.StatusConflict:             CodeConflict,
+	http.StatusUnsupportedMediaType: CodeUnsupportedMedia,
+	http.StatusUnprocessableEntity:  CodeInvalidRequest,
+	http.StatusTooManyRequests:      CodeRateLimited,
+	http.StatusServiceUnavailable:   CodeUnavailable,
+}
+
+// writeUserError - answer for error of service, status by error
+func writeUserError(w http.ResponseWriter, err error) {
+	writeError(w, err, 0)
+}
+
+// writeError - the only writer of error answers: problem+json with stable code.
+// Zero or 5xx httpStatus is replaced by status of known error, zero of unknown error - 500. Text of unknown error with status 5xx is only logged
+func writeError(w http.ResponseWriter, err error, httpStatus int) {
+	p := problemOf(err, httpStatus)
+
+	if p.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(p.RetryAfter))
+	}
+
+	writeProblem(w, p)
+}
+
+func writeProblem(w http.ResponseWriter, p Problem) {
+	w.Header().Set("Content-Type", ContentTypeProblem)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+
+	if errWrite := json.NewEncoder(w).Encode(&p); errWrite != nil {
+		log.Printf("json.Encode error - %v", errWrite)
+	}
+}
+
+func problemOf(err error, httpStatus int) Problem {
+	p := Problem{Status: httpStatus, Detail: err.Error()}
+
+	var (
+		errValid    *service.ValidationError
+		errPolicy   *service.PolicyError
+		errAttempts *AttemptsError
+	)
+
+	switch {
+	case errors.As(err, &errPolicy):
+		p.Code, p.Violations = CodePasswordPolicy, errPolicy.Violations
+		p.Status = http.StatusUnprocessableEntity
+	case errors.As(err, &errAttempts):
+		p.Code, p.RetryAfter = CodeTooManyAttempts, seconds(errAttempts.RetryAfter)
+		p.Status = http.StatusTooManyRequests
+	case errors.As(err, &errValid):
+		p.Code = CodeInvalidRequest
+		p.Status = statusOr(p.Status, http.StatusBadRequest)
+	default:
+		for _, known := range knownErrors {
+			if errors.Is(err, known.err) {
+				p.Code, p.Detail = known.code, known.err.Error()
+				if p.Status == 0 || p.Status >= http.StatusInternalServerError {
+					p.Status = known.status
+				}
+
+				break
+			}
+		}
+	}
+
+	p.Status = statusOr(p.Status, http.StatusInternalServerError)
+
+	if p.Code == "" && p.Status >= http.StatusInternalServerError {
+		// error of driver or of other package, its text is not for clients
+		log.Printf("internal error - %v", err)
+		p.Detail = ErrInternal.Error()
+	}
+	if p.Code == "" {
+		p.Code = statusCodes[p.Status]
+	}
+	if p.Code == "" {
+		p.Code = CodeInternal
+	}
+
+	p.Type = "urn:bellerophon:problem:" + p.Code
+	p.Title = http.StatusText(p.Status)
+
+	return p
+}
+
+func statusOr(status, byError int) int {
+	if status == 0 {
+		return byError
+	}
+
+	return status
+}
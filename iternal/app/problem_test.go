@@ -0,0 +1,69 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/service"
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// decodeProblem - body of error answer
+func decodeProblem(t *testing.T, w *httptest.ResponseRecorder) Problem {
+	require.Equal(t, ContentTypeProblem, w.Header().Get("Content-Type"))
+
+	var p Problem
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&p))
+	assert.Equal(t, w.Code, p.Status)
+
+	return p
+}
+
+func TestWriteError(t *testing.T) {
+	driver := errors.New(`pq: duplicate key value violates unique constraint "users_login_key"`)
+
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   string
+		want   int
+		detail string
+	}{
+		{"duplicate login of driver", fmt.Errorf("%w: %w", source.ErrDuplicateLogin, driver), http.StatusInternalServerError, CodeLoginTaken, http.StatusConflict, source.ErrDuplicateLogin.Error()},
+		{"unknown error of driver", driver, http.StatusInternalServerError, CodeInternal, http.StatusInternalServerError, ErrInternal.Error()},
+		{"error of service", service.ErrEmailTaken, 0, CodeEmailTaken, http.StatusConflict, service.ErrEmailTaken.Error()},
+		{"wrapped not found", fmt.Errorf("%w: %w", source.ErrNotFound, driver), 0, CodeNotFound, http.StatusNotFound, source.ErrNotFound.Error()},
+		{"validation", service.ErrEmptyLogin, 0, CodeInvalidRequest, http.StatusBadRequest, service.ErrEmptyLogin.Error()},
+		{"status of handler", errors.New("empty scopes"), http.StatusBadRequest, CodeInvalidRequest, http.StatusBadRequest, "empty scopes"},
+		{"unavailable", fmt.Errorf("%w: %w", source.ErrUnavailable, driver), 0, CodeUnavailable, http.StatusServiceUnavailable, source.ErrUnavailable.Error()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			writeError(w, tt.err, tt.status)
+
+			assert.Equal(t, tt.want, w.Code)
+			assert.NotContains(t, w.Body.String(), "pq:")
+
+			p := decodeProblem(t, w)
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, "urn:bellerophon:problem:"+tt.code, p.Type)
+			assert.Equal(t, tt.detail, p.Detail)
+		})
+	}
+
+	w := httptest.NewRecorder()
+	writeError(w, &AttemptsError{RetryAfter: 1500 * time.Millisecond}, 0)
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "2", w.Header().Get("Retry-After"))
+	assert.Equal(t, 2, decodeProblem(t, w).RetryAfter)
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+var ErrRateLimited = errors.New("too many requests, try later")
+
+// limitIP - rate limit of route for address of client, before authorization,
+// so requests over limit do not reach DB
+func (a *Application) limitIP(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if a.rateLimited(w, r, route+":ip:"+clientIP(r), a.rateLimits[route].IP) {
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// limitUser - rate limit of route for authorized user, after authorization
+func (a *Application) limitUser(route string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p, ok := PrincipalFrom(r.Context()); ok {
+			if a.rateLimited(w, r, route+":user:"+strconv.Itoa(p.UserID), a.rateLimits[route].User) {
+				return
+			}
+		}
+
+		next(w, r)
+	}
+}
+
+// rateLimited - takes token of key, sets X-RateLimit-* headers and answers 429 if there is no token,
+// error of store lets request through
+func (a *Application) rateLimited(w http.ResponseWriter, r *http.Request, key string, limit source.RateLimit) bool {
+	if limit.Off() {
+		return false
+	}
+
+	allowance, errTake := a.rates.Take(r.Context(), key, limit, a.now())
+	if errTake != nil {
+		log.Printf("rate limit of %q - %v", key, errTake)
+
+		return false
+	}
+
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(allowance.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(allowance.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.Itoa(seconds(allowance.Reset)))
+
+	if allowance.Allowed {
+		return false
+	}
+
+	log.Printf("rate limit: %q on url:%s", key, r.URL.Path)
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds(allowance.RetryAfter)))
+	p := problemOf(ErrRateLimited, http.StatusTooManyRequests)
+	p.RetryAfter = seconds(allowance.RetryAfter)
+	writeProblem(w, p)
+
+	return true
+}
+
+// seconds - duration for headers, rounded up
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
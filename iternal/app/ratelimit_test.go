@@ -0,0 +1,104 @@
+package app
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+func TestRateLimitSignUpByIP(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+	WithRateLimits(source.NewMemoryRateLimits(), map[string]source.RouteLimits{
+		source.RateRouteSignUp: {IP: source.RateLimit{Requests: 2, Per: time.Minute}},
+	})(a)
+
+	signUp := func(ip string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, pathSignUp, nil)
+		req.RemoteAddr = ip + ":41000"
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		return w
+	}
+
+	for _, remaining := range []string{"1", "0"} {
+		w := signUp("192.0.2.20")
+		assert.NotEqual(t, http.StatusTooManyRequests, w.Code)
+		assert.Equal(t, "2", w.Header().Get("X-RateLimit-Limit"))
+		assert.Equal(t, remaining, w.Header().Get("X-RateLimit-Remaining"))
+	}
+
+	w := signUp("192.0.2.20")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+	assert.Equal(t, "60", w.Header().Get("X-RateLimit-Reset"))
+
+	w = signUp("192.0.2.21")
+	assert.NotEqual(t, http.StatusTooManyRequests, w.Code)
+
+	now = now.Add(30 * time.Second)
+
+	w = signUp("192.0.2.20")
+	assert.NotEqual(t, http.StatusTooManyRequests, w.Code)
+}
+
+func TestRateLimitMainByUser(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+	WithRateLimits(source.NewMemoryRateLimits(), map[string]source.RouteLimits{
+		source.RateRouteMain: {
+			IP:   source.RateLimit{Requests: 100, Per: time.Minute},
+			User: source.RateLimit{Requests: 3, Per: time.Minute, Burst: 1},
+		},
+	})(a)
+
+	ctx := context.Background()
+
+	first, errFirst := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errFirst)
+
+	other := newUser(source.UserCreate)
+	other.Login = "Other"
+	other.Email = "other@gmail.com"
+
+	second, errSecond := s.UserCreate(ctx, other)
+	require.NoError(t, errSecond)
+
+	w := serveWithSession(t, first, http.MethodGet, pathMain, "")
+	assert.NotEqual(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "1", w.Header().Get("X-RateLimit-Limit"))
+
+	w = serveWithSession(t, first, http.MethodGet, pathMain, "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "20", w.Header().Get("Retry-After"))
+
+	// the same address, but other user
+	w = serveWithSession(t, second, http.MethodGet, pathMain, "")
+	assert.NotEqual(t, http.StatusTooManyRequests, w.Code)
+
+	// OwnID has no limits in this application
+	w = serveWithSession(t, first, http.MethodGet, pathUserID, "")
+	assert.NotEqual(t, http.StatusTooManyRequests, w.Code)
+	assert.Empty(t, w.Header().Get("X-RateLimit-Limit"))
+
+	now = now.Add(20 * time.Second)
+
+	w = serveWithSession(t, first, http.MethodGet, pathMain, "")
+	assert.NotEqual(t, http.StatusTooManyRequests, w.Code)
+}
@@ -0,0 +1,198 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+const (
+	AuditLoginFailed   = "login_failed"
+	AuditLoginLocked   = "login_locked"
+	AuditLoginRejected = "login_rejected"
+)
+
+// AuditEvent - event of brute-force protection,
+// Key is "login:<login>", "mfa:<user id>" or "ip:<ip>", Until - end of delay or lockout
+type AuditEvent struct {
+	Time     time.Time
+	Event    string
+	Key      string
+	IP       string
+	Failures int
+	Until    time.Time
+}
+
+func logAudit(e AuditEvent) {
+	log.Printf("audit: %s key=%q ip=%s failures=%d until=%s",
+		e.Event, e.Key, e.IP, e.Failures, e.Until.Format(time.RFC3339))
+}
+
+// AttemptsError - answer while key is delayed or locked after failed logins,
+// the same for existing and unknown login
+type AttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *AttemptsError) Error() string {
+	return "too many failed attempts, try later"
+}
+
+// throttleKey - counter of failed logins with its limits
+type throttleKey struct {
+	key    string
+	policy source.LoginPolicy
+}
+
+func (a *Application) loginKeys(login, ip string) []throttleKey {
+	return []throttleKey{
+		{key: "login:" + strings.ToLower(strings.TrimSpace(login)), policy: a.loginPolicy},
+		{key: "ip:" + ip, policy: a.ipPolicy},
+	}
+}
+
+func (a *Application) mfaKeys(userID int, ip string) []throttleKey {
+	return []throttleKey{
+		{key: "mfa:" + strconv.Itoa(userID), policy: a.loginPolicy},
+		{key: "ip:" + ip, policy: a.ipPolicy},
+	}
+}
+
+// authenticate - service.Authenticate behind counters of failed logins of login and of IP,
+// unknown login is counted as wrong password, so lockout says nothing about existence of login
+func (a *Application) authenticate(ctx context.Context, r *http.Request, u *source.UserSourceData) (source.User, error) {
+	ip := clientIP(r)
+	keys := a.loginKeys(u.Login, ip)
+
+	reserved, errBlocked := a.reserve(ctx, keys, ip)
+	if errBlocked != nil {
+		return source.User{}, errBlocked
+	}
+
+	user, errCheck := a.users.Authenticate(ctx, *u)
+	if errors.Is(errCheck, ErrInvalidCredentials) {
+		a.loginFailed(keys, reserved, ip)
+
+		return source.User{}, errCheck
+	}
+	if errCheck != nil {
+		a.release(ctx, keys)
+
+		return source.User{}, errCheck
+	}
+
+	a.loginSucceeded(ctx, keys)
+
+	return user, nil
+}
+
+// reserve - counts attempt as failure of every key before check of password, so parallel guesses
+// can't pass the check together, returns counters with this attempt.
+// AttemptsError if any key is delayed or locked, then attempt is not counted
+func (a *Application) reserve(ctx context.Context, keys []throttleKey, ip string) ([]source.Attempt, error) {
+	now := a.now()
+
+	var (
+		retry    time.Duration
+		reserved []source.Attempt
+	)
+
+	for _, k := range keys {
+		before, errGet := a.attempts.Get(ctx, k.key)
+		if errGet != nil && !errors.Is(errGet, source.ErrNotFound) {
+			a.release(ctx, keys[:len(reserved)])
+
+			return nil, errGet
+		}
+
+		until := k.policy.BlockedUntil(before)
+		if until.After(now) {
+			a.audit(AuditEvent{Time: now, Event: AuditLoginRejected, Key: k.key, IP: ip, Failures: before.Failures, Until: until})
+
+			retry = max(retry, until.Sub(now))
+
+			break
+		}
+
+		at, errFail := a.attempts.Fail(ctx, k.key, now, now.Add(-k.policy.Window))
+		if errFail != nil {
+			a.release(ctx, keys[:len(reserved)])
+
+			return nil, errFail
+		}
+		reserved = append(reserved, at)
+
+		// failures counted between Get and Fail are parallel attempts, made just now
+		if at.Failures-1 > before.Failures {
+			parallel := source.Attempt{Key: k.key, Failures: at.Failures - 1, LastFailure: now}
+
+			until = k.policy.BlockedUntil(parallel)
+			if until.After(now) {
+				a.audit(AuditEvent{Time: now, Event: AuditLoginRejected, Key: k.key, IP: ip, Failures: parallel.Failures, Until: until})
+
+				retry = max(retry, until.Sub(now))
+
+				break
+			}
+		}
+	}
+
+	if retry > 0 {
+		a.release(ctx, keys[:len(reserved)])
+
+		return nil, &AttemptsError{RetryAfter: retry}
+	}
+
+	return reserved, nil
+}
+
+// loginFailed - audit of failure, which is already counted by reserve
+func (a *Application) loginFailed(keys []throttleKey, reserved []source.Attempt, ip string) {
+	now := a.now()
+
+	for i, at := range reserved {
+		k := keys[i]
+
+		event := AuditLoginFailed
+		if k.policy.Locked(at) {
+			event = AuditLoginLocked
+		}
+
+		a.audit(AuditEvent{Time: now, Event: event, Key: k.key, IP: ip, Failures: at.Failures, Until: k.policy.BlockedUntil(at)})
+	}
+}
+
+// loginSucceeded - forgets failures of login, of IP - only the reserved attempt,
+// otherwise one known password would reset counter of the whole address
+func (a *Application) loginSucceeded(ctx context.Context, keys []throttleKey) {
+	if errReset := a.attempts.Reset(ctx, keys[0].key); errReset != nil {
+		log.Printf("reset failed logins of %q - %v", keys[0].key, errReset)
+	}
+
+	a.release(ctx, keys[1:])
+}
+
+// release - attempt reserved for keys is not a failure
+func (a *Application) release(ctx context.Context, keys []throttleKey) {
+	for _, k := range keys {
+		if errForgive := a.attempts.Forgive(ctx, k.key); errForgive != nil {
+			log.Printf("forgive attempt of %q - %v", k.key, errForgive)
+		}
+	}
+}
+
+// throttleStatus - 429 for AttemptsError, 500 for error of store
+func throttleStatus(err error) int {
+	var errAttempts *AttemptsError
+	if errors.As(err, &errAttempts) {
+		return http.StatusTooManyRequests
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,207 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+func loginRequest(t *testing.T, login, password, ip string) *http.Request {
+	u := newUser(source.UserConnect)
+	u.Login = login
+	u.PasswordOne = source.HashData(password)
+	u.PasswordTwo = u.PasswordOne
+
+	data, errMar := json.Marshal(u)
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPost, pathLogin, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":41000"
+	withCSRF(t, req)
+
+	return req
+}
+
+func postLogin(t *testing.T, login, password, ip string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, loginRequest(t, login, password, ip))
+
+	return w
+}
+
+func TestLoginThrottle(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+
+	var events []AuditEvent
+	WithAudit(func(e AuditEvent) { events = append(events, e) })(a)
+
+	policy := source.LoginPolicy{
+		FreeFailures: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     4 * time.Second,
+		MaxFailures:  5,
+		Lockout:      time.Minute,
+		Window:       time.Hour,
+	}
+	WithLoginThrottle(source.NewMemoryAttempts(), policy, source.DefaultIPPolicy)(a)
+
+	_, errCreate := s.UserCreate(context.Background(), newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	// existing and unknown login get the same answers
+	for _, login := range []string{"Loko", "Nobody"} {
+		for i := 1; i <= 2; i++ {
+			w := postLogin(t, login, "wrong", "192.0.2.10")
+			assert.NotEqual(t, http.StatusTooManyRequests, w.Code, login)
+			assert.Empty(t, w.Header().Get("Retry-After"), login)
+		}
+
+		w := postLogin(t, login, "wrong", "192.0.2.10")
+		assert.NotEqual(t, http.StatusTooManyRequests, w.Code, login)
+
+		// the third failure delays the next attempt, even with right password
+		w = postLogin(t, login, "qwert1234", "192.0.2.10")
+		assert.Equal(t, http.StatusTooManyRequests, w.Code, login)
+		assert.Equal(t, "1", w.Header().Get("Retry-After"), login)
+	}
+
+	now = now.Add(time.Second)
+
+	w := postLogin(t, "Loko", "qwert1234", "192.0.2.10")
+	require.Equal(t, http.StatusSeeOther, w.Code)
+
+	// success forgets failures of login
+	for i := 1; i <= 5; i++ {
+		w = postLogin(t, "LOKO ", "wrong", "192.0.2.10")
+		assert.NotEqual(t, http.StatusTooManyRequests, w.Code, i)
+
+		now = now.Add(4 * time.Second)
+	}
+
+	w = postLogin(t, "Loko", "qwert1234", "192.0.2.10")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "56", w.Header().Get("Retry-After"))
+
+	last := events[len(events)-1]
+	assert.Equal(t, AuditLoginRejected, last.Event)
+	assert.Equal(t, "login:loko", last.Key)
+	assert.Equal(t, "192.0.2.10", last.IP)
+
+	var locked bool
+	for _, e := range events {
+		if e.Event == AuditLoginLocked && e.Key == "login:loko" {
+			locked = true
+			assert.Equal(t, 5, e.Failures)
+		}
+	}
+	assert.True(t, locked)
+
+	// other address does not help
+	w = postLogin(t, "Loko", "qwert1234", "198.51.100.7")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+
+	now = now.Add(time.Minute)
+
+	w = postLogin(t, "Loko", "qwert1234", "198.51.100.7")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+}
+
+func TestLoginThrottleByIP(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+	WithAudit(func(e AuditEvent) {})(a)
+
+	policy := source.LoginPolicy{FreeFailures: 3, BaseDelay: time.Minute, MaxDelay: time.Minute, MaxFailures: 10, Lockout: time.Hour, Window: time.Hour}
+	WithLoginThrottle(source.NewMemoryAttempts(), source.DefaultLoginPolicy, policy)(a)
+
+	_, errCreate := s.UserCreate(context.Background(), newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	// one failure for every login, but all from one address
+	for _, login := range []string{"a", "b", "c", "d"} {
+		w := postLogin(t, login, "wrong", "203.0.113.5")
+		assert.NotEqual(t, http.StatusTooManyRequests, w.Code, login)
+	}
+
+	w := postLogin(t, "Loko", "qwert1234", "203.0.113.5")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	w = postLogin(t, "Loko", "qwert1234", "203.0.113.6")
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	// the same limits for tokens
+	w, _ = postToken(t, TokenRequest{GrantType: GrantPassword, User: newUser(source.UserConnect)})
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestLoginThrottleParallel(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	now := time.Now()
+	WithClock(func() time.Time { return now })(a)
+	WithAudit(func(e AuditEvent) {})(a)
+
+	policy := source.LoginPolicy{FreeFailures: 2, BaseDelay: time.Minute, MaxDelay: time.Minute, MaxFailures: 5, Lockout: time.Hour, Window: time.Hour}
+	WithLoginThrottle(source.NewMemoryAttempts(), policy, source.DefaultIPPolicy)(a)
+
+	_, errCreate := s.UserCreate(context.Background(), newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	const guesses = 20
+
+	reqs := make([]*http.Request, guesses)
+	for i := range reqs {
+		reqs[i] = loginRequest(t, "Loko", "wrong", "192.0.2.20")
+	}
+
+	codes := make([]int, guesses)
+
+	var wg sync.WaitGroup
+	for i, req := range reqs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			codes[i] = w.Code
+		}()
+	}
+	wg.Wait()
+
+	// parallel guesses get no more checks of password than sequential ones
+	var checked int
+	for _, code := range codes {
+		if code != http.StatusTooManyRequests {
+			checked++
+		}
+	}
+	assert.LessOrEqual(t, checked, policy.FreeFailures+1)
+	assert.GreaterOrEqual(t, checked, 1)
+
+	at, errGet := a.attempts.Get(context.Background(), "login:loko")
+	require.NoError(t, errGet)
+	assert.Equal(t, checked, at.Failures)
+}
@@ -0,0 +1,248 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+const (
+	GrantPassword = "password"
+	GrantRefresh  = "refresh_token"
+	GrantMFA      = "mfa"
+)
+
+// TokenRequest - body of POST pathToken: User with Direct=UserConnect for GrantPassword,
+// RefreshToken for GrantRefresh, MFAToken from answer of GrantPassword and Code for GrantMFA
+type TokenRequest struct {
+	GrantType    string                 `json:"grant_type"`
+	User         *source.UserSourceData `json:"user,omitempty"`
+	RefreshToken string                 `json:"refresh_token,omitempty"`
+	MFAToken     string                 `json:"mfa_token,omitempty"`
+	Code         string                 `json:"code,omitempty"`
+}
+
+// TokenResponse - access token for header "Authorization: Bearer", refresh token is used once
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+// Token - tokens for clients without cookies: by login and password or by refresh token,
+// every refresh token is exchanged only once, second exchange revokes all tokens of its chain.
+// For user with 2FA GrantPassword answers 401 with MFAPending, tokens are given by GrantMFA
+func (a *Application) Token(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: Token on url:%s", r.URL.Path)
+
+	var t TokenRequest
+	httpStatus, errDec := decode(r, &t)
+	if errDec != nil {
+		writeError(w, errDec, httpStatus)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	var (
+		userID int
+		family string
+	)
+
+	switch t.GrantType {
+
+	case GrantPassword:
+		if t.User == nil {
+			writeError(w, errors.New("empty user"), http.StatusBadRequest)
+
+			return
+		}
+
+		if !a.prehashAccepted(w, r, t.User.ChangePassword) {
+			return
+		}
+
+		user, errCheck := a.authenticate(ctx, r, t.User)
+		if errCheck != nil {
+			writeUserError(w, errCheck)
+
+			return
+		}
+
+		mfaToken, pending, errPending := a.mfaPending(ctx, user.ID)
+		if errPending != nil {
+			writeError(w, errPending, http.StatusInternalServerError)
+
+			return
+		}
+		if pending {
+			_ = encode(w, &MFAPending{MFARequired: true, MFAToken: mfaToken}, http.StatusUnauthorized)
+
+			return
+		}
+
+		newFamily, errFamily := source.NewRefreshFamily()
+		if errFamily != nil {
+			writeError(w, errFamily, http.StatusInternalServerError)
+
+			return
+		}
+
+		userID, family = user.ID, newFamily
+
+	case GrantMFA:
+		id, httpStatus, errVerify := a.verifyMFALogin(ctx, clientIP(r), t.MFAToken, t.Code)
+		if errVerify != nil {
+			writeError(w, errVerify, httpStatus)
+
+			return
+		}
+
+		newFamily, errFamily := source.NewRefreshFamily()
+		if errFamily != nil {
+			writeError(w, errFamily, http.StatusInternalServerError)
+
+			return
+		}
+
+		userID, family = id, newFamily
+
+	case GrantRefresh:
+		old, errUse := a.refresh.Use(ctx, source.HashData(t.RefreshToken), a.now())
+		if errors.Is(errUse, source.ErrTokenReused) {
+			log.Printf("refresh token of user id=%d is reused - revoke its family", old.UserID)
+
+			if errRevoke := a.refresh.RevokeFamily(ctx, old.Family); errRevoke != nil {
+				log.Printf("revoke family of refresh token - %v", errRevoke)
+			}
+		}
+		if errors.Is(errUse, source.ErrNotFound) || errors.Is(errUse, source.ErrTokenReused) {
+			writeError(w, source.ErrTokenInvalid, http.StatusUnauthorized)
+
+			return
+		}
+		if errUse != nil {
+			writeError(w, errUse, http.StatusInternalServerError)
+
+			return
+		}
+		if !old.ExpiresAt.After(a.now()) {
+			writeError(w, source.ErrTokenExpired, http.StatusUnauthorized)
+
+			return
+		}
+
+		userID, family = old.UserID, old.Family
+
+	default:
+		writeError(w, errors.New("unsupported grant_type - "+t.GrantType), http.StatusBadRequest)
+
+		return
+	}
+
+	res, errIssue := a.issueTokens(ctx, userID, family)
+	if errIssue != nil {
+		writeError(w, errIssue, http.StatusInternalServerError)
+
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	_ = encode(w, &res, http.StatusOK)
+}
+
+// issueTokens - new access token and new refresh token of family
+func (a *Application) issueTokens(ctx context.Context, userID int, family string) (TokenResponse, error) {
+	now := a.now()
+
+	access, errSign := a.tokens.Sign(source.Claims{
+		Subject:   strconv.Itoa(userID),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(a.accessLifetime).Unix(),
+	})
+	if errSign != nil {
+		return TokenResponse{}, errSign
+	}
+
+	refresh, id, errToken := source.NewRefreshToken()
+	if errToken != nil {
+		return TokenResponse{}, errToken
+	}
+
+	errCreate := a.refresh.Create(ctx, source.RefreshToken{
+		ID:        id,
+		Family:    family,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(a.refreshLifetime),
+	})
+	if errCreate != nil {
+		return TokenResponse{}, errCreate
+	}
+
+	return TokenResponse{
+		AccessToken:  access,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(a.accessLifetime.Seconds()),
+		RefreshToken: refresh,
+	}, nil
+}
+
+// bearerAuthorization - principal from access token or API key of header Authorization,
+// answers 401 without redirect and 403 when API key has no scope of route
+func (a *Application) bearerAuthorization(scope string, next http.HandlerFunc, w http.ResponseWriter, r *http.Request) {
+	_, token, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+	token = strings.TrimSpace(token)
+
+	var (
+		p        Principal
+		errToken error
+	)
+
+	if strings.HasPrefix(token, source.APIKeyPrefix) {
+		p, errToken = a.apiKeyPrincipal(r.Context(), token)
+	} else {
+		p, errToken = a.accessTokenPrincipal(token)
+	}
+	if errToken != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeError(w, errToken, http.StatusUnauthorized)
+
+		return
+	}
+
+	if !p.Allowed(scope) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, scope))
+		writeError(w, fmt.Errorf("no scope %s", scope), http.StatusForbidden)
+
+		return
+	}
+
+	ctx := withPrincipal(r.Context(), p)
+
+	next(w, r.WithContext(ctx))
+}
+
+func (a *Application) accessTokenPrincipal(token string) (Principal, error) {
+	claims, errParse := a.tokens.Parse(token)
+	if errParse != nil {
+		return Principal{}, errParse
+	}
+
+	userID, errID := strconv.Atoi(claims.Subject)
+	if errID != nil {
+		return Principal{}, source.ErrTokenInvalid
+	}
+
+	return Principal{UserID: userID}, nil
+}
@@ -0,0 +1,159 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+func postToken(t *testing.T, body TokenRequest) (*httptest.ResponseRecorder, TokenResponse) {
+	data, errMar := json.Marshal(body)
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPost, pathToken, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var res TokenResponse
+	if w.Code == http.StatusOK {
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+	}
+
+	return w, res
+}
+
+func getMainBearer(t *testing.T, access string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, pathMain, nil)
+	req.Header.Set("Authorization", "Bearer "+access)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+func TestTokenPasswordAndBearer(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	id, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+	require.NoError(t, s.InfoChangeByID(ctx, strconv.Itoa(id), "new secret Loko"))
+
+	w, tokens := postToken(t, TokenRequest{GrantType: GrantPassword, User: newUser(source.UserConnect)})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "no-store", w.Header().Get("Cache-Control"))
+	assert.Empty(t, w.Result().Cookies())
+	assert.Equal(t, "Bearer", tokens.TokenType)
+	assert.Equal(t, int(defaultAccessLifetime.Seconds()), tokens.ExpiresIn)
+	assert.NotEmpty(t, tokens.RefreshToken)
+
+	w = getMainBearer(t, tokens.AccessToken)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	arrData, errData := io.ReadAll(w.Body)
+	require.NoError(t, errData)
+	assert.Equal(t, `{"message":"new secret Loko"}`, strings.TrimSpace(string(arrData)))
+
+	// PUT with bearer needs no csrf token
+	req := httptest.NewRequest(http.MethodPut, pathMain, strings.NewReader(`{"message":"bearer secret"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	// wrong token gives 401 instead of redirect to login
+	w = getMainBearer(t, tokens.AccessToken+"x")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Equal(t, `Bearer error="invalid_token"`, w.Header().Get("WWW-Authenticate"))
+
+	wrong := newUser(source.UserConnect)
+	wrong.PasswordOne = source.HashData("wrong password")
+	wrong.PasswordTwo = wrong.PasswordOne
+
+	w, _ = postToken(t, TokenRequest{GrantType: GrantPassword, User: wrong})
+	assert.NotEqual(t, http.StatusOK, w.Code)
+
+	w, _ = postToken(t, TokenRequest{GrantType: "client_credentials"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestTokenRefreshRotationAndReuse(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	_, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	w, first := postToken(t, TokenRequest{GrantType: GrantPassword, User: newUser(source.UserConnect)})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	w, second := postToken(t, TokenRequest{GrantType: GrantRefresh, RefreshToken: first.RefreshToken})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	w, third := postToken(t, TokenRequest{GrantType: GrantRefresh, RefreshToken: second.RefreshToken})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	// second exchange of the old token - whole chain is revoked
+	w, _ = postToken(t, TokenRequest{GrantType: GrantRefresh, RefreshToken: first.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w, _ = postToken(t, TokenRequest{GrantType: GrantRefresh, RefreshToken: third.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w, _ = postToken(t, TokenRequest{GrantType: GrantRefresh, RefreshToken: "unknown"})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
+
+func TestTokenRevokedOnPasswordChange(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	ctx := context.Background()
+
+	_, errCreate := s.UserCreate(ctx, newUser(source.UserCreate))
+	require.NoError(t, errCreate)
+
+	w, tokens := postToken(t, TokenRequest{GrantType: GrantPassword, User: newUser(source.UserConnect)})
+	require.Equal(t, http.StatusOK, w.Code)
+
+	change := newUser(source.NewPassword)
+	change.PasswordOne = source.HashData("new password")
+	change.PasswordTwo = change.PasswordOne
+
+	data, errMar := json.Marshal(change)
+	require.NoError(t, errMar)
+
+	req := httptest.NewRequest(http.MethodPut, pathUserID, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	w, _ = postToken(t, TokenRequest{GrantType: GrantRefresh, RefreshToken: tokens.RefreshToken})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+}
@@ -0,0 +1,261 @@
+package app
+
+import (
+	"context"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/service"
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// routes of resources, every change of user is its own method and path, without source.UserSourceData.Direct
+const (
+	pathV1         = "/api/v1/"
+	pathV1Me       = "/api/v1/users/me"
+	pathV1Password = "/api/v1/users/me/password"
+	pathV1Secret   = "/api/v1/users/me/secret"
+	pathV1Sessions = "/api/v1/sessions"
+)
+
+// UserPatch - body of PATCH /api/v1/users/me, absent field is not changed (service.ProfilePatch)
+type UserPatch struct {
+	Login   *string `json:"login,omitempty"`
+	Name    *string `json:"first_name,omitempty"`
+	Surname *string `json:"last_name,omitempty"`
+	Email   *string `json:"email,omitempty"`
+}
+
+// PasswordChange - body of PUT /api/v1/users/me/password, plain password over TLS
+type PasswordChange struct {
+	Password string `json:"password"`
+}
+
+// Secret - body of GET and PUT /api/v1/users/me/secret
+type Secret struct {
+	Secret string `json:"secret"`
+}
+
+// Credentials - body of POST /api/v1/sessions, plain password over TLS
+type Credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+// routesV1 - the same wrappers as legacy routes (rate limits, scopes, csrf), handlers use the same operations on user
+func (a *Application) routesV1(r *mux.Router) {
+	main := func(scope string, next http.HandlerFunc) http.HandlerFunc {
+		return a.limitIP(source.RateRouteMain, a.authorization(scope, a.limitUser(source.RateRouteMain, next)))
+	}
+	ownID := func(scope string, next http.HandlerFunc) http.HandlerFunc {
+		return a.limitIP(source.RateRouteOwnID, a.authorization(scope, a.limitUser(source.RateRouteOwnID, next)))
+	}
+
+	r.HandleFunc(pathV1Sessions, a.csrf(a.SessionCreate)).Methods("POST")
+
+	r.HandleFunc(pathV1Me, ownID(source.ScopeProfileRead, a.MeGet)).Methods("GET")
+	r.HandleFunc(pathV1Me, ownID(source.ScopeProfileWrite, a.csrf(a.MePatch))).Methods("PATCH")
+	r.HandleFunc(pathV1Me, ownID(scopeAccount, a.csrf(a.MeDelete))).Methods("DELETE")
+	r.HandleFunc(pathV1Password, ownID(scopeAccount, a.csrf(a.MePassword))).Methods("PUT")
+
+	r.HandleFunc(pathV1Secret, main(source.ScopeSecretRead, a.SecretGet)).Methods("GET")
+	r.HandleFunc(pathV1Secret, main(source.ScopeSecretWrite, a.csrf(a.SecretPut))).Methods("PUT")
+}
+
+// SessionCreate - login: 201 with cookie of session, or 202 with MFAPending when 2FA is on
+func (a *Application) SessionCreate(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: SessionCreate on url:%s", r.URL.Path)
+
+	var c Credentials
+	httpStatus, errDec := decode(r, &c)
+	if errDec != nil {
+		writeError(w, errDec, httpStatus)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	u := source.UserSourceData{
+		Direct:         source.UserConnect,
+		ChangeLogin:    source.ChangeLogin{Login: c.Login},
+		ChangePassword: source.ChangePassword{Hashed: source.NoHashed, PasswordOne: c.Password, PasswordTwo: c.Password},
+	}
+
+	user, errCheck := a.authenticate(ctx, r, &u)
+	if errCheck != nil {
+		writeUserError(w, errCheck)
+
+		return
+	}
+
+	mfaToken, pending, errPending := a.mfaPending(ctx, user.ID)
+	if errPending != nil {
+		writeError(w, errPending, http.StatusInternalServerError)
+
+		return
+	}
+	if pending {
+		errCookie := a.cookies.SetCookie(w, source.MarkCookieMFA, strconv.Itoa(user.ID), a.now().Add(mfaPendingLifetime))
+		if errCookie != nil {
+			writeError(w, errCookie, http.StatusInternalServerError)
+
+			return
+		}
+
+		_ = encode(w, &MFAPending{MFARequired: true, MFAToken: mfaToken}, http.StatusAccepted)
+
+		return
+	}
+
+	if httpStatus, errSession := a.startSession(ctx, w, r, user.ID); errSession != nil {
+		writeError(w, errSession, httpStatus)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (a *Application) MeGet(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: MeGet on url:%s", r.URL.Path)
+
+	p, _ := PrincipalFrom(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	user, errUser := a.users.Profile(ctx, p.UserID)
+	if errUser != nil {
+		writeUserError(w, errUser)
+
+		return
+	}
+
+	_ = encode(w, &user, http.StatusOK)
+}
+
+// MePatch - changes only fields of body, empty login, first_name or email is rejected before any change
+func (a *Application) MePatch(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: MePatch on url:%s", r.URL.Path)
+
+	p, _ := PrincipalFrom(r.Context())
+
+	var patch UserPatch
+	httpStatus, errDec := decode(r, &patch)
+	if errDec != nil {
+		writeError(w, errDec, httpStatus)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	user, errPatch := a.users.UpdateProfile(ctx, p.UserID, p.SessionID, service.ProfilePatch(patch))
+	if errPatch != nil {
+		writeUserError(w, errPatch)
+
+		return
+	}
+
+	// service has closed the session, as on legacy route
+	a.cookies.CleanCookie(w, r)
+
+	_ = encode(w, &user, http.StatusOK)
+}
+
+func (a *Application) MeDelete(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: MeDelete on url:%s", r.URL.Path)
+
+	p, _ := PrincipalFrom(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if errDelete := a.users.DeleteAccount(ctx, p.UserID); errDelete != nil {
+		writeUserError(w, errDelete)
+
+		return
+	}
+
+	a.cookies.CleanCookie(w, r)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MePassword - new password closes all sessions and refresh tokens of user
+func (a *Application) MePassword(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: MePassword on url:%s", r.URL.Path)
+
+	p, _ := PrincipalFrom(r.Context())
+
+	var c PasswordChange
+	httpStatus, errDec := decode(r, &c)
+	if errDec != nil {
+		writeError(w, errDec, httpStatus)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	password := source.ChangePassword{Hashed: source.NoHashed, PasswordOne: c.Password, PasswordTwo: c.Password}
+	if errChange := a.users.ChangePassword(ctx, p.UserID, password); errChange != nil {
+		writeUserError(w, errChange)
+
+		return
+	}
+
+	a.cookies.CleanCookie(w, r)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *Application) SecretGet(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: SecretGet on url:%s", r.URL.Path)
+
+	p, _ := PrincipalFrom(r.Context())
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	secret, errSecret := a.users.Secret(ctx, p.UserID)
+	if errSecret != nil {
+		writeUserError(w, errSecret)
+
+		return
+	}
+
+	_ = encode(w, &Secret{Secret: secret}, http.StatusOK)
+}
+
+func (a *Application) SecretPut(w http.ResponseWriter, r *http.Request) {
+	log.Printf("handle task: SecretPut on url:%s", r.URL.Path)
+
+	p, _ := PrincipalFrom(r.Context())
+
+	var secret Secret
+	httpStatus, errDec := decode(r, &secret)
+	if errDec != nil {
+		writeError(w, errDec, httpStatus)
+
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	if errSecret := a.users.UpdateSecret(ctx, p.UserID, secret.Secret); errSecret != nil {
+		writeUserError(w, errSecret)
+
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,253 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// createSession - POST /api/v1/sessions
+func createSession(t *testing.T, login, password string) *httptest.ResponseRecorder {
+	body := fmt.Sprintf(`{"login":"%s","password":"%s"}`, login, password)
+
+	req := httptest.NewRequest(http.MethodPost, pathV1Sessions, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	withCSRF(t, req)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	return w
+}
+
+// createV1User - user with plain password by service, returns id
+func createV1User(t *testing.T, login, password string) int {
+	u := newUser(source.UserCreate)
+	u.Login = login
+	u.Email = login + "@example.com"
+	u.ChangePassword = source.ChangePassword{Hashed: source.NoHashed, PasswordOne: password, PasswordTwo: password}
+
+	id, errCreate := a.users.RegisterUser(context.Background(), *u)
+	require.NoError(t, errCreate)
+
+	return id
+}
+
+func TestV1Sessions(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	createV1User(t, "Loko", "Tr0ub4dor&3")
+
+	w := createSession(t, "Loko", "wrong-password")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = createSession(t, "Nobody", "Tr0ub4dor&3")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = createSession(t, "Loko", "Tr0ub4dor&3")
+	require.Equal(t, http.StatusCreated, w.Code)
+
+	var session *http.Cookie
+	for _, c := range w.Result().Cookies() {
+		if c.Name == source.MarkCookieUser {
+			session = c
+		}
+	}
+	require.NotNil(t, session)
+
+	req := httptest.NewRequest(http.MethodGet, pathV1Me, nil)
+	req.AddCookie(session)
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var user source.User
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&user))
+	assert.Equal(t, "Loko", user.Login)
+}
+
+func TestV1PatchMe(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	userID := createV1User(t, "Loko", "Tr0ub4dor&3")
+	createV1User(t, "Other", "Tr0ub4dor&3")
+
+	w := serveWithSession(t, userID, http.MethodPatch, pathV1Me, `{"last_name":"Petrov"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var user source.User
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&user))
+	assert.Equal(t, "Pavel", user.Name)
+	assert.Equal(t, "Petrov", user.Surname)
+	assert.Equal(t, "Loko", user.Login)
+
+	w = serveWithSession(t, userID, http.MethodPatch, pathV1Me, `{"login":"Loko2","email":"loko2@example.com"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&user))
+	assert.Equal(t, "Loko2", user.Login)
+	assert.Equal(t, "loko2@example.com", user.Email)
+
+	// empty field is rejected before any change
+	w = serveWithSession(t, userID, http.MethodPatch, pathV1Me, `{"login":"Loko3","first_name":""}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveWithSession(t, userID, http.MethodPatch, pathV1Me, `{}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveWithSession(t, userID, http.MethodPatch, pathV1Me, `{"direct":3}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveWithSession(t, userID, http.MethodPatch, pathV1Me, `{"login":"Other"}`)
+	require.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, CodeLoginTaken, decodeProblem(t, w).Code)
+
+	// taken email changes nothing, login and name are not written
+	w = serveWithSession(t, userID, http.MethodPatch, pathV1Me, `{"login":"Loko3","first_name":"Pasha","email":"Other@example.com"}`)
+	require.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, CodeEmailTaken, decodeProblem(t, w).Code)
+
+	w = serveWithSession(t, userID, http.MethodGet, pathV1Me, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&user))
+	assert.Equal(t, "Loko2", user.Login)
+	assert.Equal(t, "Pavel", user.Name)
+	assert.Equal(t, "loko2@example.com", user.Email)
+}
+
+func TestV1PasswordAndDelete(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	userID := createV1User(t, "Loko", "Tr0ub4dor&3")
+
+	w := serveWithSession(t, userID, http.MethodPut, pathV1Password, `{"password":"loko2024"}`)
+	require.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), source.ViolationPersonal)
+
+	w = serveWithSession(t, userID, http.MethodPut, pathV1Password, `{"password":""}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serveWithSession(t, userID, http.MethodPut, pathV1Password, `{"password":"n3w-Secret"}`)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	sessions, errList := a.sessions.List(context.Background(), userID)
+	require.NoError(t, errList)
+	assert.Empty(t, sessions)
+
+	assert.Equal(t, http.StatusUnauthorized, createSession(t, "Loko", "Tr0ub4dor&3").Code)
+	assert.Equal(t, http.StatusCreated, createSession(t, "Loko", "n3w-Secret").Code)
+
+	w = serveWithSession(t, userID, http.MethodDelete, pathV1Me, "")
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serveWithSession(t, userID, http.MethodGet, pathV1Me, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	assert.Equal(t, http.StatusUnauthorized, createSession(t, "Loko", "n3w-Secret").Code)
+}
+
+func TestV1Secret(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	userID := createV1User(t, "Loko", "Tr0ub4dor&3")
+
+	w := serveWithSession(t, userID, http.MethodGet, pathV1Secret, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w = serveWithSession(t, userID, http.MethodPut, pathV1Secret, `{"secret":"in the garden"}`)
+	require.Equal(t, http.StatusNoContent, w.Code)
+
+	w = serveWithSession(t, userID, http.MethodGet, pathV1Secret, "")
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var secret Secret
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&secret))
+	assert.Equal(t, "in the garden", secret.Secret)
+
+	// legacy route reads the same secret
+	w = serveWithSession(t, userID, http.MethodGet, pathMain, "")
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "in the garden")
+}
+
+func TestV1Unauthenticated(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	value, errEnc := a.cookies.Encode(source.MarkCookieUser, "ended-session", time.Now().Add(time.Hour))
+	require.NoError(t, errEnc)
+
+	for _, cookie := range []*http.Cookie{nil, {Name: source.MarkCookieUser, Value: value}} {
+		req := httptest.NewRequest(http.MethodGet, pathV1Me, nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		// API answers 401 without redirect to login page
+		require.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get("Location"))
+		assert.Equal(t, CodeUnauthorized, decodeProblem(t, w).Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, pathMain, nil)
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+	assert.Equal(t, pathLogin, w.Header().Get("Location"))
+}
+
+func TestProfileChangeEndsSession(t *testing.T) {
+	errStart := startBaseAndServAndClient()
+	require.NoError(t, errStart)
+	defer srv.Close()
+
+	userID := createV1User(t, "Loko", "Tr0ub4dor&3")
+
+	for _, change := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{http.MethodPut, pathUserID, `{"direct":3,"change_login":{"login":"Loko2"}}`, http.StatusCreated},
+		{http.MethodPatch, pathV1Me, `{"login":"Loko3"}`, http.StatusOK},
+	} {
+		w := serveWithSession(t, userID, change.method, change.path, change.body)
+		require.Equal(t, change.status, w.Code, change.path)
+
+		// legacy route and /api/v1 end the session of change and remove its cookie
+		sessions, errList := a.sessions.List(context.Background(), userID)
+		require.NoError(t, errList)
+		assert.Empty(t, sessions, change.path)
+
+		var cleaned bool
+		for _, c := range w.Result().Cookies() {
+			if c.Name == source.MarkCookieUser && c.MaxAge < 0 {
+				cleaned = true
+			}
+		}
+		assert.True(t, cleaned, change.path)
+	}
+}
@@ -0,0 +1,350 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/app"
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// Config - settings of application which are not connection to DB,
+// empty fields get default values in NewConfig
+type Config struct {
+	// PasswordHasher - "argon2id" (default) or "bcrypt"
+	PasswordHasher string `json:"password_hasher,omitempty"`
+	// SessionStore - "sql" (default, tables sessions and refresh_tokens of DB from connectData.json) or "memory",
+	// with "memory" driver of DB sessions and refresh tokens are always in memory
+	SessionStore string `json:"session_store,omitempty"`
+	// JanitorInterval - period of removing expired sessions, "5m" by default
+	JanitorInterval Duration `json:"janitor_interval,omitempty"`
+	// DebugAddr - address of admin listener with GET /debug/vars (expvar), without authorization,
+	// so only a private address, e.g. "127.0.0.1:8001". Empty (default) - no admin listener
+	DebugAddr string `json:"debug_addr,omitempty"`
+	// SessionIdleTimeout - session ends without activity of user, "60m" by default
+	SessionIdleTimeout Duration `json:"session_idle_timeout,omitempty"`
+	// SessionAbsoluteLifetime - session ends after login despite activity, "12h" by default
+	SessionAbsoluteLifetime Duration `json:"session_absolute_lifetime,omitempty"`
+	// CookieKeys - keys of cookies, the first one signs new cookies, the others are only accepted,
+	// without keys a random key is used and cookies are lost on restart
+	CookieKeys []source.CookieKey `json:"cookie_keys,omitempty"`
+	// CookieEncrypt - values of cookies are encrypted by AES-GCM, every key needs "block"
+	CookieEncrypt bool `json:"cookie_encrypt,omitempty"`
+	// CookieInsecure - cookies without Secure attribute, only for development over http
+	CookieInsecure bool `json:"cookie_insecure,omitempty"`
+	// JWTKeys - keys of access tokens ("HS256" or "EdDSA"), the first one signs,
+	// without keys a random HS256 key is used and tokens are lost on restart
+	JWTKeys []source.JWTKey `json:"jwt_keys,omitempty"`
+	// JWTIssuer - claim "iss" of access tokens, "bellerophon" by default
+	JWTIssuer string `json:"jwt_issuer,omitempty"`
+	// TOTPIssuer - name of service in authenticator app, JWTIssuer by default
+	TOTPIssuer string `json:"totp_issuer,omitempty"`
+	// AccessTokenLifetime - "15m" by default
+	AccessTokenLifetime Duration `json:"access_token_lifetime,omitempty"`
+	// RefreshTokenLifetime - lifetime of every refresh token after rotation, "720h" by default
+	RefreshTokenLifetime Duration `json:"refresh_token_lifetime,omitempty"`
+	// LoginAttemptsStore - "sql" (default, table login_attempts) or "memory" (counters of one instance),
+	// with "memory" driver of DB counters are always in memory
+	LoginAttemptsStore string `json:"login_attempts_store,omitempty"`
+	// LoginThrottle - limits of failed logins of one login, IPThrottle - of one IP
+	LoginThrottle Throttle `json:"login_throttle,omitempty"`
+	IPThrottle    Throttle `json:"ip_throttle,omitempty"`
+	// SignUpResponse - "explicit" (default, 409 for taken login or email) or "private"
+	// (202 with the same answer for new and taken data, existing emails are not shown)
+	SignUpResponse string `json:"signup_response,omitempty"`
+	// PasswordPolicy - rules of new passwords, empty fields get values of source.DefaultPasswordPolicy
+	PasswordPolicy PasswordPolicy `json:"password_policy,omitempty"`
+	// PrehashMode - passwords hashed by client ("hashed": 100): "deprecated" (default, accepted with headers
+	// Deprecation and Sunset), "allow" or "reject"
+	PrehashMode string `json:"prehash_mode,omitempty"`
+	// PrehashDeprecation - date of header Deprecation, RFC 3339, start of application by default
+	PrehashDeprecation time.Time `json:"prehash_deprecation,omitempty"`
+	// PrehashSunset - since this time "deprecated" mode rejects passwords hashed by client, RFC 3339
+	PrehashSunset time.Time `json:"prehash_sunset,omitempty"`
+	// RateLimitStore - "memory" (default, buckets of one instance) or "sql" (table rate_limits, shared by instances)
+	RateLimitStore string `json:"rate_limit_store,omitempty"`
+	// RateLimits - limits of routes "signup", "main", "ownid", "account", route from config replaces default limits of route
+	RateLimits map[string]RouteRateLimits `json:"rate_limits,omitempty"`
+}
+
+// PasswordPolicy - "min_length", "max_length" and "min_classes" (of lower, upper, digit, other) are checked
+// only for passwords sent without hashing, the list of breached passwords - for all
+type PasswordPolicy struct {
+	MinLength  int `json:"min_length,omitempty"`
+	MaxLength  int `json:"max_length,omitempty"`
+	MinClasses int `json:"min_classes,omitempty"`
+	// AllowPersonal - password may contain login, name or email
+	AllowPersonal bool `json:"allow_personal,omitempty"`
+	// AllowBreached - password may be in the bundled list of common and breached passwords
+	AllowBreached bool `json:"allow_breached,omitempty"`
+}
+
+// Policy - rules for app.WithPasswordPolicy
+func (p PasswordPolicy) Policy() source.PasswordPolicy {
+	return source.PasswordPolicy{
+		MinLength:      p.MinLength,
+		MaxLength:      p.MaxLength,
+		MinClasses:     p.MinClasses,
+		RejectPersonal: !p.AllowPersonal,
+		RejectBreached: !p.AllowBreached,
+	}
+}
+
+// RouteRateLimits - limits of route for every IP and for every authorized user
+type RouteRateLimits struct {
+	IP   RateLimit `json:"ip,omitempty"`
+	User RateLimit `json:"user,omitempty"`
+}
+
+// RateLimit - "requests" per "per" on average, up to "burst" at once ("requests" by default),
+// without "requests" - no limit
+type RateLimit struct {
+	Requests int      `json:"requests,omitempty"`
+	Per      Duration `json:"per,omitempty"`
+	Burst    int      `json:"burst,omitempty"`
+}
+
+func (l RateLimit) limit() source.RateLimit {
+	return source.RateLimit{Requests: l.Requests, Per: l.Per.Duration, Burst: l.Burst}
+}
+
+// RouteLimits - limits for app.WithRateLimits, source.DefaultRateLimits for routes absent in RateLimits
+func (c *Config) RouteLimits() map[string]source.RouteLimits {
+	limits := make(map[string]source.RouteLimits)
+
+	for route, l := range source.DefaultRateLimits {
+		limits[route] = l
+	}
+	for route, l := range c.RateLimits {
+		limits[route] = source.RouteLimits{IP: l.IP.limit(), User: l.User.limit()}
+	}
+
+	return limits
+}
+
+// Throttle - limits of failed logins, empty fields get values of source.DefaultLoginPolicy
+// (source.DefaultIPPolicy for IPThrottle)
+type Throttle struct {
+	// FreeFailures - failures without delay
+	FreeFailures int `json:"free_failures,omitempty"`
+	// BaseDelay - delay after the first failure over FreeFailures, doubled by every next one up to MaxDelay
+	BaseDelay Duration `json:"base_delay,omitempty"`
+	MaxDelay  Duration `json:"max_delay,omitempty"`
+	// MaxFailures - failures until lockout for Lockout
+	MaxFailures int      `json:"max_failures,omitempty"`
+	Lockout     Duration `json:"lockout,omitempty"`
+	// Window - failures are forgotten after Window without failures
+	Window Duration `json:"window,omitempty"`
+}
+
+// Policy - limits for app.WithLoginThrottle
+func (t Throttle) Policy() source.LoginPolicy {
+	return source.LoginPolicy{
+		FreeFailures: t.FreeFailures,
+		BaseDelay:    t.BaseDelay.Duration,
+		MaxDelay:     t.MaxDelay.Duration,
+		MaxFailures:  t.MaxFailures,
+		Lockout:      t.Lockout.Duration,
+		Window:       t.Window.Duration,
+	}
+}
+
+func (t *Throttle) defaults(p source.LoginPolicy) {
+	if t.FreeFailures <= 0 {
+		t.FreeFailures = p.FreeFailures
+	}
+	if t.BaseDelay.Duration <= 0 {
+		t.BaseDelay.Duration = p.BaseDelay
+	}
+	if t.MaxDelay.Duration <= 0 {
+		t.MaxDelay.Duration = p.MaxDelay
+	}
+	if t.MaxFailures <= 0 {
+		t.MaxFailures = p.MaxFailures
+	}
+	if t.Lockout.Duration <= 0 {
+		t.Lockout.Duration = p.Lockout
+	}
+	if t.Window.Duration <= 0 {
+		t.Window.Duration = p.Window
+	}
+}
+
+// Duration - time.Duration written in json as string "90s", "5m", "1h30m"
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var line string
+	if err := json.Unmarshal(data, &line); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(line)
+	if err != nil {
+		return err
+	}
+
+	d.Duration = parsed
+
+	return nil
+}
+
+// kinds of session_store, login_attempts_store and rate_limit_store
+const (
+	StoreSql    = "sql"
+	StoreMemory = "memory"
+)
+
+func NewConfig(fileName string) (*Config, error) {
+	configData, errData := os.Open(fileName)
+	if errData != nil {
+		return nil, errData
+	}
+	defer configData.Close()
+
+	dec := json.NewDecoder(configData)
+	dec.DisallowUnknownFields()
+
+	var conf Config
+	errDec := dec.Decode(&conf)
+	if errDec != nil {
+		return nil, errDec
+	}
+
+	conf.defaults()
+
+	if conf.SessionStore != StoreSql && conf.SessionStore != StoreMemory {
+		return nil, fmt.Errorf("unknown session_store - %s", conf.SessionStore)
+	}
+	if conf.LoginAttemptsStore != StoreSql && conf.LoginAttemptsStore != StoreMemory {
+		return nil, fmt.Errorf("unknown login_attempts_store - %s", conf.LoginAttemptsStore)
+	}
+	if conf.SignUpResponse != app.SignUpExplicit && conf.SignUpResponse != app.SignUpPrivate {
+		return nil, fmt.Errorf("unknown signup_response - %s", conf.SignUpResponse)
+	}
+	if conf.PrehashMode != app.PrehashAllow && conf.PrehashMode != app.PrehashDeprecated && conf.PrehashMode != app.PrehashReject {
+		return nil, fmt.Errorf("unknown prehash_mode - %s", conf.PrehashMode)
+	}
+	if conf.RateLimitStore != StoreSql && conf.RateLimitStore != StoreMemory {
+		return nil, fmt.Errorf("unknown rate_limit_store - %s", conf.RateLimitStore)
+	}
+	for route, l := range conf.RateLimits {
+		if _, ex := source.DefaultRateLimits[route]; !ex {
+			return nil, fmt.Errorf("unknown route of rate_limits - %s", route)
+		}
+		for _, rl := range []RateLimit{l.IP, l.User} {
+			if rl.Requests > 0 && rl.Per.Duration > 0 && rl.Per.Duration < time.Duration(rl.Requests) {
+				return nil, fmt.Errorf("rate_limits of %s - %d requests per %s, less than 1ns for request", route, rl.Requests, rl.Per)
+			}
+		}
+	}
+
+	return &conf, nil
+}
+
+// CookieCodec - codec by CookieKeys, CookieEncrypt and CookieInsecure
+func (c *Config) CookieCodec() (*source.CookieCodec, error) {
+	keys := c.CookieKeys
+
+	if len(keys) == 0 {
+		k, errKey := source.NewCookieKey("random")
+		if errKey != nil {
+			return nil, errKey
+		}
+
+		keys = []source.CookieKey{k}
+	}
+
+	codec, errCodec := source.NewCookieCodec(keys, c.CookieEncrypt)
+	if errCodec != nil {
+		return nil, errCodec
+	}
+
+	codec.Secure = !c.CookieInsecure
+
+	return codec, nil
+}
+
+func (c *Config) defaults() {
+	if c.PasswordHasher == "" {
+		c.PasswordHasher = source.HasherArgon2id
+	}
+	if c.SessionStore == "" {
+		c.SessionStore = StoreSql
+	}
+	if c.JanitorInterval.Duration <= 0 {
+		c.JanitorInterval.Duration = 5 * time.Minute
+	}
+	if c.SessionIdleTimeout.Duration <= 0 {
+		c.SessionIdleTimeout.Duration = 60 * time.Minute
+	}
+	if c.SessionAbsoluteLifetime.Duration <= 0 {
+		c.SessionAbsoluteLifetime.Duration = 12 * time.Hour
+	}
+	if c.JWTIssuer == "" {
+		c.JWTIssuer = "bellerophon"
+	}
+	if c.TOTPIssuer == "" {
+		c.TOTPIssuer = c.JWTIssuer
+	}
+	if c.AccessTokenLifetime.Duration <= 0 {
+		c.AccessTokenLifetime.Duration = 15 * time.Minute
+	}
+	if c.RefreshTokenLifetime.Duration <= 0 {
+		c.RefreshTokenLifetime.Duration = 30 * 24 * time.Hour
+	}
+	if c.LoginAttemptsStore == "" {
+		c.LoginAttemptsStore = StoreSql
+	}
+	c.LoginThrottle.defaults(source.DefaultLoginPolicy)
+	c.IPThrottle.defaults(source.DefaultIPPolicy)
+	if c.PasswordPolicy.MinLength <= 0 {
+		c.PasswordPolicy.MinLength = source.DefaultPasswordPolicy.MinLength
+	}
+	if c.PasswordPolicy.MaxLength <= 0 {
+		c.PasswordPolicy.MaxLength = source.DefaultPasswordPolicy.MaxLength
+	}
+	if c.PasswordPolicy.MinClasses <= 0 {
+		c.PasswordPolicy.MinClasses = source.DefaultPasswordPolicy.MinClasses
+	}
+	if c.PrehashMode == "" {
+		c.PrehashMode = app.PrehashDeprecated
+	}
+	if c.SignUpResponse == "" {
+		c.SignUpResponse = app.SignUpExplicit
+	}
+	if c.RateLimitStore == "" {
+		c.RateLimitStore = StoreMemory
+	}
+}
+
+// JWTSigner - signer by JWTKeys and JWTIssuer
+func (c *Config) JWTSigner() (*source.JWTSigner, error) {
+	keys := c.JWTKeys
+
+	if len(keys) == 0 {
+		k, errKey := source.NewJWTKey("random", source.AlgHS256)
+		if errKey != nil {
+			return nil, errKey
+		}
+
+		keys = []source.JWTKey{k}
+	}
+
+	signer, errSigner := source.NewJWTSigner(keys)
+	if errSigner != nil {
+		return nil, errSigner
+	}
+
+	signer.Issuer = c.JWTIssuer
+
+	return signer, nil
+}
@@ -4,9 +4,20 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"strings"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSqlite   = "sqlite"
+	DriverMemory   = "memory"
 )
 
 type Connect struct {
+	// Driver - "postgres" (default), "sqlite" or "memory", the last one keeps data in memory of process
+	Driver string `json:"driver,omitempty"`
+	// DSN - data source name as is, for "sqlite" it is a path to the file, for "postgres" - replaces fields below
+	DSN          string `json:"dsn,omitempty"`
 	Host         string `json:"host"`
 	Port         string `json:"port"`
 	User         string `json:"user"`
@@ -25,6 +36,24 @@ sslmode=%s`,
 		c.Sslmode)
 }
 
+func (c Connect) DataSourceName() string {
+	if c.DSN == "" {
+		return c.String()
+	}
+
+	// SQLite checks REFERENCES only with foreign_keys pragma on every connection
+	if c.Driver == DriverSqlite && !strings.Contains(c.DSN, "foreign_keys") {
+		sep := "?"
+		if strings.Contains(c.DSN, "?") {
+			sep = "&"
+		}
+
+		return c.DSN + sep + "_pragma=foreign_keys(1)"
+	}
+
+	return c.DSN
+}
+
 func NewConnect(fileName string) (*Connect, error) {
 	connectData, errData := os.Open(fileName)
 	if errData != nil {
@@ -39,5 +68,19 @@ func NewConnect(fileName string) (*Connect, error) {
 		return nil, errDec
 	}
 
+	if conn.Driver == "" {
+		conn.Driver = DriverPostgres
+	}
+
+	switch conn.Driver {
+	case DriverPostgres, DriverMemory:
+	case DriverSqlite:
+		if conn.DSN == "" {
+			return nil, fmt.Errorf("driver %s - no dsn, path to the file of DB", conn.Driver)
+		}
+	default:
+		return nil, fmt.Errorf("unknown driver - %s", conn.Driver)
+	}
+
 	return &conn, nil
 }
@@ -0,0 +1,258 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed migrations
+var migrations embed.FS
+
+var (
+	ErrNoDialect   = errors.New("migrate: no migrations for driver")
+	ErrNothingDown = errors.New("migrate: no applied migrations")
+)
+
+// Migration - pair of files <version>_<name>.up.sql and <version>_<name>.down.sql
+type Migration struct {
+	Version int
+	Name    string
+	up      string
+	down    string
+}
+
+// State - Migration and the time it was applied, empty AppliedAt - migration is pending
+type State struct {
+	Migration
+	AppliedAt string
+}
+
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New - driver is the name of sql driver: "postgres" or "sqlite"
+func New(db *sql.DB, driver string) (*Migrator, error) {
+	list, err := load(driver)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{db: db, migrations: list}, nil
+}
+
+// Latest - version of the last embedded migration
+func (m *Migrator) Latest() int {
+	if len(m.migrations) == 0 {
+		return 0
+	}
+
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version - version of the last applied migration, 0 - nothing applied
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	if err := m.init(ctx); err != nil {
+		return 0, err
+	}
+
+	var version sql.NullInt64
+
+	err := m.db.QueryRowContext(ctx, `SELECT max(version) FROM schema_migrations;`).Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(version.Int64), nil
+}
+
+// Up - applies all pending migrations, returns applied ones
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := []Migration{}
+
+	for _, mig := range m.migrations {
+		if mig.Version <= current {
+			continue
+		}
+
+		err = m.apply(ctx, mig.up, `INSERT INTO schema_migrations (version) VALUES ($1);`, mig.Version)
+		if err != nil {
+			return applied, fmt.Errorf("migrate: up %04d_%s - %w", mig.Version, mig.Name, err)
+		}
+
+		applied = append(applied, mig)
+	}
+
+	return applied, nil
+}
+
+// Down - rolls back the last applied migration
+func (m *Migrator) Down(ctx context.Context) (Migration, error) {
+	current, err := m.Version(ctx)
+	if err != nil {
+		return Migration{}, err
+	}
+	if current == 0 {
+		return Migration{}, ErrNothingDown
+	}
+
+	for _, mig := range m.migrations {
+		if mig.Version != current {
+			continue
+		}
+
+		err = m.apply(ctx, mig.down, `DELETE FROM schema_migrations WHERE version = $1;`, mig.Version)
+		if err != nil {
+			return Migration{}, fmt.Errorf("migrate: down %04d_%s - %w", mig.Version, mig.Name, err)
+		}
+
+		return mig, nil
+	}
+
+	return Migration{}, fmt.Errorf("migrate: applied version %d is unknown to this binary", current)
+}
+
+// Status - every embedded migration with time of applying
+func (m *Migrator) Status(ctx context.Context) ([]State, error) {
+	if err := m.init(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.QueryContext(ctx, `SELECT version, applied_at FROM schema_migrations;`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	appliedAt := make(map[int]string)
+
+	for rows.Next() {
+		version := 0
+		at := ""
+		if err = rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+
+		appliedAt[version] = at
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	states := make([]State, 0, len(m.migrations))
+	for _, mig := range m.migrations {
+		states = append(states, State{Migration: mig, AppliedAt: appliedAt[mig.Version]})
+	}
+
+	return states, nil
+}
+
+func (m *Migrator) init(ctx context.Context) error {
+	_, err := m.db.ExecContext(ctx, `
+CREATE TABLE IF NOT EXISTS schema_migrations
+(
+    version    BIGINT PRIMARY KEY,
+    applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);`)
+
+	return err
+}
+
+// apply - runs script and bookkeeping query in one transaction
+func (m *Migrator) apply(ctx context.Context, script, query string, version int) error {
+	tx, err := m.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, script); err == nil {
+		_, err = tx.ExecContext(ctx, query, version)
+	}
+	if err != nil {
+		errBack := tx.Rollback()
+		if errBack != nil {
+			return fmt.Errorf("first error - %w, second error -%w", err, errBack)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func load(driver string) ([]Migration, error) {
+	dir := path.Join("migrations", driver)
+
+	entries, err := fs.ReadDir(migrations, dir)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrNoDialect, driver)
+	}
+
+	byVersion := make(map[int]*Migration)
+
+	for _, e := range entries {
+		name := e.Name()
+
+		direction := ""
+		switch {
+		case strings.HasSuffix(name, ".up.sql"):
+			direction = "up"
+		case strings.HasSuffix(name, ".down.sql"):
+			direction = "down"
+		default:
+			continue
+		}
+
+		base := strings.TrimSuffix(name, "."+direction+".sql")
+		num, title, _ := strings.Cut(base, "_")
+
+		version, errNum := strconv.Atoi(num)
+		if errNum != nil {
+			return nil, fmt.Errorf("migrate: bad file name %s - %w", name, errNum)
+		}
+
+		data, errRead := fs.ReadFile(migrations, path.Join(dir, name))
+		if errRead != nil {
+			return nil, errRead
+		}
+
+		mig, ex := byVersion[version]
+		if !ex {
+			mig = &Migration{Version: version, Name: title}
+			byVersion[version] = mig
+		}
+
+		if direction == "up" {
+			mig.up = string(data)
+		} else {
+			mig.down = string(data)
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.up == "" || mig.down == "" {
+			return nil, fmt.Errorf("migrate: %04d_%s needs up and down files", mig.Version, mig.Name)
+		}
+
+		list = append(list, *mig)
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+
+	return list, nil
+}
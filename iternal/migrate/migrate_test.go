@@ -0,0 +1,85 @@
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	_ "modernc.org/sqlite"
+	"path/filepath"
+	"testing"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+func openLite(t *testing.T) *sql.DB {
+	db, errDB := sql.Open("sqlite", filepath.Join(t.TempDir(), "migrate.db")+"?_pragma=foreign_keys(1)")
+	require.NoError(t, errDB)
+
+	return db
+}
+
+func TestLatestIsSchemaVersion(t *testing.T) {
+	for _, driver := range []string{"postgres", "sqlite"} {
+		m, errMig := New(nil, driver)
+		require.NoError(t, errMig)
+
+		assert.Equal(t, source.SchemaVersion, m.Latest(), driver)
+	}
+
+	_, errMig := New(nil, "memory")
+	assert.ErrorIs(t, errMig, ErrNoDialect)
+}
+
+func TestUpStatusDown(t *testing.T) {
+	db := openLite(t)
+	defer db.Close()
+
+	ctx := context.Background()
+
+	m, errMig := New(db, "sqlite")
+	require.NoError(t, errMig)
+
+	version, errVer := m.Version(ctx)
+	require.NoError(t, errVer)
+	assert.Zero(t, version)
+
+	applied, errUp := m.Up(ctx)
+	require.NoError(t, errUp)
+	assert.Len(t, applied, len(m.migrations))
+
+	version, errVer = m.Version(ctx)
+	require.NoError(t, errVer)
+	assert.Equal(t, m.Latest(), version)
+
+	// second up is a no-op
+	applied, errUp = m.Up(ctx)
+	require.NoError(t, errUp)
+	assert.Empty(t, applied)
+
+	states, errStatus := m.Status(ctx)
+	require.NoError(t, errStatus)
+	for _, st := range states {
+		assert.NotEmpty(t, st.AppliedAt)
+	}
+
+	_, errExec := db.ExecContext(ctx, `INSERT INTO users (login, hashed_password, name, email) VALUES ('a', 'b', 'c', 'd');`)
+	require.NoError(t, errExec)
+
+	for range m.migrations {
+		_, errDown := m.Down(ctx)
+		require.NoError(t, errDown)
+	}
+
+	_, errDown := m.Down(ctx)
+	assert.ErrorIs(t, errDown, ErrNothingDown)
+
+	_, errExec = db.ExecContext(ctx, `SELECT id FROM users;`)
+	assert.Error(t, errExec)
+
+	states, errStatus = m.Status(ctx)
+	require.NoError(t, errStatus)
+	for _, st := range states {
+		assert.Empty(t, st.AppliedAt)
+	}
+}
@@ -0,0 +1,2 @@
+drop table if exists public.info;
+drop table if exists public.users;
@@ -0,0 +1,20 @@
+create table if not exists public.users
+(
+    id              bigint generated always as identity
+        primary key,
+    login           varchar(200) not null
+        unique,
+    hashed_password varchar(200) not null,
+    name            varchar(200) not null,
+    surname         varchar(200),
+    email           varchar(200) not null
+        unique
+);
+
+create table if not exists public.info
+(
+    id     bigint not null
+        unique
+        references public.users,
+    secret text
+);
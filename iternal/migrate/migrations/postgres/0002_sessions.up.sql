@@ -0,0 +1,14 @@
+create table if not exists public.sessions
+(
+    id         varchar(64) not null
+        primary key,
+    user_id    bigint      not null
+        references public.users
+            on delete cascade,
+    created_at timestamptz not null,
+    expires_at timestamptz not null,
+    user_agent text        not null default '',
+    ip         varchar(64) not null default ''
+);
+
+create index if not exists sessions_user_id_idx on public.sessions (user_id);
@@ -0,0 +1,15 @@
+create table if not exists public.refresh_tokens
+(
+    id         varchar(64) not null
+        primary key,
+    family_id  varchar(64) not null,
+    user_id    bigint      not null
+        references public.users
+            on delete cascade,
+    created_at timestamptz not null,
+    expires_at timestamptz not null,
+    used_at    timestamptz
+);
+
+create index if not exists refresh_tokens_family_id_idx on public.refresh_tokens (family_id);
+create index if not exists refresh_tokens_user_id_idx on public.refresh_tokens (user_id);
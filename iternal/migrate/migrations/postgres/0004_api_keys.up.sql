@@ -0,0 +1,15 @@
+create table if not exists public.api_keys
+(
+    id         varchar(32) not null
+        primary key,
+    user_id    bigint      not null
+        references public.users
+            on delete cascade,
+    name       text        not null,
+    hash       varchar(64) not null,
+    scopes     text        not null,
+    created_at timestamptz not null,
+    expires_at timestamptz
+);
+
+create index if not exists api_keys_user_id_idx on public.api_keys (user_id);
@@ -0,0 +1,19 @@
+create table if not exists public.mfa
+(
+    user_id   bigint      not null
+        primary key
+        references public.users
+            on delete cascade,
+    secret    varchar(64) not null,
+    confirmed boolean     not null default false,
+    last_step bigint      not null default 0
+);
+
+create table if not exists public.mfa_recovery_codes
+(
+    user_id bigint      not null
+        references public.users
+            on delete cascade,
+    hash    varchar(64) not null,
+    primary key (user_id, hash)
+);
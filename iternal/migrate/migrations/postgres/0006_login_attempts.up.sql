@@ -0,0 +1,9 @@
+create table if not exists public.login_attempts
+(
+    id           varchar(320) not null
+        primary key,
+    failures     integer      not null,
+    last_failure timestamptz  not null
+);
+
+create index if not exists login_attempts_last_failure_idx on public.login_attempts (last_failure);
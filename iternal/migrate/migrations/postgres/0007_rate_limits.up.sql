@@ -0,0 +1,8 @@
+create table if not exists public.rate_limits
+(
+    id  varchar(400) not null
+        primary key,
+    tat bigint       not null
+);
+
+create index if not exists rate_limits_tat_idx on public.rate_limits (tat);
@@ -0,0 +1,2 @@
+drop table if exists info;
+drop table if exists users;
@@ -0,0 +1,19 @@
+create table if not exists users
+(
+    id              integer primary key autoincrement,
+    login           varchar(200) not null
+        unique,
+    hashed_password varchar(200) not null,
+    name            varchar(200) not null,
+    surname         varchar(200),
+    email           varchar(200) not null
+        unique
+);
+
+create table if not exists info
+(
+    id     integer not null
+        unique
+        references users (id),
+    secret text
+);
@@ -0,0 +1,14 @@
+create table if not exists sessions
+(
+    id         varchar(64) not null
+        primary key,
+    user_id    integer     not null
+        references users (id)
+            on delete cascade,
+    created_at timestamp   not null,
+    expires_at timestamp   not null,
+    user_agent text        not null default '',
+    ip         varchar(64) not null default ''
+);
+
+create index if not exists sessions_user_id_idx on sessions (user_id);
@@ -0,0 +1,15 @@
+create table if not exists refresh_tokens
+(
+    id         varchar(64) not null
+        primary key,
+    family_id  varchar(64) not null,
+    user_id    integer     not null
+        references users (id)
+            on delete cascade,
+    created_at timestamp   not null,
+    expires_at timestamp   not null,
+    used_at    timestamp
+);
+
+create index if not exists refresh_tokens_family_id_idx on refresh_tokens (family_id);
+create index if not exists refresh_tokens_user_id_idx on refresh_tokens (user_id);
@@ -0,0 +1,15 @@
+create table if not exists api_keys
+(
+    id         varchar(32) not null
+        primary key,
+    user_id    integer     not null
+        references users (id)
+            on delete cascade,
+    name       text        not null,
+    hash       varchar(64) not null,
+    scopes     text        not null,
+    created_at timestamp   not null,
+    expires_at timestamp
+);
+
+create index if not exists api_keys_user_id_idx on api_keys (user_id);
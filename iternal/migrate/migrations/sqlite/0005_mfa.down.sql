@@ -0,0 +1,2 @@
+drop table if exists mfa_recovery_codes;
+drop table if exists mfa;
@@ -0,0 +1,19 @@
+create table if not exists mfa
+(
+    user_id   integer     not null
+        primary key
+        references users (id)
+            on delete cascade,
+    secret    varchar(64) not null,
+    confirmed boolean     not null default false,
+    last_step integer     not null default 0
+);
+
+create table if not exists mfa_recovery_codes
+(
+    user_id integer     not null
+        references users (id)
+            on delete cascade,
+    hash    varchar(64) not null,
+    primary key (user_id, hash)
+);
@@ -0,0 +1,9 @@
+create table if not exists login_attempts
+(
+    id           varchar(320) not null
+        primary key,
+    failures     integer      not null,
+    last_failure timestamp    not null
+);
+
+create index if not exists login_attempts_last_failure_idx on login_attempts (last_failure);
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+var (
+	// ErrInvalidCredentials - the same error for unknown login and wrong password
+	ErrInvalidCredentials = errors.New("invalid login or password")
+	// ErrTaken - login or email belongs to other user, ErrLoginTaken and ErrEmailTaken are ErrTaken
+	ErrTaken      = errors.New("login or email is already taken")
+	ErrLoginTaken = &subError{msg: "login is already taken", parent: ErrTaken}
+	ErrEmailTaken = &subError{msg: "email is already taken", parent: ErrTaken}
+	// ErrConflict - concurrent change of the same data, request can be repeated
+	ErrConflict = errors.New("concurrent change, repeat request")
+	// ErrUnavailable - storage does not answer
+	ErrUnavailable = errors.New("service is unavailable, try later")
+	// ErrUserNotFound - no user with id
+	ErrUserNotFound = errors.New("user not found")
+	ErrNoSecret     = errors.New("no secret")
+)
+
+// errors of input, every one is ValidationError
+var (
+	ErrEmptyLogin    = &ValidationError{Field: "login", Msg: "empty login"}
+	ErrEmptyPassword = &ValidationError{Field: "password", Msg: "empty password"}
+	ErrPasswordsDiff = &ValidationError{Field: "password", Msg: "passwords not rqual"}
+	ErrEmptyName     = &ValidationError{Field: "first_name", Msg: "empty name"}
+	ErrEmptyEmail    = &ValidationError{Field: "email", Msg: "empty emal"}
+	ErrNoChanges     = &ValidationError{Msg: "no fields to change"}
+	ErrInvalidData   = &ValidationError{Msg: "value is too long or not allowed"}
+)
+
+// subError - sentinel error with own text, which is also parent
+type subError struct {
+	msg    string
+	parent error
+}
+
+func (e *subError) Error() string {
+	return e.msg
+}
+
+func (e *subError) Unwrap() error {
+	return e.parent
+}
+
+// ValidationError - input can't be accepted as is, Field is empty when error is about the whole input
+type ValidationError struct {
+	Field string
+	Msg   string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Msg
+}
+
+func invalid(err error) error {
+	return &ValidationError{Msg: err.Error()}
+}
+
+// PolicyError - new password breaks source.PasswordPolicy
+type PolicyError struct {
+	Violations []source.PasswordViolation
+}
+
+func (e *PolicyError) Error() string {
+	return "password does not fit policy"
+}
+
+// storeError - domain error for error of source.Store, other errors are wrapped as is
+func storeError(op string, err error) error {
+	switch {
+	case errors.Is(err, source.ErrNotFound):
+		return ErrUserNotFound
+	case errors.Is(err, source.ErrDuplicateLogin):
+		return ErrLoginTaken
+	case errors.Is(err, source.ErrDuplicateEmail):
+		return ErrEmailTaken
+	case errors.Is(err, source.ErrDuplicate):
+		return ErrTaken
+	case errors.Is(err, source.ErrConflict):
+		return ErrConflict
+	case errors.Is(err, source.ErrInvalidData):
+		return ErrInvalidData
+	case errors.Is(err, source.ErrUnavailable):
+		return ErrUnavailable
+	}
+
+	return &InternalError{Op: op, Err: err}
+}
+
+// InternalError - failure of storage or hasher, text is for logs, not for clients
+type InternalError struct {
+	Op  string
+	Err error
+}
+
+func (e *InternalError) Error() string {
+	return e.Op + ": " + e.Err.Error()
+}
+
+func (e *InternalError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,383 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"strconv"
+	"sync"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// Revoker - store of sessions, refresh tokens or API keys of user
+type Revoker interface {
+	RevokeAllForUser(ctx context.Context, userID int) error
+}
+
+// SessionRevoker - store of sessions, one session or all sessions of user
+type SessionRevoker interface {
+	Revoker
+	Revoke(ctx context.Context, sessionID string) error
+}
+
+// MFADisabler - store of second factor of user
+type MFADisabler interface {
+	Disable(ctx context.Context, userID int) error
+}
+
+// Service - rules of users without transport: validation, policy and hashing of passwords,
+// credentials, end of sessions after change of profile, new password and delete.
+// Errors are ValidationError, PolicyError, InternalError or sentinel errors of package
+type Service struct {
+	store    source.Store
+	hasher   source.PasswordHasher
+	policy   source.PasswordPolicy
+	sessions SessionRevoker
+	refresh  Revoker
+	apiKeys  Revoker
+	mfa      MFADisabler
+	// dummyHash - hash of random password, verified for unknown login, so Authenticate takes the same time
+	dummyHash string
+	dummyOnce *sync.Once
+}
+
+type Option func(s *Service)
+
+// WithHasher - replaces default argon2id hasher
+func WithHasher(h source.PasswordHasher) Option {
+	return func(s *Service) {
+		s.hasher = h
+		s.dummyOnce = new(sync.Once)
+	}
+}
+
+func WithPasswordPolicy(p source.PasswordPolicy) Option {
+	return func(s *Service) {
+		s.policy = p
+	}
+}
+
+// WithSessions - session of change is revoked after change of profile, all sessions of user -
+// after new password and delete
+func WithSessions(r SessionRevoker) Option {
+	return func(s *Service) {
+		s.sessions = r
+	}
+}
+
+// WithRefreshTokens - refresh tokens of user are revoked after new password and delete
+func WithRefreshTokens(r Revoker) Option {
+	return func(s *Service) {
+		s.refresh = r
+	}
+}
+
+// WithAPIKeys - API keys of user are revoked after delete, only SQL tables remove them by cascade
+func WithAPIKeys(r Revoker) Option {
+	return func(s *Service) {
+		s.apiKeys = r
+	}
+}
+
+// WithMFA - TOTP secret and recovery codes of user are removed after delete
+func WithMFA(m MFADisabler) Option {
+	return func(s *Service) {
+		s.mfa = m
+	}
+}
+
+func New(store source.Store, opts ...Option) *Service {
+	s := &Service{
+		store:     store,
+		hasher:    source.NewArgon2idHasher(),
+		policy:    source.DefaultPasswordPolicy,
+		dummyOnce: new(sync.Once),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ProfilePatch - nil field is not changed
+type ProfilePatch struct {
+	Login   *string
+	Name    *string
+	Surname *string
+	Email   *string
+}
+
+// RegisterUser - new user of UserCreate, password is checked by policy and sealed by hasher
+func (s *Service) RegisterUser(ctx context.Context, u source.UserSourceData) (int, error) {
+	if u.Direct != source.UserCreate {
+		return 0, invalid(source.IncorrectDirectUserStruct)
+	}
+
+	if errPolicy := s.CheckPassword(u.ChangePassword, u.Login, u.Name, u.Surname, u.Email); errPolicy != nil {
+		return 0, errPolicy
+	}
+
+	if errSeal := u.SealPassword(s.hasher); errSeal != nil {
+		return 0, invalid(errSeal)
+	}
+
+	id, errCreate := s.store.UserCreate(ctx, &u)
+	if errCreate != nil {
+		return 0, storeError("create user", errCreate)
+	}
+
+	return id, nil
+}
+
+// Authenticate - user by login and password of UserConnect, ErrInvalidCredentials for unknown login and wrong password,
+// legacy or outdated hash is replaced after success
+func (s *Service) Authenticate(ctx context.Context, u source.UserSourceData) (source.User, error) {
+	if u.Direct != source.UserConnect {
+		return source.User{}, invalid(source.IncorrectDirectUserStruct)
+	}
+
+	if errHash := u.HashPassword(); errHash != nil {
+		return source.User{}, invalid(errHash)
+	}
+
+	user, errUser := s.store.UserLogin(ctx, &u)
+	if errors.Is(errUser, source.ErrNotFound) {
+		// the same work as for existing user
+		_, _, _ = s.hasher.Verify(u.PasswordOne, s.dummyPasswordHash())
+
+		return source.User{}, ErrInvalidCredentials
+	}
+	if errUser != nil {
+		return source.User{}, &InternalError{Op: "find login", Err: errUser}
+	}
+
+	match, rehash, errVerify := s.hasher.Verify(u.PasswordOne, user.HashPassword)
+	if errVerify != nil {
+		return source.User{}, &InternalError{Op: "verify password of user id=" + strconv.Itoa(user.ID), Err: errVerify}
+	}
+	if !match {
+		return source.User{}, ErrInvalidCredentials
+	}
+	if rehash {
+		s.rehashPassword(ctx, user.ID, u.ChangePassword)
+	}
+
+	return user, nil
+}
+
+// CheckPassword - PolicyError if password breaks policy, personal - login, name, email of user
+func (s *Service) CheckPassword(c source.ChangePassword, personal ...string) error {
+	if violations := s.policy.Check(c, personal...); len(violations) > 0 {
+		return &PolicyError{Violations: violations}
+	}
+
+	return nil
+}
+
+func (s *Service) Profile(ctx context.Context, userID int) (source.User, error) {
+	user, errUser := s.store.UserData(ctx, strconv.Itoa(userID))
+	if errUser != nil {
+		return source.User{}, storeError("read user", errUser)
+	}
+
+	return user, nil
+}
+
+// UpdateProfile - changes fields of patch by one write, so taken login or email changes nothing,
+// empty login, name or email is rejected before any change, then session of change (sessionID,
+// empty for tokens and API keys) ends. Returns user after changes
+func (s *Service) UpdateProfile(ctx context.Context, userID int, sessionID string, patch ProfilePatch) (source.User, error) {
+	if errPatch := patch.validate(); errPatch != nil {
+		return source.User{}, errPatch
+	}
+
+	user, errUser := s.Profile(ctx, userID)
+	if errUser != nil {
+		return source.User{}, errUser
+	}
+
+	if patch.Login != nil {
+		user.Login = *patch.Login
+	}
+	if patch.Name != nil {
+		user.Name = *patch.Name
+	}
+	if patch.Surname != nil {
+		user.Surname = *patch.Surname
+	}
+	if patch.Email != nil {
+		user.Email = *patch.Email
+	}
+
+	u := source.UserSourceData{
+		ID:          userID,
+		ChangeLogin: source.ChangeLogin{Login: user.Login},
+		ChangeName:  source.ChangeName{Name: user.Name, Surname: user.Surname},
+		ChangeEmail: source.ChangeEmail{Email: user.Email},
+	}
+	if errUpdate := s.store.UserDataProfileUpdate(ctx, &u); errUpdate != nil {
+		return source.User{}, storeError("update profile", errUpdate)
+	}
+
+	s.endSession(ctx, userID, sessionID)
+
+	return s.Profile(ctx, userID)
+}
+
+// ChangePassword - new password by policy, then all sessions and refresh tokens of user are revoked
+func (s *Service) ChangePassword(ctx context.Context, userID int, c source.ChangePassword) error {
+	if len(c.PasswordOne) < 1 {
+		return ErrEmptyPassword
+	}
+	if c.PasswordOne != c.PasswordTwo {
+		return ErrPasswordsDiff
+	}
+
+	user, errUser := s.Profile(ctx, userID)
+	if errUser != nil {
+		return errUser
+	}
+	if errPolicy := s.CheckPassword(c, user.Login, user.Name, user.Surname, user.Email); errPolicy != nil {
+		return errPolicy
+	}
+
+	if errSeal := c.SealPassword(s.hasher); errSeal != nil {
+		return invalid(errSeal)
+	}
+
+	u := source.UserSourceData{ID: userID, ChangePassword: c}
+	if errUpdate := s.store.UserDataPasswordUpdate(ctx, &u); errUpdate != nil {
+		return storeError("update password", errUpdate)
+	}
+
+	s.revokeAll(ctx, userID)
+
+	return nil
+}
+
+// DeleteAccount - removes user with secret, then all sessions, refresh tokens, API keys and 2FA of user
+func (s *Service) DeleteAccount(ctx context.Context, userID int) error {
+	if errDelete := s.store.UserDataDelete(ctx, strconv.Itoa(userID)); errDelete != nil {
+		return storeError("delete user", errDelete)
+	}
+
+	s.revokeAll(ctx, userID)
+
+	var errKeys, errMFA error
+	if s.apiKeys != nil {
+		errKeys = s.apiKeys.RevokeAllForUser(ctx, userID)
+	}
+	if s.mfa != nil {
+		errMFA = s.mfa.Disable(ctx, userID)
+	}
+
+	if errDrop := errors.Join(errKeys, errMFA); errDrop != nil {
+		log.Printf("drop API keys and 2FA of user id=%d - %v", userID, errDrop)
+	}
+
+	return nil
+}
+
+// Secret - ErrNoSecret if user has no secret
+func (s *Service) Secret(ctx context.Context, userID int) (string, error) {
+	secret, errInfo := s.store.InfoByID(ctx, strconv.Itoa(userID))
+	if errors.Is(errInfo, source.ErrNotFound) {
+		return "", ErrNoSecret
+	}
+	if errInfo != nil {
+		return "", storeError("read secret", errInfo)
+	}
+
+	return secret, nil
+}
+
+func (s *Service) UpdateSecret(ctx context.Context, userID int, secret string) error {
+	if errInfo := s.store.InfoChangeByID(ctx, strconv.Itoa(userID), secret); errInfo != nil {
+		return storeError("update secret", errInfo)
+	}
+
+	return nil
+}
+
+// endSession - after change of profile user logs in by new data, error is only logged: change is already done
+func (s *Service) endSession(ctx context.Context, userID int, sessionID string) {
+	if s.sessions == nil || sessionID == "" {
+		return
+	}
+
+	if errRevoke := s.sessions.Revoke(ctx, sessionID); errRevoke != nil {
+		log.Printf("revoke session of user id=%d - %v", userID, errRevoke)
+	}
+}
+
+// revokeAll - user can't be left logged in by old password, error is only logged: change is already done
+func (s *Service) revokeAll(ctx context.Context, userID int) {
+	var errSessions, errRefresh error
+	if s.sessions != nil {
+		errSessions = s.sessions.RevokeAllForUser(ctx, userID)
+	}
+	if s.refresh != nil {
+		errRefresh = s.refresh.RevokeAllForUser(ctx, userID)
+	}
+
+	if errRevoke := errors.Join(errSessions, errRefresh); errRevoke != nil {
+		log.Printf("revoke sessions of user id=%d - %v", userID, errRevoke)
+	}
+}
+
+// dummyPasswordHash - hash of random password by hasher, made once on the first use
+func (s *Service) dummyPasswordHash() string {
+	s.dummyOnce.Do(func() {
+		password := make([]byte, 32)
+		if _, errRand := rand.Read(password); errRand != nil {
+			log.Printf("dummy password hash - %v", errRand)
+
+			return
+		}
+
+		hash, errHash := s.hasher.Hash(hex.EncodeToString(password))
+		if errHash != nil {
+			log.Printf("dummy password hash - %v", errHash)
+
+			return
+		}
+
+		s.dummyHash = hash
+	})
+
+	return s.dummyHash
+}
+
+// rehashPassword - replaces legacy or outdated hash after successful login, login does not fail on error
+func (s *Service) rehashPassword(ctx context.Context, id int, c source.ChangePassword) {
+	if errSeal := c.SealPassword(s.hasher); errSeal != nil {
+		log.Printf("rehash password of user id=%d - %v", id, errSeal)
+
+		return
+	}
+
+	u := source.UserSourceData{ID: id, ChangePassword: c}
+	if errUpdate := s.store.UserDataPasswordUpdate(ctx, &u); errUpdate != nil {
+		log.Printf("rehash password of user id=%d - %v", id, errUpdate)
+	}
+}
+
+func (p ProfilePatch) validate() error {
+	switch {
+	case p.Login == nil && p.Name == nil && p.Surname == nil && p.Email == nil:
+		return ErrNoChanges
+	case p.Login != nil && len(*p.Login) < 1:
+		return ErrEmptyLogin
+	case p.Name != nil && len(*p.Name) < 1:
+		return ErrEmptyName
+	case p.Email != nil && len(*p.Email) < 1:
+		return ErrEmptyEmail
+	}
+
+	return nil
+}
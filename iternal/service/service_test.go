@@ -0,0 +1,190 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+
+	"github.com/Ekvo/bellerophon/iternal/source"
+)
+
+// countingRevoker - users whose sessions were revoked and revoked single sessions
+type countingRevoker struct {
+	users    []int
+	sessions []string
+}
+
+func (r *countingRevoker) Revoke(_ context.Context, sessionID string) error {
+	r.sessions = append(r.sessions, sessionID)
+
+	return nil
+}
+
+func (r *countingRevoker) RevokeAllForUser(_ context.Context, userID int) error {
+	r.users = append(r.users, userID)
+
+	return nil
+}
+
+func newUser(login, password string) source.UserSourceData {
+	return source.UserSourceData{
+		Direct:         source.UserCreate,
+		ChangeLogin:    source.ChangeLogin{Login: login},
+		ChangePassword: source.ChangePassword{Hashed: source.NoHashed, PasswordOne: password, PasswordTwo: password},
+		ChangeName:     source.ChangeName{Name: "Pavel"},
+		ChangeEmail:    source.ChangeEmail{Email: login + "@example.com"},
+	}
+}
+
+func connect(login, password string) source.UserSourceData {
+	return source.UserSourceData{
+		Direct:         source.UserConnect,
+		ChangeLogin:    source.ChangeLogin{Login: login},
+		ChangePassword: source.ChangePassword{Hashed: source.NoHashed, PasswordOne: password, PasswordTwo: password},
+	}
+}
+
+func TestRegisterAndAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	s := New(source.NewMemorySource())
+
+	_, errWrong := s.RegisterUser(ctx, connect("Loko", "Tr0ub4dor&3"))
+	var errValid *ValidationError
+	assert.ErrorAs(t, errWrong, &errValid)
+
+	_, errPolicy := s.RegisterUser(ctx, newUser("Loko", "loko2024"))
+	var errRejected *PolicyError
+	require.ErrorAs(t, errPolicy, &errRejected)
+	assert.Equal(t, source.ViolationPersonal, errRejected.Violations[0].Code)
+
+	id, errRegister := s.RegisterUser(ctx, newUser("Loko", "Tr0ub4dor&3"))
+	require.NoError(t, errRegister)
+
+	_, errTaken := s.RegisterUser(ctx, newUser("Loko", "Tr0ub4dor&3"))
+	assert.ErrorIs(t, errTaken, ErrTaken)
+	assert.ErrorIs(t, errTaken, ErrLoginTaken)
+
+	user, errAuth := s.Authenticate(ctx, connect("Loko", "Tr0ub4dor&3"))
+	require.NoError(t, errAuth)
+	assert.Equal(t, id, user.ID)
+
+	_, errAuth = s.Authenticate(ctx, connect("Loko", "wrong-password"))
+	assert.ErrorIs(t, errAuth, ErrInvalidCredentials)
+
+	_, errAuth = s.Authenticate(ctx, connect("Nobody", "Tr0ub4dor&3"))
+	assert.ErrorIs(t, errAuth, ErrInvalidCredentials)
+}
+
+func TestChangePasswordAndDeleteRevoke(t *testing.T) {
+	ctx := context.Background()
+	sessions, refresh := &countingRevoker{}, &countingRevoker{}
+	s := New(source.NewMemorySource(), WithSessions(sessions), WithRefreshTokens(refresh))
+
+	id, errRegister := s.RegisterUser(ctx, newUser("Loko", "Tr0ub4dor&3"))
+	require.NoError(t, errRegister)
+
+	assert.ErrorIs(t, s.ChangePassword(ctx, id, source.ChangePassword{Hashed: source.NoHashed}), ErrEmptyPassword)
+	assert.ErrorIs(t, s.ChangePassword(ctx, id, source.ChangePassword{Hashed: source.NoHashed, PasswordOne: "a", PasswordTwo: "b"}), ErrPasswordsDiff)
+	assert.Empty(t, sessions.users)
+
+	errChange := s.ChangePassword(ctx, id, source.ChangePassword{Hashed: source.NoHashed, PasswordOne: "n3w-Secret", PasswordTwo: "n3w-Secret"})
+	require.NoError(t, errChange)
+	assert.Equal(t, []int{id}, sessions.users)
+	assert.Equal(t, []int{id}, refresh.users)
+
+	_, errAuth := s.Authenticate(ctx, connect("Loko", "n3w-Secret"))
+	assert.NoError(t, errAuth)
+
+	require.NoError(t, s.DeleteAccount(ctx, id))
+	assert.Equal(t, []int{id, id}, sessions.users)
+
+	_, errProfile := s.Profile(ctx, id)
+	assert.ErrorIs(t, errProfile, ErrUserNotFound)
+}
+
+func TestUpdateProfileAndSecret(t *testing.T) {
+	ctx := context.Background()
+	sessions := &countingRevoker{}
+	s := New(source.NewMemorySource(), WithSessions(sessions))
+
+	id, errRegister := s.RegisterUser(ctx, newUser("Loko", "Tr0ub4dor&3"))
+	require.NoError(t, errRegister)
+
+	_, errOther := s.RegisterUser(ctx, newUser("Other", "Tr0ub4dor&3"))
+	require.NoError(t, errOther)
+
+	login, empty, surname := "Loko2", "", "Petrov"
+
+	_, errPatch := s.UpdateProfile(ctx, id, "s1", ProfilePatch{})
+	assert.ErrorIs(t, errPatch, ErrNoChanges)
+
+	_, errPatch = s.UpdateProfile(ctx, id, "s1", ProfilePatch{Login: &login, Name: &empty})
+	assert.ErrorIs(t, errPatch, ErrEmptyName)
+
+	assert.Empty(t, sessions.sessions)
+
+	user, errPatch := s.UpdateProfile(ctx, id, "s1", ProfilePatch{Surname: &surname})
+	require.NoError(t, errPatch)
+	assert.Equal(t, "Pavel", user.Name)
+	assert.Equal(t, "Petrov", user.Surname)
+	assert.Equal(t, "Loko", user.Login)
+
+	// only the session of change ends, not all of user, without session (token, API key) nothing ends
+	assert.Equal(t, []string{"s1"}, sessions.sessions)
+	assert.Empty(t, sessions.users)
+
+	_, errPatch = s.UpdateProfile(ctx, id, "", ProfilePatch{Surname: &surname})
+	require.NoError(t, errPatch)
+	assert.Equal(t, []string{"s1"}, sessions.sessions)
+
+	other := "Other"
+	_, errPatch = s.UpdateProfile(ctx, id, "s2", ProfilePatch{Login: &other})
+	assert.ErrorIs(t, errPatch, ErrLoginTaken)
+	assert.Equal(t, []string{"s1"}, sessions.sessions)
+
+	// patch is written at once, taken email keeps the old login
+	email := "Other@example.com"
+	_, errPatch = s.UpdateProfile(ctx, id, "s3", ProfilePatch{Login: &login, Email: &email})
+	assert.ErrorIs(t, errPatch, ErrEmailTaken)
+
+	user, errProfile := s.Profile(ctx, id)
+	require.NoError(t, errProfile)
+	assert.Equal(t, "Loko", user.Login)
+	assert.Equal(t, "Loko@example.com", user.Email)
+
+	_, errSecret := s.Secret(ctx, id)
+	assert.ErrorIs(t, errSecret, ErrNoSecret)
+
+	require.NoError(t, s.UpdateSecret(ctx, id, "in the garden"))
+
+	secret, errSecret := s.Secret(ctx, id)
+	require.NoError(t, errSecret)
+	assert.Equal(t, "in the garden", secret)
+}
+
+func TestDeleteAccountDropsKeysAndMFA(t *testing.T) {
+	ctx := context.Background()
+	keys, mfa := source.NewMemoryAPIKeys(), source.NewMemoryMFA()
+	s := New(source.NewMemorySource(), WithAPIKeys(keys), WithMFA(mfa))
+
+	id, errRegister := s.RegisterUser(ctx, newUser("Loko", "Tr0ub4dor&3"))
+	require.NoError(t, errRegister)
+
+	_, key, errKey := source.NewAPIKey(id, "ci", []string{source.ScopeSecretRead}, time.Now(), nil)
+	require.NoError(t, errKey)
+	require.NoError(t, keys.Create(ctx, key))
+
+	require.NoError(t, mfa.Enroll(ctx, id, "JBSWY3DPEHPK3PXP"))
+	require.NoError(t, mfa.Confirm(ctx, id, 1, []string{source.RecoveryCodeHash("abcd-efgh")}))
+
+	require.NoError(t, s.DeleteAccount(ctx, id))
+
+	_, errGet := keys.Get(ctx, key.ID)
+	assert.ErrorIs(t, errGet, source.ErrNotFound)
+
+	_, errMFA := mfa.Get(ctx, id)
+	assert.ErrorIs(t, errMFA, source.ErrNotFound)
+	assert.ErrorIs(t, mfa.UseRecoveryCode(ctx, id, source.RecoveryCodeHash("abcd-efgh")), source.ErrNotFound)
+}
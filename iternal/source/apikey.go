@@ -0,0 +1,323 @@
+package source
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeyPrefix - begin of every API key, "bk_<id>_<secret>"
+const APIKeyPrefix = "bk_"
+
+const (
+	ScopeSecretRead   = "secret:read"
+	ScopeSecretWrite  = "secret:write"
+	ScopeProfileRead  = "profile:read"
+	ScopeProfileWrite = "profile:write"
+)
+
+// Scopes - scopes which can be given to API key
+var Scopes = []string{ScopeSecretRead, ScopeSecretWrite, ScopeProfileRead, ScopeProfileWrite}
+
+var (
+	ErrAPIKeyInvalid = errors.New("api key: invalid")
+	ErrAPIKeyExpired = errors.New("api key: expired")
+	ErrUnknownScope  = errors.New("api key: unknown scope")
+)
+
+// APIKey - named key of user for automation, only HashData of secret part is stored,
+// key without ExpiresAt does not expire
+type APIKey struct {
+	ID        string     `json:"id"`
+	UserID    int        `json:"-"`
+	Name      string     `json:"name"`
+	Hash      string     `json:"-"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// NewAPIKey - key for user (shown once) and its record
+func NewAPIKey(userID int, name string, scopes []string, createdAt time.Time, expiresAt *time.Time) (string, APIKey, error) {
+	for _, scope := range scopes {
+		if !HasScope(Scopes, scope) {
+			return "", APIKey{}, fmt.Errorf("%w - %s", ErrUnknownScope, scope)
+		}
+	}
+
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return "", APIKey{}, err
+	}
+
+	// "_" is not in hex, so the first "_" after prefix always ends id
+	id := hex.EncodeToString(buf)
+
+	secret, errSecret := randomToken()
+	if errSecret != nil {
+		return "", APIKey{}, errSecret
+	}
+
+	k := APIKey{
+		ID:        id,
+		UserID:    userID,
+		Name:      name,
+		Hash:      HashData(secret),
+		Scopes:    scopes,
+		CreatedAt: createdAt,
+		ExpiresAt: expiresAt,
+	}
+
+	return APIKeyPrefix + id + "_" + secret, k, nil
+}
+
+// ParseAPIKey - id and secret of key, ErrAPIKeyInvalid for wrong format
+func ParseAPIKey(key string) (id string, secret string, err error) {
+	rest, ok := strings.CutPrefix(key, APIKeyPrefix)
+	if !ok {
+		return "", "", ErrAPIKeyInvalid
+	}
+
+	id, secret, ok = strings.Cut(rest, "_")
+	if !ok || id == "" || secret == "" {
+		return "", "", ErrAPIKeyInvalid
+	}
+
+	return id, secret, nil
+}
+
+// Verify - secret belongs to key and key is not expired at now
+func (k APIKey) Verify(secret string, now time.Time) error {
+	if subtle.ConstantTimeCompare([]byte(k.Hash), []byte(HashData(secret))) != 1 {
+		return ErrAPIKeyInvalid
+	}
+	if k.ExpiresAt != nil && !k.ExpiresAt.After(now) {
+		return ErrAPIKeyExpired
+	}
+
+	return nil
+}
+
+func HasScope(scopes []string, scope string) bool {
+	for _, s := range scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// APIKeyStore - storage of API keys, safe for concurrent use
+type APIKeyStore interface {
+	Create(ctx context.Context, k APIKey) error
+	// Get - ErrNotFound if there is no key
+	Get(ctx context.Context, id string) (APIKey, error)
+	// List - keys of user, oldest first
+	List(ctx context.Context, userID int) ([]APIKey, error)
+	// Revoke - ErrNotFound if user has no key with id
+	Revoke(ctx context.Context, userID int, id string) error
+	// RevokeAllForUser - removes every key of user, for delete of user
+	RevokeAllForUser(ctx context.Context, userID int) error
+}
+
+var (
+	_ APIKeyStore = (*MemoryAPIKeys)(nil)
+	_ APIKeyStore = (*SqlAPIKeys)(nil)
+)
+
+type MemoryAPIKeys struct {
+	mu   sync.RWMutex
+	keys map[string]APIKey
+}
+
+func NewMemoryAPIKeys() *MemoryAPIKeys {
+	return &MemoryAPIKeys{keys: make(map[string]APIKey)}
+}
+
+func (m *MemoryAPIKeys) Create(_ context.Context, k APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ex := m.keys[k.ID]; ex {
+		return ErrDuplicate
+	}
+
+	m.keys[k.ID] = k
+
+	return nil
+}
+
+func (m *MemoryAPIKeys) Get(_ context.Context, id string) (APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	k, ex := m.keys[id]
+	if !ex {
+		return APIKey{}, ErrNotFound
+	}
+
+	return k, nil
+}
+
+func (m *MemoryAPIKeys) List(_ context.Context, userID int) ([]APIKey, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []APIKey{}
+	for _, k := range m.keys {
+		if k.UserID == userID {
+			list = append(list, k)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+	return list, nil
+}
+
+func (m *MemoryAPIKeys) Revoke(_ context.Context, userID int, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k, ex := m.keys[id]
+	if !ex || k.UserID != userID {
+		return ErrNotFound
+	}
+
+	delete(m.keys, id)
+
+	return nil
+}
+
+func (m *MemoryAPIKeys) RevokeAllForUser(_ context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, k := range m.keys {
+		if k.UserID == userID {
+			delete(m.keys, id)
+		}
+	}
+
+	return nil
+}
+
+// SqlAPIKeys - API keys in table of DB, scopes are kept as one line separated by spaces
+type SqlAPIKeys struct {
+	source *sql.DB
+}
+
+func NewSqlAPIKeys(source *sql.DB) *SqlAPIKeys {
+	return &SqlAPIKeys{source: source}
+}
+
+func (s *SqlAPIKeys) Create(ctx context.Context, k APIKey) error {
+	var expiresAt sql.NullTime
+	if k.ExpiresAt != nil {
+		expiresAt = sql.NullTime{Time: k.ExpiresAt.UTC(), Valid: true}
+	}
+
+	_, err := s.source.ExecContext(ctx, `
+INSERT INTO api_keys (id,
+                      user_id,
+                      name,
+                      hash,
+                      scopes,
+                      created_at,
+                      expires_at)
+VALUES ($1,$2,$3,$4,$5,$6,$7);`,
+		k.ID, k.UserID, k.Name, k.Hash, strings.Join(k.Scopes, " "), k.CreatedAt.UTC(), expiresAt)
+
+	return sqlError(err)
+}
+
+func (s *SqlAPIKeys) Get(ctx context.Context, id string) (APIKey, error) {
+	row := s.source.QueryRowContext(ctx, `
+SELECT id,
+       user_id,
+       name,
+       hash,
+       scopes,
+       created_at,
+       expires_at
+FROM api_keys
+WHERE id = $1;`, id)
+
+	k, err := scanAPIKey(row)
+	if err != nil {
+		return APIKey{}, sqlError(err)
+	}
+
+	return k, nil
+}
+
+func (s *SqlAPIKeys) List(ctx context.Context, userID int) ([]APIKey, error) {
+	rows, err := s.source.QueryContext(ctx, `
+SELECT id,
+       user_id,
+       name,
+       hash,
+       scopes,
+       created_at,
+       expires_at
+FROM api_keys
+WHERE user_id = $1
+ORDER BY created_at;`, userID)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+
+	list := []APIKey{}
+	for rows.Next() {
+		k, errScan := scanAPIKey(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		list = append(list, k)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *SqlAPIKeys) Revoke(ctx context.Context, userID int, id string) error {
+	res, err := s.source.ExecContext(ctx, `DELETE FROM api_keys WHERE id = $1 AND user_id = $2;`, id, userID)
+
+	return affected(res, err)
+}
+
+func (s *SqlAPIKeys) RevokeAllForUser(ctx context.Context, userID int) error {
+	_, err := s.source.ExecContext(ctx, `DELETE FROM api_keys WHERE user_id = $1;`, userID)
+
+	return sqlError(err)
+}
+
+func scanAPIKey(row interface{ Scan(dest ...any) error }) (APIKey, error) {
+	var (
+		k         APIKey
+		scopes    string
+		expiresAt sql.NullTime
+	)
+
+	err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Hash, &scopes, &k.CreatedAt, &expiresAt)
+	if err != nil {
+		return APIKey{}, err
+	}
+
+	k.Scopes = strings.Fields(scopes)
+	if expiresAt.Valid {
+		k.ExpiresAt = &expiresAt.Time
+	}
+
+	return k, nil
+}
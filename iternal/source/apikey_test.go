@@ -0,0 +1,102 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// forEachAPIKeyStore - runs the same test on every APIKeyStore with Store of the same backend
+func forEachAPIKeyStore(t *testing.T, test func(t *testing.T, store Store, keys APIKeyStore)) {
+	forEachBackend(t, func(t *testing.T, db *sql.DB, store Store) {
+		var keys APIKeyStore = NewMemoryAPIKeys()
+		if db != nil {
+			keys = NewSqlAPIKeys(db)
+		}
+
+		test(t, store, keys)
+	})
+}
+
+func TestNewAPIKeyParseVerify(t *testing.T) {
+	now := time.Now()
+	expires := now.Add(time.Hour)
+
+	key, k, errKey := NewAPIKey(1, "ci", []string{ScopeSecretRead}, now, &expires)
+	require.NoError(t, errKey)
+
+	id, secret, errParse := ParseAPIKey(key)
+	require.NoError(t, errParse)
+	assert.Equal(t, k.ID, id)
+	assert.NotEqual(t, secret, k.Hash)
+
+	require.NoError(t, k.Verify(secret, now))
+	assert.ErrorIs(t, k.Verify(secret+"x", now), ErrAPIKeyInvalid)
+	assert.ErrorIs(t, k.Verify(secret, expires), ErrAPIKeyExpired)
+
+	for _, bad := range []string{"", "bk_", "bk__secret", "bk_id_", "xx_" + id + "_" + secret} {
+		_, _, errParse = ParseAPIKey(bad)
+		assert.ErrorIs(t, errParse, ErrAPIKeyInvalid, bad)
+	}
+
+	_, _, errKey = NewAPIKey(1, "ci", []string{"admin"}, now, nil)
+	assert.ErrorIs(t, errKey, ErrUnknownScope)
+}
+
+func TestAPIKeyStore(t *testing.T) {
+	forEachAPIKeyStore(t, func(t *testing.T, store Store, keys APIKeyStore) {
+		ctx := context.Background()
+
+		id, errCreate := store.UserCreate(ctx, NewUser())
+		require.NoError(t, errCreate)
+		defer store.UserDataDelete(ctx, strconv.Itoa(id))
+
+		now := time.Now().Truncate(time.Second)
+		expires := now.Add(24 * time.Hour)
+
+		_, first, errKey := NewAPIKey(id, "read", []string{ScopeSecretRead, ScopeProfileRead}, now, &expires)
+		require.NoError(t, errKey)
+		require.NoError(t, keys.Create(ctx, first))
+		assert.ErrorIs(t, keys.Create(ctx, first), ErrDuplicate)
+
+		_, second, errKey := NewAPIKey(id, "write", []string{ScopeSecretWrite}, now.Add(time.Second), nil)
+		require.NoError(t, errKey)
+		require.NoError(t, keys.Create(ctx, second))
+
+		got, errGet := keys.Get(ctx, first.ID)
+		require.NoError(t, errGet)
+		assert.Equal(t, first.Name, got.Name)
+		assert.Equal(t, first.Hash, got.Hash)
+		assert.Equal(t, first.Scopes, got.Scopes)
+		require.NotNil(t, got.ExpiresAt)
+		assert.True(t, expires.Equal(*got.ExpiresAt))
+
+		got, errGet = keys.Get(ctx, second.ID)
+		require.NoError(t, errGet)
+		assert.Nil(t, got.ExpiresAt)
+
+		list, errList := keys.List(ctx, id)
+		require.NoError(t, errList)
+		require.Len(t, list, 2)
+		assert.Equal(t, first.ID, list[0].ID)
+		assert.Equal(t, second.ID, list[1].ID)
+
+		// key of other user
+		assert.ErrorIs(t, keys.Revoke(ctx, id+1, first.ID), ErrNotFound)
+
+		require.NoError(t, keys.Revoke(ctx, id, first.ID))
+		assert.ErrorIs(t, keys.Revoke(ctx, id, first.ID), ErrNotFound)
+
+		_, errGet = keys.Get(ctx, first.ID)
+		assert.ErrorIs(t, errGet, ErrNotFound)
+
+		require.NoError(t, keys.RevokeAllForUser(ctx, id))
+		list, errList = keys.List(ctx, id)
+		require.NoError(t, errList)
+		assert.Empty(t, list)
+	})
+}
@@ -0,0 +1,262 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// Attempt - failed logins of one key ("login:<login>", "ip:<ip>")
+type Attempt struct {
+	Key         string
+	Failures    int
+	LastFailure time.Time
+}
+
+// LoginPolicy - limits of failed logins of one key,
+// after FreeFailures every failure delays the next attempt by BaseDelay doubled up to MaxDelay,
+// after MaxFailures the key is locked for Lockout, failures are forgotten after Window without failures
+type LoginPolicy struct {
+	FreeFailures int
+	BaseDelay    time.Duration
+	MaxDelay     time.Duration
+	MaxFailures  int
+	Lockout      time.Duration
+	Window       time.Duration
+}
+
+var (
+	// DefaultLoginPolicy - limits of one login
+	DefaultLoginPolicy = LoginPolicy{
+		FreeFailures: 3,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		MaxFailures:  10,
+		Lockout:      15 * time.Minute,
+		Window:       time.Hour,
+	}
+	// DefaultIPPolicy - limits of one IP, many users can be behind one address
+	DefaultIPPolicy = LoginPolicy{
+		FreeFailures: 20,
+		BaseDelay:    time.Second,
+		MaxDelay:     time.Minute,
+		MaxFailures:  100,
+		Lockout:      15 * time.Minute,
+		Window:       time.Hour,
+	}
+)
+
+// Locked - key has MaxFailures failures
+func (p LoginPolicy) Locked(at Attempt) bool {
+	return p.MaxFailures > 0 && at.Failures >= p.MaxFailures
+}
+
+// BlockedUntil - next attempt of key is rejected before this time, zero time if it is not
+func (p LoginPolicy) BlockedUntil(at Attempt) time.Time {
+	if p.Locked(at) {
+		return at.LastFailure.Add(p.Lockout)
+	}
+
+	over := at.Failures - p.FreeFailures
+	if over <= 0 || p.BaseDelay <= 0 {
+		return time.Time{}
+	}
+
+	delay := p.BaseDelay
+	for i := 1; i < over && (p.MaxDelay <= 0 || delay < p.MaxDelay); i++ {
+		delay *= 2
+	}
+	if p.MaxDelay > 0 && delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+
+	return at.LastFailure.Add(delay)
+}
+
+// AttemptStore - counters of failed logins, safe for concurrent use
+type AttemptStore interface {
+	// Get - ErrNotFound if key has no failures
+	Get(ctx context.Context, key string) (Attempt, error)
+	// Fail - adds failure at time at, failures before since are forgotten
+	Fail(ctx context.Context, key string, at, since time.Time) (Attempt, error)
+	// Reset - removes failures of key
+	Reset(ctx context.Context, key string) error
+	// Forgive - removes one failure of key, counted before check of password which then succeeded or was rejected,
+	// time of last failure stays
+	Forgive(ctx context.Context, key string) error
+	// DeleteBefore - removes keys without failures since before, returns their number
+	DeleteBefore(ctx context.Context, before time.Time) (int, error)
+}
+
+var (
+	_ AttemptStore = (*MemoryAttempts)(nil)
+	_ AttemptStore = (*SqlAttempts)(nil)
+)
+
+type MemoryAttempts struct {
+	mu       sync.Mutex
+	attempts map[string]Attempt
+}
+
+func NewMemoryAttempts() *MemoryAttempts {
+	return &MemoryAttempts{attempts: make(map[string]Attempt)}
+}
+
+func (m *MemoryAttempts) Get(_ context.Context, key string) (Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	at, ex := m.attempts[key]
+	if !ex {
+		return Attempt{}, ErrNotFound
+	}
+
+	return at, nil
+}
+
+func (m *MemoryAttempts) Fail(_ context.Context, key string, at, since time.Time) (Attempt, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a := m.attempts[key]
+	if a.LastFailure.Before(since) {
+		a.Failures = 0
+	}
+
+	a.Key = key
+	a.Failures++
+	a.LastFailure = at
+	m.attempts[key] = a
+
+	return a, nil
+}
+
+func (m *MemoryAttempts) Reset(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.attempts, key)
+
+	return nil
+}
+
+func (m *MemoryAttempts) Forgive(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	a, ex := m.attempts[key]
+	if !ex {
+		return nil
+	}
+
+	if a.Failures <= 1 {
+		delete(m.attempts, key)
+
+		return nil
+	}
+
+	a.Failures--
+	m.attempts[key] = a
+
+	return nil
+}
+
+func (m *MemoryAttempts) DeleteBefore(_ context.Context, before time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for key, at := range m.attempts {
+		if at.LastFailure.Before(before) {
+			delete(m.attempts, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// SqlAttempts - failed logins in table login_attempts of DB
+type SqlAttempts struct {
+	source *sql.DB
+}
+
+func NewSqlAttempts(source *sql.DB) *SqlAttempts {
+	return &SqlAttempts{source: source}
+}
+
+func (s *SqlAttempts) Get(ctx context.Context, key string) (Attempt, error) {
+	at := Attempt{Key: key}
+
+	err := s.source.QueryRowContext(ctx, `
+SELECT failures,
+       last_failure
+FROM login_attempts
+WHERE id = $1;`, key).Scan(&at.Failures, &at.LastFailure)
+	if err != nil {
+		return Attempt{}, sqlError(err)
+	}
+
+	return at, nil
+}
+
+func (s *SqlAttempts) Fail(ctx context.Context, key string, at, since time.Time) (Attempt, error) {
+	a := Attempt{Key: key}
+
+	// one statement, so concurrent failures are not lost
+	err := s.source.QueryRowContext(ctx, `
+INSERT INTO login_attempts (id,
+                            failures,
+                            last_failure)
+VALUES ($1,1,$2)
+ON CONFLICT (id) DO UPDATE
+    SET failures     = CASE
+                           WHEN login_attempts.last_failure < $3 THEN 1
+                           ELSE login_attempts.failures + 1
+        END,
+        last_failure = excluded.last_failure
+RETURNING failures, last_failure;`, key, at.UTC(), since.UTC()).Scan(&a.Failures, &a.LastFailure)
+	if err != nil {
+		return Attempt{}, sqlError(err)
+	}
+
+	return a, nil
+}
+
+func (s *SqlAttempts) Reset(ctx context.Context, key string) error {
+	_, err := s.source.ExecContext(ctx, `DELETE FROM login_attempts WHERE id = $1;`, key)
+
+	return sqlError(err)
+}
+
+func (s *SqlAttempts) Forgive(ctx context.Context, key string) error {
+	tx, errTx := s.source.BeginTx(ctx, nil)
+	if errTx != nil {
+		return sqlError(errTx)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `UPDATE login_attempts SET failures = failures - 1 WHERE id = $1;`, key); err != nil {
+		return sqlError(err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM login_attempts WHERE id = $1 AND failures <= 0;`, key); err != nil {
+		return sqlError(err)
+	}
+
+	return sqlError(tx.Commit())
+}
+
+func (s *SqlAttempts) DeleteBefore(ctx context.Context, before time.Time) (int, error) {
+	res, err := s.source.ExecContext(ctx, `DELETE FROM login_attempts WHERE last_failure < $1;`, before.UTC())
+	if err != nil {
+		return 0, sqlError(err)
+	}
+
+	n, errRows := res.RowsAffected()
+	if errRows != nil {
+		return 0, errRows
+	}
+
+	return int(n), nil
+}
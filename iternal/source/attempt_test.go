@@ -0,0 +1,123 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// forEachAttemptStore - runs the same test on every AttemptStore
+func forEachAttemptStore(t *testing.T, test func(t *testing.T, attempts AttemptStore)) {
+	forEachBackend(t, func(t *testing.T, db *sql.DB, _ Store) {
+		var attempts AttemptStore = NewMemoryAttempts()
+		if db != nil {
+			attempts = NewSqlAttempts(db)
+		}
+
+		test(t, attempts)
+	})
+}
+
+func TestAttemptStore(t *testing.T) {
+	forEachAttemptStore(t, func(t *testing.T, attempts AttemptStore) {
+		ctx := context.Background()
+
+		key := fmt.Sprintf("login:test-%d", time.Now().UnixNano())
+		defer attempts.Reset(ctx, key)
+
+		now := time.Now().Truncate(time.Second)
+
+		_, errGet := attempts.Get(ctx, key)
+		assert.ErrorIs(t, errGet, ErrNotFound)
+
+		for i := 1; i <= 3; i++ {
+			at, errFail := attempts.Fail(ctx, key, now, now.Add(-time.Hour))
+			require.NoError(t, errFail)
+			assert.Equal(t, i, at.Failures)
+		}
+
+		at, errGet := attempts.Get(ctx, key)
+		require.NoError(t, errGet)
+		assert.Equal(t, 3, at.Failures)
+		assert.True(t, now.Equal(at.LastFailure))
+
+		// old failures are forgotten
+		later := now.Add(2 * time.Hour)
+
+		at, errFail := attempts.Fail(ctx, key, later, later.Add(-time.Hour))
+		require.NoError(t, errFail)
+		assert.Equal(t, 1, at.Failures)
+		assert.True(t, later.Equal(at.LastFailure))
+
+		n, errDelete := attempts.DeleteBefore(ctx, later)
+		require.NoError(t, errDelete)
+		assert.Equal(t, 0, n)
+
+		n, errDelete = attempts.DeleteBefore(ctx, later.Add(time.Second))
+		require.NoError(t, errDelete)
+		assert.GreaterOrEqual(t, n, 1)
+
+		_, errGet = attempts.Get(ctx, key)
+		assert.ErrorIs(t, errGet, ErrNotFound)
+
+		// reserved attempt is forgiven, the last one removes the key
+		for i := 1; i <= 2; i++ {
+			_, errFail = attempts.Fail(ctx, key, now, now.Add(-time.Hour))
+			require.NoError(t, errFail)
+		}
+		require.NoError(t, attempts.Forgive(ctx, key))
+
+		at, errGet = attempts.Get(ctx, key)
+		require.NoError(t, errGet)
+		assert.Equal(t, 1, at.Failures)
+		assert.True(t, now.Equal(at.LastFailure))
+
+		require.NoError(t, attempts.Forgive(ctx, key))
+		_, errGet = attempts.Get(ctx, key)
+		assert.ErrorIs(t, errGet, ErrNotFound)
+
+		_, errFail = attempts.Fail(ctx, key, now, now)
+		require.NoError(t, errFail)
+		require.NoError(t, attempts.Reset(ctx, key))
+
+		_, errGet = attempts.Get(ctx, key)
+		assert.ErrorIs(t, errGet, ErrNotFound)
+	})
+}
+
+func TestLoginPolicyBlockedUntil(t *testing.T) {
+	p := LoginPolicy{
+		FreeFailures: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     5 * time.Second,
+		MaxFailures:  8,
+		Lockout:      time.Minute,
+	}
+
+	now := time.Now()
+
+	for failures, delay := range map[int]time.Duration{
+		0: 0,
+		2: 0,
+		3: time.Second,
+		4: 2 * time.Second,
+		5: 4 * time.Second,
+		6: 5 * time.Second,
+		7: 5 * time.Second,
+		8: time.Minute,
+		9: time.Minute,
+	} {
+		until := p.BlockedUntil(Attempt{Failures: failures, LastFailure: now})
+		if delay == 0 {
+			assert.True(t, until.IsZero(), failures)
+
+			continue
+		}
+		assert.Equal(t, now.Add(delay), until, failures)
+		assert.Equal(t, failures >= 8, p.Locked(Attempt{Failures: failures}), failures)
+	}
+}
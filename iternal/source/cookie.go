@@ -1,17 +1,218 @@
 package source
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
+	"strings"
+	"time"
 )
 
 const (
 	MarkCookieUser = "tokenU"
-	MarkCookieID   = "tokenID"
+	MarkCookieCSRF = "tokenCSRF"
+	MarkCookieMFA  = "tokenMFA"
 )
 
-func ReadCookie(r *http.Request, mark string) (string, error) {
+var (
+	ErrCookieTampered = errors.New("cookie: value is tampered or signed by unknown key")
+	ErrCookieExpired  = errors.New("cookie: value is expired")
+	ErrCookieKeys     = errors.New("cookie: bad key set")
+)
+
+// CookieKey - Hash signs values (HMAC-SHA256, at least 32 bytes),
+// Block encrypts them (AES-GCM, 16, 24 or 32 bytes), Block is needed only when codec encrypts,
+// in json keys are written in base64
+type CookieKey struct {
+	ID    string `json:"id"`
+	Hash  []byte `json:"hash"`
+	Block []byte `json:"block,omitempty"`
+}
+
+func NewCookieKey(id string) (CookieKey, error) {
+	k := CookieKey{ID: id, Hash: make([]byte, 32), Block: make([]byte, 32)}
+
+	if _, err := rand.Read(k.Hash); err != nil {
+		return CookieKey{}, err
+	}
+	if _, err := rand.Read(k.Block); err != nil {
+		return CookieKey{}, err
+	}
+
+	return k, nil
+}
+
+// CookieCodec - signs and optionally encrypts values of cookies.
+// The first key signs new values, all keys are accepted on read, so keys are rotated
+// by putting a new key first and dropping the oldest one after lifetime of cookies
+type CookieCodec struct {
+	keys    []CookieKey
+	encrypt bool
+	aead    map[string]cipher.AEAD
+
+	Path     string
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+
+	now func() time.Time
+}
+
+// NewCookieCodec - cookies are HttpOnly, Secure, SameSite=Lax, Path=/ by default
+func NewCookieCodec(keys []CookieKey, encrypt bool) (*CookieCodec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys", ErrCookieKeys)
+	}
+
+	c := &CookieCodec{
+		keys:     keys,
+		encrypt:  encrypt,
+		aead:     make(map[string]cipher.AEAD),
+		Path:     "/",
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+		now:      time.Now,
+	}
+
+	ids := make(map[string]struct{})
+
+	for _, k := range keys {
+		if k.ID == "" || strings.Contains(k.ID, ".") {
+			return nil, fmt.Errorf("%w: bad id %q", ErrCookieKeys, k.ID)
+		}
+		if _, ex := ids[k.ID]; ex {
+			return nil, fmt.Errorf("%w: id %q is repeated", ErrCookieKeys, k.ID)
+		}
+		ids[k.ID] = struct{}{}
+
+		if len(k.Hash) < 32 {
+			return nil, fmt.Errorf("%w: hash key %q is shorter than 32 bytes", ErrCookieKeys, k.ID)
+		}
+
+		if !encrypt {
+			continue
+		}
+
+		block, errBlock := aes.NewCipher(k.Block)
+		if errBlock != nil {
+			return nil, fmt.Errorf("%w: block key %q - %w", ErrCookieKeys, k.ID, errBlock)
+		}
+
+		aead, errGCM := cipher.NewGCM(block)
+		if errGCM != nil {
+			return nil, errGCM
+		}
+
+		c.aead[k.ID] = aead
+	}
+
+	return c, nil
+}
+
+// NewRandomCookieCodec - one random key, cookies do not survive restart and are not shared between instances
+func NewRandomCookieCodec() (*CookieCodec, error) {
+	k, errKey := NewCookieKey("random")
+	if errKey != nil {
+		return nil, errKey
+	}
+
+	return NewCookieCodec([]CookieKey{k}, false)
+}
+
+// Encode - <key id>.<payload>.<mac>, payload is expiration (unix seconds) and value,
+// encrypted when codec encrypts; mac covers name of cookie, so a value can't be moved to other cookie
+func (c *CookieCodec) Encode(name, value string, expires time.Time) (string, error) {
+	k := c.keys[0]
+
+	payload := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(payload, uint64(expires.Unix()))
+	payload = append(payload, value...)
+
+	if c.encrypt {
+		aead := c.aead[k.ID]
+
+		nonce := make([]byte, aead.NonceSize())
+		if _, err := rand.Read(nonce); err != nil {
+			return "", err
+		}
+
+		payload = aead.Seal(nonce, nonce, payload, []byte(name))
+	}
+
+	body := k.ID + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return body + "." + base64.RawURLEncoding.EncodeToString(c.mac(k, name, body)), nil
+}
+
+// Decode - ErrCookieTampered for wrong signature, unknown key or broken format, ErrCookieExpired for old value
+func (c *CookieCodec) Decode(name, encoded string) (string, error) {
+	parts := strings.Split(encoded, ".")
+	if len(parts) != 3 {
+		return "", ErrCookieTampered
+	}
+
+	k, ex := c.key(parts[0])
+	if !ex {
+		return "", ErrCookieTampered
+	}
+
+	mac, errMac := base64.RawURLEncoding.DecodeString(parts[2])
+	if errMac != nil || !hmac.Equal(mac, c.mac(k, name, parts[0]+"."+parts[1])) {
+		return "", ErrCookieTampered
+	}
+
+	payload, errPayload := base64.RawURLEncoding.DecodeString(parts[1])
+	if errPayload != nil {
+		return "", ErrCookieTampered
+	}
+
+	if c.encrypt {
+		aead := c.aead[k.ID]
+		if len(payload) < aead.NonceSize() {
+			return "", ErrCookieTampered
+		}
+
+		var errOpen error
+		payload, errOpen = aead.Open(nil, payload[:aead.NonceSize()], payload[aead.NonceSize():], []byte(name))
+		if errOpen != nil {
+			return "", ErrCookieTampered
+		}
+	}
+
+	if len(payload) < 8 {
+		return "", ErrCookieTampered
+	}
+
+	expires := time.Unix(int64(binary.BigEndian.Uint64(payload[:8])), 0)
+	if !expires.After(c.now()) {
+		return "", ErrCookieExpired
+	}
+
+	return string(payload[8:]), nil
+}
+
+func (c *CookieCodec) SetCookie(w http.ResponseWriter, name, value string, expires time.Time) error {
+	encoded, errEnc := c.Encode(name, value, expires)
+	if errEnc != nil {
+		return errEnc
+	}
+
+	cookie := c.cookie(name)
+	cookie.Value = encoded
+	cookie.Expires = expires
+	http.SetCookie(w, cookie)
+
+	return nil
+}
+
+func (c *CookieCodec) ReadCookie(r *http.Request, mark string) (string, error) {
 	if len(mark) < 1 {
 		return "", fmt.Errorf("empty cookie")
 	}
@@ -21,20 +222,56 @@ func ReadCookie(r *http.Request, mark string) (string, error) {
 		return "", errC
 	}
 
-	value, errV := url.QueryUnescape(cookie.Value)
-	if errV != nil {
-		return "", errV
-	}
+	return c.Decode(mark, cookie.Value)
+}
+
+// DeleteCookie - removes one cookie with the same attributes it was set
+func (c *CookieCodec) DeleteCookie(w http.ResponseWriter, name string) {
+	cookie := c.cookie(name)
+	cookie.MaxAge = -1
+	http.SetCookie(w, cookie)
+}
 
-	return value, nil
+// SetClock - source of current time for expiration of values, for tests
+func (c *CookieCodec) SetClock(now func() time.Time) {
+	c.now = now
 }
 
-func CleanCookie(w http.ResponseWriter, r *http.Request) {
+// CleanCookie - removes all cookies of request with the same attributes they were set
+func (c *CookieCodec) CleanCookie(w http.ResponseWriter, r *http.Request) {
 	for _, v := range r.Cookies() {
-		c := http.Cookie{
-			Name:   v.Name,
-			MaxAge: -1,
+		cookie := c.cookie(v.Name)
+		cookie.MaxAge = -1
+		http.SetCookie(w, cookie)
+	}
+}
+
+func (c *CookieCodec) cookie(name string) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		Secure:   c.Secure,
+		HttpOnly: true,
+		SameSite: c.SameSite,
+	}
+}
+
+func (c *CookieCodec) key(id string) (CookieKey, bool) {
+	for _, k := range c.keys {
+		if k.ID == id {
+			return k, true
 		}
-		http.SetCookie(w, &c)
 	}
+
+	return CookieKey{}, false
+}
+
+func (c *CookieCodec) mac(k CookieKey, name, body string) []byte {
+	h := hmac.New(sha256.New, k.Hash)
+	h.Write([]byte(name))
+	h.Write([]byte{'|'})
+	h.Write([]byte(body))
+
+	return h.Sum(nil)
 }
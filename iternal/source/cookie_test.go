@@ -0,0 +1,179 @@
+package source
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newCookieCodec(t *testing.T, encrypt bool, ids ...string) *CookieCodec {
+	keys := []CookieKey{}
+
+	for _, id := range ids {
+		k, errKey := NewCookieKey(id)
+		require.NoError(t, errKey)
+
+		keys = append(keys, k)
+	}
+
+	c, errCodec := NewCookieCodec(keys, encrypt)
+	require.NoError(t, errCodec)
+
+	return c
+}
+
+func TestCookieCodecRoundTrip(t *testing.T) {
+	for _, encrypt := range []bool{false, true} {
+		c := newCookieCodec(t, encrypt, "k1")
+
+		const value = "session-token"
+
+		encoded, errEnc := c.Encode(MarkCookieUser, value, time.Now().Add(time.Hour))
+		require.NoError(t, errEnc)
+		assert.True(t, strings.HasPrefix(encoded, "k1."))
+
+		payload, errPayload := base64.RawURLEncoding.DecodeString(strings.Split(encoded, ".")[1])
+		require.NoError(t, errPayload)
+		assert.Equal(t, !encrypt, strings.Contains(string(payload), value), "encrypt=%v", encrypt)
+
+		decoded, errDec := c.Decode(MarkCookieUser, encoded)
+		require.NoError(t, errDec)
+		assert.Equal(t, value, decoded)
+
+		// value can't be moved to other cookie
+		_, errDec = c.Decode("other", encoded)
+		assert.ErrorIs(t, errDec, ErrCookieTampered)
+	}
+}
+
+func TestCookieCodecTampered(t *testing.T) {
+	c := newCookieCodec(t, false, "k1")
+
+	encoded, errEnc := c.Encode(MarkCookieUser, "session-token", time.Now().Add(time.Hour))
+	require.NoError(t, errEnc)
+
+	parts := strings.Split(encoded, ".")
+
+	forged, errForged := newCookieCodec(t, false, "k1").Encode(MarkCookieUser, "session-token", time.Now().Add(time.Hour))
+	require.NoError(t, errForged)
+
+	for _, value := range []string{
+		"session-token",
+		parts[0] + "." + parts[1],
+		"k2." + parts[1] + "." + parts[2],
+		parts[0] + ".AAAA" + parts[1] + "." + parts[2],
+		parts[0] + "." + parts[1] + ".!",
+		forged,
+	} {
+		_, errDec := c.Decode(MarkCookieUser, value)
+		assert.ErrorIs(t, errDec, ErrCookieTampered, value)
+	}
+}
+
+func TestCookieCodecExpired(t *testing.T) {
+	c := newCookieCodec(t, true, "k1")
+
+	now := time.Now()
+	c.now = func() time.Time { return now }
+
+	encoded, errEnc := c.Encode(MarkCookieUser, "session-token", now.Add(time.Minute))
+	require.NoError(t, errEnc)
+
+	_, errDec := c.Decode(MarkCookieUser, encoded)
+	require.NoError(t, errDec)
+
+	now = now.Add(time.Minute)
+
+	_, errDec = c.Decode(MarkCookieUser, encoded)
+	assert.ErrorIs(t, errDec, ErrCookieExpired)
+}
+
+func TestCookieCodecRotation(t *testing.T) {
+	old := newCookieCodec(t, true, "k1")
+
+	encoded, errEnc := old.Encode(MarkCookieUser, "session-token", time.Now().Add(time.Hour))
+	require.NoError(t, errEnc)
+
+	fresh, errKey := NewCookieKey("k2")
+	require.NoError(t, errKey)
+
+	rotated, errCodec := NewCookieCodec([]CookieKey{fresh, old.keys[0]}, true)
+	require.NoError(t, errCodec)
+
+	decoded, errDec := rotated.Decode(MarkCookieUser, encoded)
+	require.NoError(t, errDec)
+	assert.Equal(t, "session-token", decoded)
+
+	encoded, errEnc = rotated.Encode(MarkCookieUser, "session-token", time.Now().Add(time.Hour))
+	require.NoError(t, errEnc)
+	assert.True(t, strings.HasPrefix(encoded, "k2."))
+
+	_, errDec = old.Decode(MarkCookieUser, encoded)
+	assert.ErrorIs(t, errDec, ErrCookieTampered)
+}
+
+func TestNewCookieCodecBadKeys(t *testing.T) {
+	k, errKey := NewCookieKey("k1")
+	require.NoError(t, errKey)
+
+	for name, keys := range map[string][]CookieKey{
+		"no keys":    nil,
+		"empty id":   {{Hash: k.Hash}},
+		"dot in id":  {{ID: "k.1", Hash: k.Hash}},
+		"repeated":   {k, k},
+		"short hash": {{ID: "k1", Hash: k.Hash[:16]}},
+	} {
+		_, errCodec := NewCookieCodec(keys, false)
+		assert.ErrorIs(t, errCodec, ErrCookieKeys, name)
+	}
+
+	_, errCodec := NewCookieCodec([]CookieKey{{ID: "k1", Hash: k.Hash, Block: k.Block[:5]}}, true)
+	assert.ErrorIs(t, errCodec, ErrCookieKeys)
+}
+
+func TestCookieCodecSetReadClean(t *testing.T) {
+	c := newCookieCodec(t, false, "k1")
+	c.Domain = "example.com"
+
+	expires := time.Now().Add(time.Hour)
+
+	w := httptest.NewRecorder()
+	require.NoError(t, c.SetCookie(w, MarkCookieUser, "session-token", expires))
+
+	cookies := w.Result().Cookies()
+	require.Len(t, cookies, 1)
+
+	cookie := cookies[0]
+	assert.True(t, cookie.HttpOnly)
+	assert.True(t, cookie.Secure)
+	assert.Equal(t, http.SameSiteLaxMode, cookie.SameSite)
+	assert.Equal(t, "/", cookie.Path)
+	assert.Equal(t, "example.com", cookie.Domain)
+	assert.WithinDuration(t, expires, cookie.Expires, time.Second)
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.AddCookie(&http.Cookie{Name: cookie.Name, Value: cookie.Value})
+
+	value, errRead := c.ReadCookie(req, MarkCookieUser)
+	require.NoError(t, errRead)
+	assert.Equal(t, "session-token", value)
+
+	_, errRead = c.ReadCookie(req, "tokenOther")
+	assert.ErrorIs(t, errRead, http.ErrNoCookie)
+
+	w = httptest.NewRecorder()
+	c.CleanCookie(w, req)
+
+	cookies = w.Result().Cookies()
+	require.Len(t, cookies, 1)
+	assert.Equal(t, MarkCookieUser, cookies[0].Name)
+	assert.Empty(t, cookies[0].Value)
+	assert.Equal(t, -1, cookies[0].MaxAge)
+	assert.Equal(t, "/", cookies[0].Path)
+	assert.True(t, cookies[0].Secure)
+}
@@ -0,0 +1,214 @@
+package source
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgEdDSA = "EdDSA"
+)
+
+var (
+	ErrTokenInvalid = errors.New("token: invalid")
+	ErrTokenExpired = errors.New("token: expired")
+	ErrJWTKeys      = errors.New("token: bad key set")
+)
+
+// JWTKey - Secret is HMAC key (at least 32 bytes) for HS256 or ed25519 seed (32 bytes) for EdDSA,
+// in json Secret is written in base64
+type JWTKey struct {
+	ID     string `json:"id"`
+	Alg    string `json:"alg"`
+	Secret []byte `json:"secret"`
+}
+
+func NewJWTKey(id, alg string) (JWTKey, error) {
+	k := JWTKey{ID: id, Alg: alg, Secret: make([]byte, 32)}
+
+	if _, err := rand.Read(k.Secret); err != nil {
+		return JWTKey{}, err
+	}
+
+	return k, nil
+}
+
+// Claims - registered claims of access token, Subject is ID of user
+type Claims struct {
+	Issuer    string `json:"iss,omitempty"`
+	Subject   string `json:"sub"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+	ID        string `json:"jti,omitempty"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid"`
+}
+
+// JWTSigner - signs access tokens by the first key and verifies by any key of the set,
+// so keys are rotated the same way as keys of CookieCodec
+type JWTSigner struct {
+	keys []JWTKey
+	ed   map[string]ed25519.PrivateKey
+
+	Issuer string
+
+	now func() time.Time
+}
+
+func NewJWTSigner(keys []JWTKey) (*JWTSigner, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: no keys", ErrJWTKeys)
+	}
+
+	s := &JWTSigner{
+		keys: keys,
+		ed:   make(map[string]ed25519.PrivateKey),
+		now:  time.Now,
+	}
+
+	ids := make(map[string]struct{})
+
+	for _, k := range keys {
+		if k.ID == "" {
+			return nil, fmt.Errorf("%w: empty id", ErrJWTKeys)
+		}
+		if _, ex := ids[k.ID]; ex {
+			return nil, fmt.Errorf("%w: id %q is repeated", ErrJWTKeys, k.ID)
+		}
+		ids[k.ID] = struct{}{}
+
+		switch k.Alg {
+		case AlgHS256:
+			if len(k.Secret) < 32 {
+				return nil, fmt.Errorf("%w: secret %q is shorter than 32 bytes", ErrJWTKeys, k.ID)
+			}
+		case AlgEdDSA:
+			if len(k.Secret) != ed25519.SeedSize {
+				return nil, fmt.Errorf("%w: seed %q must be %d bytes", ErrJWTKeys, k.ID, ed25519.SeedSize)
+			}
+
+			s.ed[k.ID] = ed25519.NewKeyFromSeed(k.Secret)
+		default:
+			return nil, fmt.Errorf("%w: key %q has unknown alg %q", ErrJWTKeys, k.ID, k.Alg)
+		}
+	}
+
+	return s, nil
+}
+
+// Sign - compact JWS of claims, Issuer of signer is set when claims have no issuer
+func (s *JWTSigner) Sign(c Claims) (string, error) {
+	k := s.keys[0]
+
+	if c.Issuer == "" {
+		c.Issuer = s.Issuer
+	}
+
+	header, errHeader := json.Marshal(jwtHeader{Alg: k.Alg, Typ: "JWT", Kid: k.ID})
+	if errHeader != nil {
+		return "", errHeader
+	}
+
+	payload, errPayload := json.Marshal(c)
+	if errPayload != nil {
+		return "", errPayload
+	}
+
+	body := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	return body + "." + base64.RawURLEncoding.EncodeToString(s.sign(k, body)), nil
+}
+
+// Parse - claims of valid token, alg of token must be alg of its key,
+// ErrTokenInvalid for wrong signature, unknown key or issuer, ErrTokenExpired for old token
+func (s *JWTSigner) Parse(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, ErrTokenInvalid
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, ErrTokenInvalid
+	}
+
+	k, ex := s.key(header.Kid)
+	if !ex || k.Alg != header.Alg {
+		return Claims{}, ErrTokenInvalid
+	}
+
+	sig, errSig := base64.RawURLEncoding.DecodeString(parts[2])
+	if errSig != nil || !s.verify(k, parts[0]+"."+parts[1], sig) {
+		return Claims{}, ErrTokenInvalid
+	}
+
+	var c Claims
+	if err := decodeSegment(parts[1], &c); err != nil {
+		return Claims{}, ErrTokenInvalid
+	}
+
+	if s.Issuer != "" && c.Issuer != s.Issuer {
+		return Claims{}, ErrTokenInvalid
+	}
+	if !time.Unix(c.ExpiresAt, 0).After(s.now()) {
+		return Claims{}, ErrTokenExpired
+	}
+
+	return c, nil
+}
+
+// SetClock - source of current time for expiration of tokens, for tests
+func (s *JWTSigner) SetClock(now func() time.Time) {
+	s.now = now
+}
+
+func (s *JWTSigner) key(id string) (JWTKey, bool) {
+	for _, k := range s.keys {
+		if k.ID == id {
+			return k, true
+		}
+	}
+
+	return JWTKey{}, false
+}
+
+func (s *JWTSigner) sign(k JWTKey, body string) []byte {
+	if k.Alg == AlgEdDSA {
+		return ed25519.Sign(s.ed[k.ID], []byte(body))
+	}
+
+	h := hmac.New(sha256.New, k.Secret)
+	h.Write([]byte(body))
+
+	return h.Sum(nil)
+}
+
+func (s *JWTSigner) verify(k JWTKey, body string, sig []byte) bool {
+	if k.Alg == AlgEdDSA {
+		return ed25519.Verify(s.ed[k.ID].Public().(ed25519.PublicKey), []byte(body), sig)
+	}
+
+	return hmac.Equal(sig, s.sign(k, body))
+}
+
+func decodeSegment(segment string, obj any) error {
+	data, errData := base64.RawURLEncoding.DecodeString(segment)
+	if errData != nil {
+		return errData
+	}
+
+	return json.Unmarshal(data, obj)
+}
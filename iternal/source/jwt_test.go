@@ -0,0 +1,140 @@
+package source
+
+import (
+	"encoding/base64"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newJWTSigner(t *testing.T, alg string, ids ...string) *JWTSigner {
+	keys := []JWTKey{}
+
+	for _, id := range ids {
+		k, errKey := NewJWTKey(id, alg)
+		require.NoError(t, errKey)
+
+		keys = append(keys, k)
+	}
+
+	s, errSigner := NewJWTSigner(keys)
+	require.NoError(t, errSigner)
+
+	return s
+}
+
+func newClaims() Claims {
+	now := time.Now()
+
+	return Claims{
+		Subject:   "7",
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute).Unix(),
+	}
+}
+
+func TestJWTSignParse(t *testing.T) {
+	for _, alg := range []string{AlgHS256, AlgEdDSA} {
+		s := newJWTSigner(t, alg, "k1")
+		s.Issuer = "bellerophon"
+
+		token, errSign := s.Sign(newClaims())
+		require.NoError(t, errSign)
+		assert.Len(t, strings.Split(token, "."), 3)
+
+		claims, errParse := s.Parse(token)
+		require.NoError(t, errParse, alg)
+		assert.Equal(t, "7", claims.Subject)
+		assert.Equal(t, "bellerophon", claims.Issuer)
+
+		// other key with the same id
+		_, errParse = newJWTSigner(t, alg, "k1").Parse(token)
+		assert.ErrorIs(t, errParse, ErrTokenInvalid, alg)
+	}
+}
+
+func TestJWTParseInvalid(t *testing.T) {
+	s := newJWTSigner(t, AlgHS256, "k1")
+
+	token, errSign := s.Sign(newClaims())
+	require.NoError(t, errSign)
+
+	parts := strings.Split(token, ".")
+
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"1","iat":0,"exp":99999999999}`))
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none","typ":"JWT","kid":"k1"}`))
+	eddsa := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"EdDSA","typ":"JWT","kid":"k1"}`))
+
+	for _, value := range []string{
+		"",
+		parts[0] + "." + parts[1],
+		parts[0] + "." + payload + "." + parts[2],
+		none + "." + parts[1] + ".",
+		eddsa + "." + parts[1] + "." + parts[2],
+		parts[0] + "." + parts[1] + ".!",
+	} {
+		_, errParse := s.Parse(value)
+		assert.ErrorIs(t, errParse, ErrTokenInvalid, value)
+	}
+
+	s.Issuer = "other"
+
+	_, errParse := s.Parse(token)
+	assert.ErrorIs(t, errParse, ErrTokenInvalid)
+}
+
+func TestJWTParseExpired(t *testing.T) {
+	s := newJWTSigner(t, AlgEdDSA, "k1")
+
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	token, errSign := s.Sign(newClaims())
+	require.NoError(t, errSign)
+
+	now = now.Add(time.Minute)
+
+	_, errParse := s.Parse(token)
+	assert.ErrorIs(t, errParse, ErrTokenExpired)
+}
+
+func TestJWTRotation(t *testing.T) {
+	old := newJWTSigner(t, AlgHS256, "k1")
+
+	token, errSign := old.Sign(newClaims())
+	require.NoError(t, errSign)
+
+	fresh, errKey := NewJWTKey("k2", AlgEdDSA)
+	require.NoError(t, errKey)
+
+	rotated, errSigner := NewJWTSigner([]JWTKey{fresh, old.keys[0]})
+	require.NoError(t, errSigner)
+
+	_, errParse := rotated.Parse(token)
+	require.NoError(t, errParse)
+
+	token, errSign = rotated.Sign(newClaims())
+	require.NoError(t, errSign)
+
+	_, errParse = old.Parse(token)
+	assert.ErrorIs(t, errParse, ErrTokenInvalid)
+}
+
+func TestNewJWTSignerBadKeys(t *testing.T) {
+	k, errKey := NewJWTKey("k1", AlgHS256)
+	require.NoError(t, errKey)
+
+	for name, keys := range map[string][]JWTKey{
+		"no keys":      nil,
+		"empty id":     {{Alg: AlgHS256, Secret: k.Secret}},
+		"repeated":     {k, k},
+		"short secret": {{ID: "k1", Alg: AlgHS256, Secret: k.Secret[:16]}},
+		"bad seed":     {{ID: "k1", Alg: AlgEdDSA, Secret: k.Secret[:16]}},
+		"unknown alg":  {{ID: "k1", Alg: "none", Secret: k.Secret}},
+	} {
+		_, errSigner := NewJWTSigner(keys)
+		assert.ErrorIs(t, errSigner, ErrJWTKeys, name)
+	}
+}
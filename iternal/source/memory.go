@@ -0,0 +1,270 @@
+package source
+
+import (
+	"context"
+	"strconv"
+	"sync"
+)
+
+// MemorySource - Store in memory, keeps the constraints of the users and info tables:
+// unique login and email, identity id, info row lives and dies with its user
+type MemorySource struct {
+	mu sync.RWMutex
+
+	lastID int
+	users  map[int]User
+	logins map[string]int
+	emails map[string]int
+	// info - id of user -> secret, nil secret is NULL
+	info map[int]*string
+}
+
+func NewMemorySource() *MemorySource {
+	return &MemorySource{
+		users:  make(map[int]User),
+		logins: make(map[string]int),
+		emails: make(map[string]int),
+		info:   make(map[int]*string),
+	}
+}
+
+func (m *MemorySource) UserCreate(_ context.Context, u *UserSourceData) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ex := m.logins[u.Login]; ex {
+		return 0, ErrDuplicateLogin
+	}
+	if _, ex := m.emails[u.Email]; ex {
+		return 0, ErrDuplicateEmail
+	}
+
+	m.lastID++
+	id := m.lastID
+
+	m.users[id] = User{
+		ID:           id,
+		Login:        u.Login,
+		HashPassword: u.PasswordOne,
+		Name:         u.Name,
+		Surname:      u.Surname,
+		Email:        u.Email,
+	}
+	m.logins[u.Login] = id
+	m.emails[u.Email] = id
+	m.info[id] = nil
+
+	return id, nil
+}
+
+func (m *MemorySource) UserLogin(_ context.Context, u *UserSourceData) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	id, ex := m.logins[u.Login]
+	if !ex {
+		return User{}, ErrNotFound
+	}
+
+	user := m.users[id]
+
+	return User{
+		ID:           user.ID,
+		Login:        user.Login,
+		HashPassword: user.HashPassword,
+		Name:         user.Name,
+		Surname:      user.Surname,
+	}, nil
+}
+
+func (m *MemorySource) UserData(_ context.Context, id string) (User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, errUser := m.user(id)
+	if errUser != nil {
+		return User{}, errUser
+	}
+	user.HashPassword = ""
+
+	return user, nil
+}
+
+func (m *MemorySource) UserDataLoginUpdate(_ context.Context, u *UserSourceData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ex := m.users[u.ID]
+	if !ex {
+		return ErrNotFound
+	}
+	if id, ex := m.logins[u.Login]; ex && id != u.ID {
+		return ErrDuplicateLogin
+	}
+
+	delete(m.logins, user.Login)
+	user.Login = u.Login
+	m.logins[user.Login] = user.ID
+	m.users[user.ID] = user
+
+	return nil
+}
+
+func (m *MemorySource) UserDataPasswordUpdate(_ context.Context, u *UserSourceData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ex := m.users[u.ID]
+	if !ex {
+		return ErrNotFound
+	}
+
+	user.HashPassword = u.PasswordOne
+	m.users[user.ID] = user
+
+	return nil
+}
+
+func (m *MemorySource) UserDataNameUpdate(_ context.Context, u *UserSourceData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ex := m.users[u.ID]
+	if !ex {
+		return ErrNotFound
+	}
+
+	user.Name = u.Name
+	user.Surname = u.Surname
+	m.users[user.ID] = user
+
+	return nil
+}
+
+func (m *MemorySource) UserDataEmailUpdate(_ context.Context, u *UserSourceData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ex := m.users[u.ID]
+	if !ex {
+		return ErrNotFound
+	}
+	if id, ex := m.emails[u.Email]; ex && id != u.ID {
+		return ErrDuplicateEmail
+	}
+
+	delete(m.emails, user.Email)
+	user.Email = u.Email
+	m.emails[user.Email] = user.ID
+	m.users[user.ID] = user
+
+	return nil
+}
+
+func (m *MemorySource) UserDataProfileUpdate(_ context.Context, u *UserSourceData) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ex := m.users[u.ID]
+	if !ex {
+		return ErrNotFound
+	}
+	if id, ex := m.logins[u.Login]; ex && id != u.ID {
+		return ErrDuplicateLogin
+	}
+	if id, ex := m.emails[u.Email]; ex && id != u.ID {
+		return ErrDuplicateEmail
+	}
+
+	delete(m.logins, user.Login)
+	delete(m.emails, user.Email)
+	user.Login, user.Name, user.Surname, user.Email = u.Login, u.Name, u.Surname, u.Email
+	m.logins[user.Login] = user.ID
+	m.emails[user.Email] = user.ID
+	m.users[user.ID] = user
+
+	return nil
+}
+
+func (m *MemorySource) UserDataDelete(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, errUser := m.user(id)
+	if errUser != nil {
+		return errUser
+	}
+
+	delete(m.info, user.ID)
+	delete(m.logins, user.Login)
+	delete(m.emails, user.Email)
+	delete(m.users, user.ID)
+
+	return nil
+}
+
+func (m *MemorySource) InfoCreate(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, errUser := m.user(id)
+	if errUser != nil {
+		return errUser
+	}
+	if _, ex := m.info[user.ID]; ex {
+		return ErrDuplicate
+	}
+
+	m.info[user.ID] = nil
+
+	return nil
+}
+
+func (m *MemorySource) InfoByID(_ context.Context, id string) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	user, errUser := m.user(id)
+	if errUser != nil {
+		return "", errUser
+	}
+
+	secret := m.info[user.ID]
+	if secret == nil {
+		return "", ErrNotFound
+	}
+
+	return *secret, nil
+}
+
+func (m *MemorySource) InfoChangeByID(_ context.Context, id, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, errUser := m.user(id)
+	if errUser != nil {
+		return errUser
+	}
+	if _, ex := m.info[user.ID]; !ex {
+		return ErrNotFound
+	}
+
+	m.info[user.ID] = &secret
+
+	return nil
+}
+
+// user - must be called under lock
+func (m *MemorySource) user(id string) (User, error) {
+	key, errID := strconv.Atoi(id)
+	if errID != nil {
+		return User{}, ErrNotFound
+	}
+
+	user, ex := m.users[key]
+	if !ex {
+		return User{}, ErrNotFound
+	}
+
+	return user, nil
+}
@@ -0,0 +1,94 @@
+package source
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMemoryUserCreateGetDelete(t *testing.T) {
+	m := NewMemorySource()
+	ctx := context.Background()
+
+	userSign := NewUser()
+
+	id, errCreate := m.UserCreate(ctx, userSign)
+	require.NoError(t, errCreate)
+	require.NotZero(t, id)
+
+	strID := strconv.Itoa(id)
+
+	u, errData := m.UserData(ctx, strID)
+	require.NoError(t, errData)
+
+	assert.Empty(t, u.HashPassword)
+	assert.Equal(t, id, u.ID)
+	assert.Equal(t, userSign.Login, u.Login)
+	assert.Equal(t, userSign.Email, u.Email)
+
+	uLogin, errLogin := m.UserLogin(ctx, userSign)
+	require.NoError(t, errLogin)
+	assert.Equal(t, id, uLogin.ID)
+	assert.Equal(t, userSign.PasswordOne, uLogin.HashPassword)
+
+	wrong := NewUser()
+	wrong.Login = "wrong"
+	_, errLogin = m.UserLogin(ctx, wrong)
+	assert.ErrorIs(t, errLogin, ErrNotFound)
+
+	require.NoError(t, m.InfoChangeByID(ctx, strID, "secret"))
+
+	errDelete := m.UserDataDelete(ctx, strID)
+	require.NoError(t, errDelete)
+
+	u, errData = m.UserData(ctx, strID)
+	assert.ErrorIs(t, errData, ErrNotFound)
+	assert.Empty(t, u)
+
+	_, errInfo := m.InfoByID(ctx, strID)
+	assert.ErrorIs(t, errInfo, ErrNotFound)
+
+	assert.ErrorIs(t, m.UserDataDelete(ctx, strID), ErrNotFound)
+
+	// identity - id is never reused
+	idNext, errCreate := m.UserCreate(ctx, userSign)
+	require.NoError(t, errCreate)
+	assert.Greater(t, idNext, id)
+}
+
+func TestMemoryConcurrentCreate(t *testing.T) {
+	m := NewMemorySource()
+	ctx := context.Background()
+
+	const n = 50
+
+	wg := sync.WaitGroup{}
+	ids := make(chan int, n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			u := NewUser()
+			u.Login = "Loko" + strconv.Itoa(i)
+			u.Email = strconv.Itoa(i) + u.Email
+
+			id, err := m.UserCreate(ctx, u)
+			assert.NoError(t, err)
+			ids <- id
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+
+	unique := make(map[int]struct{})
+	for id := range ids {
+		unique[id] = struct{}{}
+	}
+
+	assert.Len(t, unique, n)
+}
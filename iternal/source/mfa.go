@@ -0,0 +1,258 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+)
+
+// ErrCodeReused - TOTP code of the same or earlier step was already accepted
+var ErrCodeReused = errors.New("mfa: code is already used")
+
+// MFA - TOTP of user, LastStep is the last accepted step, so every code works once
+type MFA struct {
+	UserID    int
+	Secret    string
+	Confirmed bool
+	LastStep  int64
+}
+
+// MFAStore - storage of TOTP secrets and recovery codes (only hashes), safe for concurrent use
+type MFAStore interface {
+	// Get - ErrNotFound if user has no secret
+	Get(ctx context.Context, userID int) (MFA, error)
+	// Enroll - new unconfirmed secret, replaces unconfirmed one, ErrDuplicate if 2FA is on
+	Enroll(ctx context.Context, userID int, secret string) error
+	// Confirm - turns 2FA on with new recovery codes, ErrNotFound if there is no unconfirmed secret
+	Confirm(ctx context.Context, userID int, step int64, recoveryHashes []string) error
+	// UseStep - accepts step after LastStep, ErrCodeReused otherwise
+	UseStep(ctx context.Context, userID int, step int64) error
+	// UseRecoveryCode - removes code, ErrNotFound if user has no such code
+	UseRecoveryCode(ctx context.Context, userID int, hash string) error
+	// Disable - removes secret and recovery codes
+	Disable(ctx context.Context, userID int) error
+}
+
+var (
+	_ MFAStore = (*MemoryMFA)(nil)
+	_ MFAStore = (*SqlMFA)(nil)
+)
+
+type MemoryMFA struct {
+	mu       sync.Mutex
+	mfa      map[int]MFA
+	recovery map[int]map[string]struct{}
+}
+
+func NewMemoryMFA() *MemoryMFA {
+	return &MemoryMFA{
+		mfa:      make(map[int]MFA),
+		recovery: make(map[int]map[string]struct{}),
+	}
+}
+
+func (m *MemoryMFA) Get(_ context.Context, userID int) (MFA, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ex := m.mfa[userID]
+	if !ex {
+		return MFA{}, ErrNotFound
+	}
+
+	return mfa, nil
+}
+
+func (m *MemoryMFA) Enroll(_ context.Context, userID int, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.mfa[userID].Confirmed {
+		return ErrDuplicate
+	}
+
+	m.mfa[userID] = MFA{UserID: userID, Secret: secret}
+
+	return nil
+}
+
+func (m *MemoryMFA) Confirm(_ context.Context, userID int, step int64, recoveryHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ex := m.mfa[userID]
+	if !ex || mfa.Confirmed {
+		return ErrNotFound
+	}
+
+	mfa.Confirmed = true
+	mfa.LastStep = step
+	m.mfa[userID] = mfa
+
+	codes := make(map[string]struct{})
+	for _, h := range recoveryHashes {
+		codes[h] = struct{}{}
+	}
+	m.recovery[userID] = codes
+
+	return nil
+}
+
+func (m *MemoryMFA) UseStep(_ context.Context, userID int, step int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mfa, ex := m.mfa[userID]
+	if !ex {
+		return ErrNotFound
+	}
+	if step <= mfa.LastStep {
+		return ErrCodeReused
+	}
+
+	mfa.LastStep = step
+	m.mfa[userID] = mfa
+
+	return nil
+}
+
+func (m *MemoryMFA) UseRecoveryCode(_ context.Context, userID int, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ex := m.recovery[userID][hash]; !ex {
+		return ErrNotFound
+	}
+
+	delete(m.recovery[userID], hash)
+
+	return nil
+}
+
+func (m *MemoryMFA) Disable(_ context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.mfa, userID)
+	delete(m.recovery, userID)
+
+	return nil
+}
+
+// SqlMFA - TOTP in tables mfa and mfa_recovery_codes of DB
+type SqlMFA struct {
+	source *sql.DB
+}
+
+func NewSqlMFA(source *sql.DB) *SqlMFA {
+	return &SqlMFA{source: source}
+}
+
+func (s *SqlMFA) Get(ctx context.Context, userID int) (MFA, error) {
+	mfa := MFA{UserID: userID}
+
+	err := s.source.QueryRowContext(ctx, `
+SELECT secret,
+       confirmed,
+       last_step
+FROM mfa
+WHERE user_id = $1;`, userID).Scan(&mfa.Secret, &mfa.Confirmed, &mfa.LastStep)
+	if err != nil {
+		return MFA{}, sqlError(err)
+	}
+
+	return mfa, nil
+}
+
+func (s *SqlMFA) Enroll(ctx context.Context, userID int, secret string) error {
+	res, err := s.source.ExecContext(ctx, `
+INSERT INTO mfa (user_id,
+                 secret,
+                 confirmed,
+                 last_step)
+VALUES ($1,$2,false,0)
+ON CONFLICT (user_id) DO UPDATE
+    SET secret    = excluded.secret,
+        last_step = 0
+WHERE mfa.confirmed = false;`, userID, secret)
+
+	errAffected := affected(res, err)
+	if errors.Is(errAffected, ErrNotFound) {
+		// conflict with confirmed row, or no user for foreign key
+		if _, errGet := s.Get(ctx, userID); errGet == nil {
+			return ErrDuplicate
+		}
+	}
+
+	return errAffected
+}
+
+func (s *SqlMFA) Confirm(ctx context.Context, userID int, step int64, recoveryHashes []string) error {
+	tx, errTx := s.source.BeginTx(ctx, nil)
+	if errTx != nil {
+		return errTx
+	}
+	defer tx.Rollback()
+
+	res, errUpdate := tx.ExecContext(ctx, `
+UPDATE mfa
+SET confirmed = true,
+    last_step = $1
+WHERE user_id = $2
+  AND confirmed = false;`, step, userID)
+	if errAffected := affected(res, errUpdate); errAffected != nil {
+		return errAffected
+	}
+
+	if _, errDelete := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1;`, userID); errDelete != nil {
+		return sqlError(errDelete)
+	}
+
+	for _, h := range recoveryHashes {
+		_, errInsert := tx.ExecContext(ctx, `INSERT INTO mfa_recovery_codes (user_id, hash) VALUES ($1,$2);`, userID, h)
+		if errInsert != nil {
+			return sqlError(errInsert)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *SqlMFA) UseStep(ctx context.Context, userID int, step int64) error {
+	res, err := s.source.ExecContext(ctx, `
+UPDATE mfa
+SET last_step = $1
+WHERE user_id = $2
+  AND last_step < $1;`, step, userID)
+
+	errAffected := affected(res, err)
+	if errors.Is(errAffected, ErrNotFound) {
+		return ErrCodeReused
+	}
+
+	return errAffected
+}
+
+func (s *SqlMFA) UseRecoveryCode(ctx context.Context, userID int, hash string) error {
+	res, err := s.source.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1 AND hash = $2;`, userID, hash)
+
+	return affected(res, err)
+}
+
+func (s *SqlMFA) Disable(ctx context.Context, userID int) error {
+	tx, errTx := s.source.BeginTx(ctx, nil)
+	if errTx != nil {
+		return errTx
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1;`, userID); err != nil {
+		return sqlError(err)
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM mfa WHERE user_id = $1;`, userID); err != nil {
+		return sqlError(err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,213 @@
+package source
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"strings"
+)
+
+var (
+	ErrUnknownHasher     = errors.New("unknown password hasher")
+	ErrUnknownHashFormat = errors.New("unknown format of password hash")
+)
+
+const (
+	HasherArgon2id = "argon2id"
+	HasherBcrypt   = "bcrypt"
+)
+
+// PasswordHasher - makes and checks hashes of passwords stored in users.hashed_password,
+// password is a value after ChangePassword.HashPassword
+type PasswordHasher interface {
+	// Hash - PHC string with own random salt
+	Hash(password string) (string, error)
+	// Verify - match is true when password fits encoded,
+	// rehash is true when encoded is made by other algorithm or params and should be replaced by Hash
+	Verify(password, encoded string) (match, rehash bool, err error)
+}
+
+func NewPasswordHasher(name string) (PasswordHasher, error) {
+	switch name {
+	case "", HasherArgon2id:
+		return NewArgon2idHasher(), nil
+	case HasherBcrypt:
+		return NewBcryptHasher(), nil
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownHasher, name)
+}
+
+type Argon2idHasher struct {
+	Time    uint32
+	Memory  uint32 // KiB
+	Threads uint8
+	SaltLen uint32
+	KeyLen  uint32
+}
+
+// NewArgon2idHasher - params recommended by OWASP
+func NewArgon2idHasher() *Argon2idHasher {
+	return &Argon2idHasher{
+		Time:    2,
+		Memory:  19 * 1024,
+		Threads: 1,
+		SaltLen: 16,
+		KeyLen:  32,
+	}
+}
+
+const prefixArgon2id = "$argon2id$"
+
+func (h *Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Time, h.Memory, h.Threads, h.KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		prefixArgon2id, argon2.Version,
+		h.Memory, h.Time, h.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *Argon2idHasher) Verify(password, encoded string) (bool, bool, error) {
+	if !strings.HasPrefix(encoded, prefixArgon2id) {
+		return verifyForeign(password, encoded)
+	}
+
+	params, salt, key, errDec := decodeArgon2id(encoded)
+	if errDec != nil {
+		return false, false, errDec
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return false, false, nil
+	}
+
+	rehash := params.Time != h.Time || params.Memory != h.Memory || params.Threads != h.Threads ||
+		uint32(len(salt)) != h.SaltLen || uint32(len(key)) != h.KeyLen
+
+	return true, rehash, nil
+}
+
+// decodeArgon2id - $argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+func decodeArgon2id(encoded string) (Argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Argon2idHasher{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	version := 0
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return Argon2idHasher{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	var params Argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return Argon2idHasher{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, errSalt := base64.RawStdEncoding.DecodeString(parts[4])
+	if errSalt != nil {
+		return Argon2idHasher{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	key, errKey := base64.RawStdEncoding.DecodeString(parts[5])
+	if errKey != nil || len(key) == 0 {
+		return Argon2idHasher{}, nil, nil, ErrUnknownHashFormat
+	}
+
+	params.SaltLen = uint32(len(salt))
+	params.KeyLen = uint32(len(key))
+
+	return params, salt, key, nil
+}
+
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher() *BcryptHasher {
+	return &BcryptHasher{Cost: bcrypt.DefaultCost}
+}
+
+func (h *BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h *BcryptHasher) Verify(password, encoded string) (bool, bool, error) {
+	if !isBcrypt(encoded) {
+		return verifyForeign(password, encoded)
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	cost, errCost := bcrypt.Cost([]byte(encoded))
+	if errCost != nil {
+		return false, false, errCost
+	}
+
+	return true, cost != h.Cost, nil
+}
+
+func isBcrypt(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") ||
+		strings.HasPrefix(encoded, "$2b$") ||
+		strings.HasPrefix(encoded, "$2y$")
+}
+
+// verifyForeign - checks hashes of other hasher or legacy HashData, a match always needs rehash
+func verifyForeign(password, encoded string) (bool, bool, error) {
+	var (
+		match bool
+		err   error
+	)
+
+	switch {
+	case strings.HasPrefix(encoded, prefixArgon2id):
+		match, _, err = NewArgon2idHasher().Verify(password, encoded)
+	case isBcrypt(encoded):
+		match, _, err = NewBcryptHasher().Verify(password, encoded)
+	case isLegacyHash(encoded):
+		match = subtle.ConstantTimeCompare([]byte(password), []byte(encoded)) == 1
+	default:
+		err = ErrUnknownHashFormat
+	}
+
+	return match, match, err
+}
+
+// isLegacyHash - bare sha256 hex digest of HashData
+func isLegacyHash(encoded string) bool {
+	if len(encoded) != 64 {
+		return false
+	}
+
+	for _, ch := range encoded {
+		if !('0' <= ch && ch <= '9' || 'a' <= ch && ch <= 'f') {
+			return false
+		}
+	}
+
+	return true
+}
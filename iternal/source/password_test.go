@@ -0,0 +1,80 @@
+package source
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	password := HashData("qwert1234")
+
+	for _, name := range []string{HasherArgon2id, HasherBcrypt} {
+		h, errNew := NewPasswordHasher(name)
+		require.NoError(t, errNew)
+
+		encoded, errHash := h.Hash(password)
+		require.NoError(t, errHash)
+		assert.NotContains(t, encoded, password)
+
+		// per-user salt
+		other, errHash := h.Hash(password)
+		require.NoError(t, errHash)
+		assert.NotEqual(t, encoded, other)
+
+		match, rehash, errVerify := h.Verify(password, encoded)
+		require.NoError(t, errVerify)
+		assert.True(t, match, name)
+		assert.False(t, rehash, name)
+
+		match, rehash, errVerify = h.Verify(HashData("wrong"), encoded)
+		require.NoError(t, errVerify)
+		assert.False(t, match, name)
+		assert.False(t, rehash, name)
+	}
+
+	_, errNew := NewPasswordHasher("md5")
+	assert.ErrorIs(t, errNew, ErrUnknownHasher)
+}
+
+func TestPasswordRehash(t *testing.T) {
+	password := HashData("qwert1234")
+	argon := NewArgon2idHasher()
+
+	// legacy sha256 digest
+	match, rehash, errVerify := argon.Verify(password, password)
+	require.NoError(t, errVerify)
+	assert.True(t, match)
+	assert.True(t, rehash)
+
+	match, rehash, errVerify = argon.Verify(HashData("wrong"), password)
+	require.NoError(t, errVerify)
+	assert.False(t, match)
+	assert.False(t, rehash)
+
+	// other algorithm
+	encoded, errHash := NewBcryptHasher().Hash(password)
+	require.NoError(t, errHash)
+
+	match, rehash, errVerify = argon.Verify(password, encoded)
+	require.NoError(t, errVerify)
+	assert.True(t, match)
+	assert.True(t, rehash)
+
+	// other params
+	weak := NewArgon2idHasher()
+	weak.Time = 1
+
+	encoded, errHash = weak.Hash(password)
+	require.NoError(t, errHash)
+	assert.True(t, strings.HasPrefix(encoded, "$argon2id$v=19$m=19456,t=1,p=1$"))
+
+	match, rehash, errVerify = argon.Verify(password, encoded)
+	require.NoError(t, errVerify)
+	assert.True(t, match)
+	assert.True(t, rehash)
+
+	_, _, errVerify = argon.Verify(password, "plain text")
+	assert.ErrorIs(t, errVerify, ErrUnknownHashFormat)
+}
@@ -0,0 +1,155 @@
+package source
+
+import (
+	"bufio"
+	"embed"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// breachedHashes - SHA-256 (HashData) of common and breached passwords,
+// file <first hex char>.txt keeps the rest of hashes with this prefix, so one lookup reads one file
+//
+//go:embed breached/*.txt
+var breachedHashes embed.FS
+
+// codes of PasswordViolation
+const (
+	ViolationTooShort = "too_short"
+	ViolationTooLong  = "too_long"
+	ViolationClasses  = "few_classes"
+	ViolationPersonal = "contains_personal"
+	ViolationBreached = "breached"
+	ViolationMismatch = "mismatch"
+)
+
+// PasswordViolation - one broken rule of PasswordPolicy
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy - rules of new password, zero value has no rules,
+// MinClasses - number of classes (lower, upper, digit, other) in password
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	MinClasses     int
+	RejectPersonal bool
+	RejectBreached bool
+}
+
+// DefaultPasswordPolicy - rules of application without config
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength:      8,
+	MaxLength:      128,
+	MinClasses:     2,
+	RejectPersonal: true,
+	RejectBreached: true,
+}
+
+// Check - broken rules of c, personal - login, name, email of user.
+// With Hashed only SHA-256 of password is known, so only the list of breached passwords is checked
+func (p PasswordPolicy) Check(c ChangePassword, personal ...string) []PasswordViolation {
+	var violations []PasswordViolation
+
+	if c.PasswordOne != c.PasswordTwo {
+		violations = append(violations, PasswordViolation{Code: ViolationMismatch, Message: "passwords are not equal"})
+	}
+
+	hash := c.PasswordOne
+
+	if c.Hashed == NoHashed {
+		violations = append(violations, p.checkPlain(c.PasswordOne, personal)...)
+		hash = HashData(c.PasswordOne)
+	}
+
+	if p.RejectBreached && Breached(hash) {
+		violations = append(violations, PasswordViolation{Code: ViolationBreached, Message: "password is in the list of common or breached passwords"})
+	}
+
+	return violations
+}
+
+func (p PasswordPolicy) checkPlain(password string, personal []string) []PasswordViolation {
+	var violations []PasswordViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PasswordViolation{Code: ViolationTooShort, Message: "password is shorter than minimum length"})
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		violations = append(violations, PasswordViolation{Code: ViolationTooLong, Message: "password is longer than maximum length"})
+	}
+
+	if passwordClasses(password) < p.MinClasses {
+		violations = append(violations, PasswordViolation{Code: ViolationClasses, Message: "password has too few classes of characters"})
+	}
+
+	if p.RejectPersonal && containsPersonal(password, personal) {
+		violations = append(violations, PasswordViolation{Code: ViolationPersonal, Message: "password contains login, name or email"})
+	}
+
+	return violations
+}
+
+func passwordClasses(password string) int {
+	var lower, upper, digit, other int
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+
+	return lower + upper + digit + other
+}
+
+// containsPersonal - password contains any of personal data (at least 3 letters), email is checked by local part
+func containsPersonal(password string, personal []string) bool {
+	password = strings.ToLower(password)
+
+	for _, data := range personal {
+		data = strings.ToLower(strings.TrimSpace(data))
+		if at := strings.IndexByte(data, '@'); at >= 0 {
+			data = data[:at]
+		}
+
+		if utf8.RuneCountInString(data) >= 3 && strings.Contains(password, data) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Breached - hash (HashData of password) is in the bundled list of common and breached passwords
+func Breached(hash string) bool {
+	hash = strings.ToLower(hash)
+	if len(hash) != 64 {
+		return false
+	}
+
+	file, errOpen := breachedHashes.Open("breached/" + hash[:1] + ".txt")
+	if errOpen != nil {
+		return false
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if scanner.Text() == hash[1:] {
+			return true
+		}
+	}
+
+	return false
+}
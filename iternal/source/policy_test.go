@@ -0,0 +1,60 @@
+package source
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func codes(violations []PasswordViolation) []string {
+	var arr []string
+	for _, v := range violations {
+		arr = append(arr, v.Code)
+	}
+
+	return arr
+}
+
+func plain(password string) ChangePassword {
+	return ChangePassword{Hashed: NoHashed, PasswordOne: password, PasswordTwo: password}
+}
+
+func TestBreached(t *testing.T) {
+	for _, password := range []string{"123456", "password", "qwerty123", "P@ssw0rd"} {
+		assert.True(t, Breached(HashData(password)), password)
+	}
+
+	for _, hash := range []string{HashData("correct horse battery staple"), HashData("qwert1234"), "", "zz"} {
+		assert.False(t, Breached(hash), hash)
+	}
+
+	assert.True(t, Breached(strings.ToUpper(HashData("123456"))))
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	p := DefaultPasswordPolicy
+
+	for password, expected := range map[string][]string{
+		"Tr0ub4dor&3":            nil,
+		"short1":                 {ViolationTooShort},
+		"onlyletters":            {ViolationClasses},
+		"password":               {ViolationClasses, ViolationBreached},
+		"loko-is-the-best-1":     {ViolationPersonal},
+		"Genus1991!2":            {ViolationPersonal},
+		strings.Repeat("a1", 65): {ViolationTooLong},
+	} {
+		assert.Equal(t, expected, codes(p.Check(plain(password), "Loko", "Pavel", "genus1991@gmail.com")), password)
+	}
+
+	// only SHA-256 is known with Hashed
+	hashed := ChangePassword{Hashed: Hashed, PasswordOne: HashData("123456"), PasswordTwo: HashData("123456")}
+	assert.Equal(t, []string{ViolationBreached}, codes(p.Check(hashed, "Loko")))
+
+	hashed = ChangePassword{Hashed: Hashed, PasswordOne: HashData("x"), PasswordTwo: HashData("x")}
+	assert.Empty(t, p.Check(hashed, "Loko"))
+
+	mismatch := ChangePassword{Hashed: NoHashed, PasswordOne: "Tr0ub4dor&3", PasswordTwo: "Tr0ub4dor&4"}
+	assert.Equal(t, []string{ViolationMismatch}, codes(p.Check(mismatch)))
+
+	assert.Empty(t, PasswordPolicy{}.Check(plain("1")))
+}
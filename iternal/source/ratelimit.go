@@ -0,0 +1,222 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// routes of rate limits in config
+const (
+	RateRouteSignUp = "signup"
+	RateRouteMain   = "main"
+	RateRouteOwnID  = "ownid"
+	// RateRouteAccount - API keys and 2FA of user
+	RateRouteAccount = "account"
+)
+
+// RateLimit - token bucket: Requests per Per on average, up to Burst at once (Requests by default),
+// zero Requests - no limit
+type RateLimit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// RouteLimits - limits of route for every IP and for every user
+type RouteLimits struct {
+	IP   RateLimit
+	User RateLimit
+}
+
+// DefaultRateLimits - limits of routes absent in config
+var DefaultRateLimits = map[string]RouteLimits{
+	RateRouteSignUp: {
+		IP: RateLimit{Requests: 10, Per: time.Minute, Burst: 5},
+	},
+	RateRouteMain: {
+		IP:   RateLimit{Requests: 300, Per: time.Minute, Burst: 100},
+		User: RateLimit{Requests: 120, Per: time.Minute, Burst: 30},
+	},
+	RateRouteOwnID: {
+		IP:   RateLimit{Requests: 300, Per: time.Minute, Burst: 100},
+		User: RateLimit{Requests: 60, Per: time.Minute, Burst: 20},
+	},
+	RateRouteAccount: {
+		IP:   RateLimit{Requests: 60, Per: time.Minute, Burst: 20},
+		User: RateLimit{Requests: 30, Per: time.Minute, Burst: 10},
+	},
+}
+
+// Off - limit has no requests or no period
+func (l RateLimit) Off() bool {
+	return l.Requests <= 0 || l.Per <= 0
+}
+
+func (l RateLimit) burst() int {
+	if l.Burst <= 0 {
+		return l.Requests
+	}
+
+	return l.Burst
+}
+
+// interval - time of one token, not less than 1ns, more requests than nanoseconds of Per are not told apart
+func (l RateLimit) interval() time.Duration {
+	return max(l.Per/time.Duration(l.Requests), time.Nanosecond)
+}
+
+// Allowance - decision for one request and values of X-RateLimit-* headers,
+// Reset - time until the bucket is full
+type Allowance struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+	Reset      time.Duration
+}
+
+// take - bucket is kept as theoretical arrival time (tat) of the next request (GCRA),
+// returns new tat and decision
+func (l RateLimit) take(tat, now time.Time) (time.Time, Allowance) {
+	base := tat
+	if base.Before(now) {
+		base = now
+	}
+
+	if base.After(now.Add(time.Duration(l.burst()-1) * l.interval())) {
+		return tat, l.allowance(tat, now, false)
+	}
+
+	tat = base.Add(l.interval())
+
+	return tat, l.allowance(tat, now, true)
+}
+
+func (l RateLimit) allowance(tat, now time.Time, allowed bool) Allowance {
+	a := Allowance{
+		Allowed: allowed,
+		Limit:   l.burst(),
+		Reset:   tat.Sub(now),
+	}
+
+	if allowed {
+		a.Remaining = int(now.Add(time.Duration(l.burst())*l.interval()).Sub(tat) / l.interval())
+
+		return a
+	}
+
+	a.RetryAfter = tat.Sub(now) - time.Duration(l.burst()-1)*l.interval()
+	if a.RetryAfter <= 0 {
+		// concurrent request took the token between update and read
+		a.RetryAfter = time.Second
+	}
+
+	return a
+}
+
+// RateLimitStore - buckets of keys ("<route>:ip:<ip>", "<route>:user:<id>"), safe for concurrent use
+type RateLimitStore interface {
+	// Take - takes one token of key if there is one
+	Take(ctx context.Context, key string, limit RateLimit, now time.Time) (Allowance, error)
+	// DeleteFull - removes buckets which are full at now, returns their number
+	DeleteFull(ctx context.Context, now time.Time) (int, error)
+}
+
+var (
+	_ RateLimitStore = (*MemoryRateLimits)(nil)
+	_ RateLimitStore = (*SqlRateLimits)(nil)
+)
+
+type MemoryRateLimits struct {
+	mu  sync.Mutex
+	tat map[string]time.Time
+}
+
+func NewMemoryRateLimits() *MemoryRateLimits {
+	return &MemoryRateLimits{tat: make(map[string]time.Time)}
+}
+
+func (m *MemoryRateLimits) Take(_ context.Context, key string, limit RateLimit, now time.Time) (Allowance, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tat, a := limit.take(m.tat[key], now)
+	m.tat[key] = tat
+
+	return a, nil
+}
+
+func (m *MemoryRateLimits) DeleteFull(_ context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for key, tat := range m.tat {
+		if !tat.After(now) {
+			delete(m.tat, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// SqlRateLimits - buckets in table rate_limits of DB, shared by all instances,
+// tat is written in unix nanoseconds
+type SqlRateLimits struct {
+	source *sql.DB
+}
+
+func NewSqlRateLimits(source *sql.DB) *SqlRateLimits {
+	return &SqlRateLimits{source: source}
+}
+
+func (s *SqlRateLimits) Take(ctx context.Context, key string, limit RateLimit, now time.Time) (Allowance, error) {
+	interval := int64(limit.interval())
+	deadline := now.UnixNano() + int64(limit.burst()-1)*interval
+
+	var tat int64
+
+	// token is taken by one conditional statement, no row - no token
+	errTake := s.source.QueryRowContext(ctx, `
+INSERT INTO rate_limits (id,
+                         tat)
+VALUES ($1,$2)
+ON CONFLICT (id) DO UPDATE
+    SET tat = CASE
+                  WHEN rate_limits.tat < CAST($3 AS bigint) THEN CAST($3 AS bigint)
+                  ELSE rate_limits.tat
+        END + CAST($4 AS bigint)
+WHERE rate_limits.tat <= CAST($5 AS bigint)
+RETURNING tat;`, key, now.UnixNano()+interval, now.UnixNano(), interval, deadline).Scan(&tat)
+	if errTake == nil {
+		return limit.allowance(time.Unix(0, tat), now, true), nil
+	}
+	if !errors.Is(errTake, sql.ErrNoRows) {
+		return Allowance{}, sqlError(errTake)
+	}
+
+	errGet := s.source.QueryRowContext(ctx, `SELECT tat FROM rate_limits WHERE id = $1;`, key).Scan(&tat)
+	if errGet != nil {
+		return Allowance{}, sqlError(errGet)
+	}
+
+	return limit.allowance(time.Unix(0, tat), now, false), nil
+}
+
+func (s *SqlRateLimits) DeleteFull(ctx context.Context, now time.Time) (int, error) {
+	res, err := s.source.ExecContext(ctx, `DELETE FROM rate_limits WHERE tat <= $1;`, now.UnixNano())
+	if err != nil {
+		return 0, sqlError(err)
+	}
+
+	n, errRows := res.RowsAffected()
+	if errRows != nil {
+		return 0, errRows
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,112 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+// forEachRateLimitStore - runs the same test on every RateLimitStore
+func forEachRateLimitStore(t *testing.T, test func(t *testing.T, rates RateLimitStore)) {
+	forEachBackend(t, func(t *testing.T, db *sql.DB, _ Store) {
+		var rates RateLimitStore = NewMemoryRateLimits()
+		if db != nil {
+			rates = NewSqlRateLimits(db)
+		}
+
+		test(t, rates)
+	})
+}
+
+func TestRateLimitStoreTake(t *testing.T) {
+	forEachRateLimitStore(t, func(t *testing.T, rates RateLimitStore) {
+		ctx := context.Background()
+
+		key := fmt.Sprintf("main:ip:test-%d", time.Now().UnixNano())
+		limit := RateLimit{Requests: 60, Per: time.Minute, Burst: 3}
+
+		now := time.Now().Truncate(time.Second)
+
+		for remaining := 2; remaining >= 0; remaining-- {
+			a, errTake := rates.Take(ctx, key, limit, now)
+			require.NoError(t, errTake)
+			assert.True(t, a.Allowed)
+			assert.Equal(t, 3, a.Limit)
+			assert.Equal(t, remaining, a.Remaining)
+			assert.Equal(t, time.Duration(3-remaining)*time.Second, a.Reset)
+		}
+
+		a, errTake := rates.Take(ctx, key, limit, now)
+		require.NoError(t, errTake)
+		assert.False(t, a.Allowed)
+		assert.Equal(t, 0, a.Remaining)
+		assert.Equal(t, time.Second, a.RetryAfter)
+
+		// one token per second
+		a, errTake = rates.Take(ctx, key, limit, now.Add(time.Second))
+		require.NoError(t, errTake)
+		assert.True(t, a.Allowed)
+		assert.Equal(t, 0, a.Remaining)
+
+		a, errTake = rates.Take(ctx, key, limit, now.Add(time.Minute))
+		require.NoError(t, errTake)
+		assert.True(t, a.Allowed)
+		assert.Equal(t, 2, a.Remaining)
+
+		n, errDelete := rates.DeleteFull(ctx, now.Add(time.Minute))
+		require.NoError(t, errDelete)
+		assert.Equal(t, 0, n)
+
+		n, errDelete = rates.DeleteFull(ctx, now.Add(time.Minute+time.Second))
+		require.NoError(t, errDelete)
+		assert.GreaterOrEqual(t, n, 1)
+
+		a, errTake = rates.Take(ctx, key, limit, now.Add(time.Minute+time.Second))
+		require.NoError(t, errTake)
+		assert.Equal(t, 2, a.Remaining)
+	})
+}
+
+func TestRateLimitBurstDefault(t *testing.T) {
+	limit := RateLimit{Requests: 2, Per: time.Second}
+	assert.False(t, limit.Off())
+	assert.True(t, RateLimit{Per: time.Second}.Off())
+
+	rates := NewMemoryRateLimits()
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		a, errTake := rates.Take(context.Background(), "k", limit, now)
+		require.NoError(t, errTake)
+		assert.True(t, a.Allowed)
+	}
+
+	a, errTake := rates.Take(context.Background(), "k", limit, now)
+	require.NoError(t, errTake)
+	assert.False(t, a.Allowed)
+	assert.Equal(t, 500*time.Millisecond, a.RetryAfter)
+}
+
+func TestRateLimitTinyInterval(t *testing.T) {
+	forEachRateLimitStore(t, func(t *testing.T, rates RateLimitStore) {
+		// 10 requests per 5ns - interval would be 0
+		limit := RateLimit{Requests: 10, Per: 5 * time.Nanosecond}
+		key := fmt.Sprintf("ip:tiny-%d", time.Now().UnixNano())
+		now := time.Now()
+
+		for i := 0; i < 10; i++ {
+			a, errTake := rates.Take(context.Background(), key, limit, now)
+			require.NoError(t, errTake)
+			assert.True(t, a.Allowed, i)
+		}
+
+		a, errTake := rates.Take(context.Background(), key, limit, now)
+		require.NoError(t, errTake)
+		assert.False(t, a.Allowed)
+		assert.Equal(t, 0, a.Remaining)
+	})
+}
@@ -0,0 +1,237 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrTokenReused - refresh token was already exchanged, its family is compromised
+var ErrTokenReused = errors.New("token: refresh token is reused")
+
+// RefreshToken - server side record of refresh token, ID is HashData of token.
+// Every exchange gives a new token of the same Family, the old one is marked UsedAt
+type RefreshToken struct {
+	ID        string
+	Family    string
+	UserID    int
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// NewRefreshToken - random token for client and ID of its RefreshToken
+func NewRefreshToken() (token string, id string, err error) {
+	token, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, HashData(token), nil
+}
+
+// NewRefreshFamily - ID of chain of rotated refresh tokens
+func NewRefreshFamily() (string, error) {
+	return randomToken()
+}
+
+// RefreshStore - storage of refresh tokens, safe for concurrent use
+type RefreshStore interface {
+	Create(ctx context.Context, t RefreshToken) error
+	// Use - marks token used at the moment and returns it, only one caller gets a token,
+	// ErrNotFound if there is no token, ErrTokenReused with the token if it was used before
+	Use(ctx context.Context, id string, at time.Time) (RefreshToken, error)
+	RevokeFamily(ctx context.Context, family string) error
+	RevokeAllForUser(ctx context.Context, userID int) error
+	// DeleteExpired - removes tokens expired before now, returns their number
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+}
+
+var (
+	_ RefreshStore = (*MemoryRefreshTokens)(nil)
+	_ RefreshStore = (*SqlRefreshTokens)(nil)
+)
+
+type MemoryRefreshTokens struct {
+	mu     sync.Mutex
+	tokens map[string]RefreshToken
+}
+
+func NewMemoryRefreshTokens() *MemoryRefreshTokens {
+	return &MemoryRefreshTokens{tokens: make(map[string]RefreshToken)}
+}
+
+func (m *MemoryRefreshTokens) Create(_ context.Context, t RefreshToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ex := m.tokens[t.ID]; ex {
+		return ErrDuplicate
+	}
+
+	m.tokens[t.ID] = t
+
+	return nil
+}
+
+func (m *MemoryRefreshTokens) Use(_ context.Context, id string, at time.Time) (RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	t, ex := m.tokens[id]
+	if !ex {
+		return RefreshToken{}, ErrNotFound
+	}
+	if t.UsedAt != nil {
+		return t, ErrTokenReused
+	}
+
+	t.UsedAt = &at
+	m.tokens[id] = t
+
+	return t, nil
+}
+
+func (m *MemoryRefreshTokens) RevokeFamily(_ context.Context, family string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, t := range m.tokens {
+		if t.Family == family {
+			delete(m.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryRefreshTokens) RevokeAllForUser(_ context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, t := range m.tokens {
+		if t.UserID == userID {
+			delete(m.tokens, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemoryRefreshTokens) DeleteExpired(_ context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, t := range m.tokens {
+		if t.ExpiresAt.Before(now) {
+			delete(m.tokens, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// SqlRefreshTokens - refresh tokens in table of DB
+type SqlRefreshTokens struct {
+	source *sql.DB
+}
+
+func NewSqlRefreshTokens(source *sql.DB) *SqlRefreshTokens {
+	return &SqlRefreshTokens{source: source}
+}
+
+func (s *SqlRefreshTokens) Create(ctx context.Context, t RefreshToken) error {
+	_, err := s.source.ExecContext(ctx, `
+INSERT INTO refresh_tokens (id,
+                            family_id,
+                            user_id,
+                            created_at,
+                            expires_at)
+VALUES ($1,$2,$3,$4,$5);`,
+		t.ID, t.Family, t.UserID, t.CreatedAt.UTC(), t.ExpiresAt.UTC())
+
+	return sqlError(err)
+}
+
+func (s *SqlRefreshTokens) Use(ctx context.Context, id string, at time.Time) (RefreshToken, error) {
+	tx, errTx := s.source.BeginTx(ctx, nil)
+	if errTx != nil {
+		return RefreshToken{}, errTx
+	}
+	defer tx.Rollback()
+
+	var (
+		t      RefreshToken
+		usedAt sql.NullTime
+	)
+
+	errScan := tx.QueryRowContext(ctx, `
+SELECT id,
+       family_id,
+       user_id,
+       created_at,
+       expires_at,
+       used_at
+FROM refresh_tokens
+WHERE id = $1;`, id).Scan(&t.ID, &t.Family, &t.UserID, &t.CreatedAt, &t.ExpiresAt, &usedAt)
+	if errScan != nil {
+		return RefreshToken{}, sqlError(errScan)
+	}
+	if usedAt.Valid {
+		t.UsedAt = &usedAt.Time
+
+		return t, ErrTokenReused
+	}
+
+	// the condition on used_at keeps only one winner of concurrent exchanges
+	res, errUpdate := tx.ExecContext(ctx, `
+UPDATE refresh_tokens
+SET used_at = $1
+WHERE id = $2
+  AND used_at IS NULL;`, at.UTC(), id)
+	if errAffected := affected(res, errUpdate); errAffected != nil {
+		if errors.Is(errAffected, ErrNotFound) {
+			return t, ErrTokenReused
+		}
+
+		return RefreshToken{}, errAffected
+	}
+
+	if errCommit := tx.Commit(); errCommit != nil {
+		return RefreshToken{}, errCommit
+	}
+
+	t.UsedAt = &at
+
+	return t, nil
+}
+
+func (s *SqlRefreshTokens) RevokeFamily(ctx context.Context, family string) error {
+	_, err := s.source.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE family_id = $1;`, family)
+
+	return sqlError(err)
+}
+
+func (s *SqlRefreshTokens) RevokeAllForUser(ctx context.Context, userID int) error {
+	_, err := s.source.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE user_id = $1;`, userID)
+
+	return sqlError(err)
+}
+
+func (s *SqlRefreshTokens) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := s.source.ExecContext(ctx, `DELETE FROM refresh_tokens WHERE expires_at < $1;`, now.UTC())
+	if err != nil {
+		return 0, sqlError(err)
+	}
+
+	n, errRows := res.RowsAffected()
+	if errRows != nil {
+		return 0, errRows
+	}
+
+	return int(n), nil
+}
@@ -0,0 +1,144 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// forEachRefreshStore - runs the same test on every RefreshStore with Store of the same backend
+func forEachRefreshStore(t *testing.T, test func(t *testing.T, store Store, refresh RefreshStore)) {
+	forEachBackend(t, func(t *testing.T, db *sql.DB, store Store) {
+		var refresh RefreshStore = NewMemoryRefreshTokens()
+		if db != nil {
+			refresh = NewSqlRefreshTokens(db)
+		}
+
+		test(t, store, refresh)
+	})
+}
+
+func newRefreshToken(t *testing.T, userID int, family string, now time.Time) RefreshToken {
+	_, id, errToken := NewRefreshToken()
+	require.NoError(t, errToken)
+
+	return RefreshToken{
+		ID:        id,
+		Family:    family,
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(time.Hour),
+	}
+}
+
+func TestRefreshStoreUse(t *testing.T) {
+	forEachRefreshStore(t, func(t *testing.T, store Store, refresh RefreshStore) {
+		ctx := context.Background()
+
+		id, errCreate := store.UserCreate(ctx, NewUser())
+		require.NoError(t, errCreate)
+		defer store.UserDataDelete(ctx, strconv.Itoa(id))
+
+		now := time.Now().Truncate(time.Second)
+
+		family, errFamily := NewRefreshFamily()
+		require.NoError(t, errFamily)
+
+		first := newRefreshToken(t, id, family, now)
+		require.NoError(t, refresh.Create(ctx, first))
+		assert.ErrorIs(t, refresh.Create(ctx, first), ErrDuplicate)
+
+		used, errUse := refresh.Use(ctx, first.ID, now)
+		require.NoError(t, errUse)
+		assert.Equal(t, family, used.Family)
+		assert.Equal(t, id, used.UserID)
+		require.NotNil(t, used.UsedAt)
+
+		second := newRefreshToken(t, id, family, now)
+		require.NoError(t, refresh.Create(ctx, second))
+
+		reused, errUse := refresh.Use(ctx, first.ID, now.Add(time.Second))
+		assert.ErrorIs(t, errUse, ErrTokenReused)
+		assert.Equal(t, family, reused.Family)
+
+		require.NoError(t, refresh.RevokeFamily(ctx, reused.Family))
+
+		_, errUse = refresh.Use(ctx, second.ID, now)
+		assert.ErrorIs(t, errUse, ErrNotFound)
+
+		_, errUse = refresh.Use(ctx, "unknown", now)
+		assert.ErrorIs(t, errUse, ErrNotFound)
+	})
+}
+
+func TestRefreshStoreConcurrentUse(t *testing.T) {
+	forEachRefreshStore(t, func(t *testing.T, store Store, refresh RefreshStore) {
+		ctx := context.Background()
+
+		id, errCreate := store.UserCreate(ctx, NewUser())
+		require.NoError(t, errCreate)
+		defer store.UserDataDelete(ctx, strconv.Itoa(id))
+
+		token := newRefreshToken(t, id, "family", time.Now())
+		require.NoError(t, refresh.Create(ctx, token))
+
+		const workers = 8
+
+		var (
+			wg   sync.WaitGroup
+			mu   sync.Mutex
+			wins int
+		)
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				if _, err := refresh.Use(ctx, token.ID, time.Now()); err == nil {
+					mu.Lock()
+					wins++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+
+		assert.Equal(t, 1, wins)
+	})
+}
+
+func TestRefreshStoreDeleteExpired(t *testing.T) {
+	forEachRefreshStore(t, func(t *testing.T, store Store, refresh RefreshStore) {
+		ctx := context.Background()
+
+		id, errCreate := store.UserCreate(ctx, NewUser())
+		require.NoError(t, errCreate)
+		defer store.UserDataDelete(ctx, strconv.Itoa(id))
+
+		now := time.Now().Truncate(time.Second)
+
+		expired := newRefreshToken(t, id, "family", now.Add(-2*time.Hour))
+		require.NoError(t, refresh.Create(ctx, expired))
+
+		live := newRefreshToken(t, id, "family", now)
+		require.NoError(t, refresh.Create(ctx, live))
+
+		n, errDelete := refresh.DeleteExpired(ctx, now)
+		require.NoError(t, errDelete)
+		assert.Equal(t, 1, n)
+
+		_, errUse := refresh.Use(ctx, live.ID, now)
+		assert.NoError(t, errUse)
+
+		require.NoError(t, refresh.RevokeAllForUser(ctx, id))
+
+		_, errUse = refresh.Use(ctx, live.ID, now)
+		assert.ErrorIs(t, errUse, ErrNotFound)
+	})
+}
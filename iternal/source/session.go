@@ -0,0 +1,309 @@
+package source
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"sort"
+	"sync"
+	"time"
+)
+
+// SessionTokenSize - 256 bit
+const SessionTokenSize = 32
+
+// Session - server side record of login, ID is HashData of token from cookie,
+// so the token itself is never stored
+type Session struct {
+	ID        string    `json:"-"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+	UserAgent string    `json:"user_agent,omitempty"`
+	IP        string    `json:"ip,omitempty"`
+}
+
+// NewSessionToken - random token for cookie and ID of its Session
+func NewSessionToken() (token string, id string, err error) {
+	token, err = randomToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, SessionID(token), nil
+}
+
+// randomToken - SessionTokenSize random bytes in base64url
+func randomToken() (string, error) {
+	buf := make([]byte, SessionTokenSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// SessionID - ID of Session by token from cookie
+func SessionID(token string) string {
+	return HashData(token)
+}
+
+// SessionStore - storage of sessions, safe for concurrent use
+type SessionStore interface {
+	Create(ctx context.Context, s Session) error
+	// Get - ErrNotFound if there is no session, expired sessions are returned as is
+	Get(ctx context.Context, id string) (Session, error)
+	// Touch - sets new expiration time
+	Touch(ctx context.Context, id string, expiresAt time.Time) error
+	Revoke(ctx context.Context, id string) error
+	RevokeAllForUser(ctx context.Context, userID int) error
+	// List - sessions of user, oldest first
+	List(ctx context.Context, userID int) ([]Session, error)
+	// DeleteExpired - removes sessions expired before now, returns their number
+	DeleteExpired(ctx context.Context, now time.Time) (int, error)
+	// Count - number of all stored sessions
+	Count(ctx context.Context) (int, error)
+}
+
+var (
+	_ SessionStore = (*MemorySessions)(nil)
+	_ SessionStore = (*SqlSessions)(nil)
+)
+
+type MemorySessions struct {
+	mu       sync.RWMutex
+	sessions map[string]Session
+}
+
+func NewMemorySessions() *MemorySessions {
+	return &MemorySessions{sessions: make(map[string]Session)}
+}
+
+func (m *MemorySessions) Create(_ context.Context, s Session) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ex := m.sessions[s.ID]; ex {
+		return ErrDuplicate
+	}
+
+	m.sessions[s.ID] = s
+
+	return nil
+}
+
+func (m *MemorySessions) Get(_ context.Context, id string) (Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s, ex := m.sessions[id]
+	if !ex {
+		return Session{}, ErrNotFound
+	}
+
+	return s, nil
+}
+
+func (m *MemorySessions) Touch(_ context.Context, id string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s, ex := m.sessions[id]
+	if !ex {
+		return ErrNotFound
+	}
+
+	s.ExpiresAt = expiresAt
+	m.sessions[id] = s
+
+	return nil
+}
+
+func (m *MemorySessions) Revoke(_ context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+
+	return nil
+}
+
+func (m *MemorySessions) RevokeAllForUser(_ context.Context, userID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for id, s := range m.sessions {
+		if s.UserID == userID {
+			delete(m.sessions, id)
+		}
+	}
+
+	return nil
+}
+
+func (m *MemorySessions) List(_ context.Context, userID int) ([]Session, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []Session{}
+	for _, s := range m.sessions {
+		if s.UserID == userID {
+			list = append(list, s)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+
+	return list, nil
+}
+
+func (m *MemorySessions) DeleteExpired(_ context.Context, now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := 0
+	for id, s := range m.sessions {
+		if s.ExpiresAt.Before(now) {
+			delete(m.sessions, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+func (m *MemorySessions) Count(_ context.Context) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return len(m.sessions), nil
+}
+
+// SqlSessions - sessions in table of DB, shared by all instances of application
+type SqlSessions struct {
+	source *sql.DB
+}
+
+func NewSqlSessions(source *sql.DB) *SqlSessions {
+	return &SqlSessions{source: source}
+}
+
+func (s *SqlSessions) Create(ctx context.Context, session Session) error {
+	_, err := s.source.ExecContext(ctx, `
+INSERT INTO sessions (id,
+                      user_id,
+                      created_at,
+                      expires_at,
+                      user_agent,
+                      ip)
+VALUES ($1,$2,$3,$4,$5,$6);`,
+		session.ID, session.UserID, session.CreatedAt.UTC(), session.ExpiresAt.UTC(), session.UserAgent, session.IP)
+
+	return sqlError(err)
+}
+
+func (s *SqlSessions) Get(ctx context.Context, id string) (Session, error) {
+	row := s.source.QueryRowContext(ctx, `
+SELECT id,
+       user_id,
+       created_at,
+       expires_at,
+       user_agent,
+       ip
+FROM sessions
+WHERE id = $1;`, id)
+
+	session, err := scanSession(row)
+	if err != nil {
+		return Session{}, sqlError(err)
+	}
+
+	return session, nil
+}
+
+func (s *SqlSessions) Touch(ctx context.Context, id string, expiresAt time.Time) error {
+	res, err := s.source.ExecContext(ctx, `
+UPDATE sessions
+SET expires_at = $1
+WHERE id = $2;`, expiresAt.UTC(), id)
+
+	return affected(res, err)
+}
+
+func (s *SqlSessions) Revoke(ctx context.Context, id string) error {
+	_, err := s.source.ExecContext(ctx, `DELETE FROM sessions WHERE id = $1;`, id)
+
+	return sqlError(err)
+}
+
+func (s *SqlSessions) RevokeAllForUser(ctx context.Context, userID int) error {
+	_, err := s.source.ExecContext(ctx, `DELETE FROM sessions WHERE user_id = $1;`, userID)
+
+	return sqlError(err)
+}
+
+func (s *SqlSessions) List(ctx context.Context, userID int) ([]Session, error) {
+	rows, err := s.source.QueryContext(ctx, `
+SELECT id,
+       user_id,
+       created_at,
+       expires_at,
+       user_agent,
+       ip
+FROM sessions
+WHERE user_id = $1
+ORDER BY created_at;`, userID)
+	if err != nil {
+		return nil, sqlError(err)
+	}
+	defer rows.Close()
+
+	list := []Session{}
+	for rows.Next() {
+		session, errScan := scanSession(rows)
+		if errScan != nil {
+			return nil, errScan
+		}
+
+		list = append(list, session)
+	}
+
+	return list, rows.Err()
+}
+
+func (s *SqlSessions) DeleteExpired(ctx context.Context, now time.Time) (int, error) {
+	res, err := s.source.ExecContext(ctx, `DELETE FROM sessions WHERE expires_at < $1;`, now.UTC())
+	if err != nil {
+		return 0, sqlError(err)
+	}
+
+	n, errRows := res.RowsAffected()
+	if errRows != nil {
+		return 0, errRows
+	}
+
+	return int(n), nil
+}
+
+func (s *SqlSessions) Count(ctx context.Context) (int, error) {
+	n := 0
+
+	err := s.source.QueryRowContext(ctx, `SELECT count(*) FROM sessions;`).Scan(&n)
+	if err != nil {
+		return 0, sqlError(err)
+	}
+
+	return n, nil
+}
+
+func scanSession(row interface{ Scan(dest ...any) error }) (Session, error) {
+	var session Session
+
+	err := row.Scan(&session.ID, &session.UserID, &session.CreatedAt, &session.ExpiresAt, &session.UserAgent, &session.IP)
+	if err != nil {
+		return Session{}, err
+	}
+
+	return session, nil
+}
@@ -0,0 +1,124 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// forEachSessionStore - runs the same test on every SessionStore with Store of the same backend
+func forEachSessionStore(t *testing.T, test func(t *testing.T, store Store, sessions SessionStore)) {
+	forEachBackend(t, func(t *testing.T, db *sql.DB, store Store) {
+		var sessions SessionStore = NewMemorySessions()
+		if db != nil {
+			sessions = NewSqlSessions(db)
+		}
+
+		test(t, store, sessions)
+	})
+}
+
+func TestSessionStore(t *testing.T) {
+	forEachSessionStore(t, func(t *testing.T, store Store, sessions SessionStore) {
+		ctx := context.Background()
+
+		id, errCreate := store.UserCreate(ctx, NewUser())
+		require.NoError(t, errCreate)
+		defer store.UserDataDelete(ctx, strconv.Itoa(id))
+
+		now := time.Now().Truncate(time.Second)
+
+		_, sessionID, errToken := NewSessionToken()
+		require.NoError(t, errToken)
+
+		first := Session{
+			ID:        sessionID,
+			UserID:    id,
+			CreatedAt: now,
+			ExpiresAt: now.Add(time.Hour),
+			UserAgent: "test",
+			IP:        "127.0.0.1",
+		}
+		require.NoError(t, sessions.Create(ctx, first))
+		assert.ErrorIs(t, sessions.Create(ctx, first), ErrDuplicate)
+
+		_, sessionID, errToken = NewSessionToken()
+		require.NoError(t, errToken)
+
+		second := first
+		second.ID = sessionID
+		second.CreatedAt = now.Add(time.Second)
+		require.NoError(t, sessions.Create(ctx, second))
+
+		got, errGet := sessions.Get(ctx, first.ID)
+		require.NoError(t, errGet)
+		assert.Equal(t, first.UserID, got.UserID)
+		assert.Equal(t, first.UserAgent, got.UserAgent)
+		assert.Equal(t, first.IP, got.IP)
+		assert.True(t, first.ExpiresAt.Equal(got.ExpiresAt))
+
+		later := now.Add(2 * time.Hour)
+		require.NoError(t, sessions.Touch(ctx, first.ID, later))
+
+		got, errGet = sessions.Get(ctx, first.ID)
+		require.NoError(t, errGet)
+		assert.True(t, later.Equal(got.ExpiresAt))
+
+		list, errList := sessions.List(ctx, id)
+		require.NoError(t, errList)
+		require.Len(t, list, 2)
+		assert.Equal(t, first.ID, list[0].ID)
+		assert.Equal(t, second.ID, list[1].ID)
+
+		require.NoError(t, sessions.Revoke(ctx, first.ID))
+
+		_, errGet = sessions.Get(ctx, first.ID)
+		assert.ErrorIs(t, errGet, ErrNotFound)
+		assert.ErrorIs(t, sessions.Touch(ctx, first.ID, later), ErrNotFound)
+
+		require.NoError(t, sessions.RevokeAllForUser(ctx, id))
+
+		list, errList = sessions.List(ctx, id)
+		require.NoError(t, errList)
+		assert.Empty(t, list)
+	})
+}
+
+func TestSessionStoreDeleteExpired(t *testing.T) {
+	forEachSessionStore(t, func(t *testing.T, store Store, sessions SessionStore) {
+		ctx := context.Background()
+
+		id, errCreate := store.UserCreate(ctx, NewUser())
+		require.NoError(t, errCreate)
+		defer store.UserDataDelete(ctx, strconv.Itoa(id))
+
+		now := time.Now().Truncate(time.Second)
+
+		for i, expiresAt := range []time.Time{now.Add(-time.Hour), now.Add(-time.Minute), now.Add(time.Hour)} {
+			s := Session{
+				ID:        SessionID(strconv.Itoa(i)),
+				UserID:    id,
+				CreatedAt: now.Add(-2 * time.Hour),
+				ExpiresAt: expiresAt,
+			}
+			require.NoError(t, sessions.Create(ctx, s))
+		}
+
+		evicted, errDelete := sessions.DeleteExpired(ctx, now)
+		require.NoError(t, errDelete)
+		assert.Equal(t, 2, evicted)
+
+		live, errCount := sessions.Count(ctx)
+		require.NoError(t, errCount)
+		assert.Equal(t, 1, live)
+
+		_, errGet := sessions.Get(ctx, SessionID("2"))
+		assert.NoError(t, errGet)
+
+		require.NoError(t, sessions.RevokeAllForUser(ctx, id))
+	})
+}
@@ -3,10 +3,18 @@ package source
 import (
 	"context"
 	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+	"strings"
 )
 
+// SchemaVersion - version of migrations (iternal/migrate) the queries of package are written for
+const SchemaVersion = 7
+
 type SqlSource struct {
 	source *sql.DB
 }
@@ -33,26 +41,27 @@ RETURNING  id;`,
 	id := 0
 	err := row.Scan(&id)
 	if err != nil {
-		return 0, err
+		return 0, sqlError(err)
 	}
 	// return ID
 	return id, nil
 }
 
+// UserLogin - user with HashPassword by login, the password is checked by PasswordHasher
 func (s *SqlSource) UserLogin(ctx context.Context, u *UserSourceData) (User, error) {
 	row := s.source.QueryRowContext(ctx, `
 SELECT id,
        login,
+       hashed_password,
        name,
        surname
 FROM users
-WHERE login = $1
-		AND hashed_password = $2;`, u.Login, u.PasswordOne)
+WHERE login = $1;`, u.Login)
 
 	var user User
-	err := row.Scan(&user.ID, &user.Login, &user.Name, &user.Surname)
+	err := row.Scan(&user.ID, &user.Login, &user.HashPassword, &user.Name, &user.Surname)
 	if err != nil {
-		return User{}, err
+		return User{}, sqlError(err)
 	}
 
 	return user, nil
@@ -71,69 +80,81 @@ WHERE id = $1;`, id)
 	var u User
 	err := row.Scan(&u.ID, &u.Login, &u.Name, &u.Surname, &u.Email)
 	if err != nil {
-		return User{}, err
+		return User{}, sqlError(err)
 	}
 
 	return u, nil
 }
 
 func (s *SqlSource) UserDataLoginUpdate(ctx context.Context, u *UserSourceData) error {
-	_, err := s.source.ExecContext(ctx, `
+	res, err := s.source.ExecContext(ctx, `
 UPDATE users
 SET login=$1
 WHERE id = $2;`, u.Login, u.ID)
 
-	return err
+	return affected(res, err)
 }
 
 func (s *SqlSource) UserDataPasswordUpdate(ctx context.Context, u *UserSourceData) error {
-	_, err := s.source.ExecContext(ctx, `
+	res, err := s.source.ExecContext(ctx, `
 UPDATE users
 SET hashed_password=$2
 WHERE id = $1;`, u.ID, u.PasswordOne)
 
-	return err
+	return affected(res, err)
 }
 
 func (s *SqlSource) UserDataNameUpdate(ctx context.Context, u *UserSourceData) error {
-	_, err := s.source.ExecContext(ctx, `
+	res, err := s.source.ExecContext(ctx, `
 UPDATE users
 SET  name=$1,
 	  surname=$2
 WHERE id = $3;`, u.Name, u.Surname, u.ID)
 
-	return err
+	return affected(res, err)
 }
 
 func (s *SqlSource) UserDataEmailUpdate(ctx context.Context, u *UserSourceData) error {
-	_, err := s.source.ExecContext(ctx, `
+	res, err := s.source.ExecContext(ctx, `
 UPDATE users
 SET email=$1
 WHERE id = $2;`, u.Email, u.ID)
 
-	return err
+	return affected(res, err)
+}
+
+func (s *SqlSource) UserDataProfileUpdate(ctx context.Context, u *UserSourceData) error {
+	res, err := s.source.ExecContext(ctx, `
+UPDATE users
+SET login=$1,
+    name=$2,
+    surname=$3,
+    email=$4
+WHERE id = $5;`, u.Login, u.Name, u.Surname, u.Email, u.ID)
+
+	return affected(res, err)
 }
 
 func (s *SqlSource) UserDataDelete(ctx context.Context, id string) error {
-	tx, err := s.source.Begin()
+	tx, err := s.source.BeginTx(ctx, nil)
 	if err != nil {
-		return err
+		return sqlError(err)
 	}
 
 	var errBack error = nil
 
-	_, err = s.source.ExecContext(ctx, `DELETE FROM info WHERE id = $1;`, id)
+	_, err = tx.ExecContext(ctx, `DELETE FROM info WHERE id = $1;`, id)
 	if err != nil {
 		errBack = tx.Rollback()
 		if errBack != nil {
-			return fmt.Errorf("UserDataDelete first error - %w, second error -%w", err, errBack)
+			return fmt.Errorf("UserDataDelete first error - %w, second error -%w", sqlError(err), errBack)
 		}
 
-		return err
+		return sqlError(err)
 	}
 
-	_, err = s.source.ExecContext(ctx, `DELETE FROM users WHERE id = $1;`, id)
-	if err != nil {
+	res, err := tx.ExecContext(ctx, `DELETE FROM users WHERE id = $1;`, id)
+	if err = affected(res, err); err != nil {
 		errBack = tx.Rollback()
 		if errBack != nil {
 			return fmt.Errorf("UserDataDelete first error - %w, second error -%w", err, errBack)
@@ -142,14 +163,14 @@ func (s *SqlSource) UserDataDelete(ctx context.Context, id string) error {
 		return err
 	}
 
-	return tx.Commit()
+	return sqlError(tx.Commit())
 }
 
 func (s *SqlSource) InfoCreate(ctx context.Context, id string) error {
 	_, err := s.source.ExecContext(ctx, `
 INSERT INTO info (id) VALUES ($1)`, id)
 
-	return err
+	return sqlError(err)
 }
 
 func (s *SqlSource) InfoByID(ctx context.Context, id string) (string, error) {
@@ -158,20 +179,105 @@ SELECT secret
 FROM info
 WHERE id = $1;`, id)
 
-	secret := ""
+	var secret sql.NullString
 	err := row.Scan(&secret)
 	if err != nil {
-		return "", err
+		return "", sqlError(err)
+	}
+	if !secret.Valid {
+		return "", ErrNotFound
 	}
 
-	return secret, nil
+	return secret.String, nil
 }
 
 func (s *SqlSource) InfoChangeByID(ctx context.Context, id, secret string) error {
-	_, err := s.source.ExecContext(ctx, `
+	res, err := s.source.ExecContext(ctx, `
 UPDATE info
 SET secret = $1
 WHERE id = $2;`, secret, id)
 
+	return affected(res, err)
+}
+
+// affected - translates the result of UPDATE or DELETE, zero rows means ErrNotFound
+func affected(res sql.Result, err error) error {
+	if err != nil {
+		return sqlError(err)
+	}
+
+	n, errRows := res.RowsAffected()
+	if errRows != nil {
+		return errRows
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// sqlError - wraps driver errors into sentinel errors of the package
+func sqlError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%w: %w", ErrNotFound, err)
+	}
+	if errors.Is(err, driver.ErrBadConn) {
+		return fmt.Errorf("%w: %w", ErrUnavailable, err)
+	}
+
+	var errPQ *pq.Error
+	if errors.As(err, &errPQ) {
+		switch {
+		case errPQ.Code == "23505": // unique_violation
+			return fmt.Errorf("%w: %w", duplicate(string(errPQ.Constraint)), err)
+		case errPQ.Code == "23503", errPQ.Code == "22P02": // foreign_key_violation, invalid_text_representation
+			return fmt.Errorf("%w: %w", ErrNotFound, err)
+		case errPQ.Code == "40001", errPQ.Code == "40P01", errPQ.Code == "55P03": // serialization_failure, deadlock_detected, lock_not_available
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case errPQ.Code == "22001", errPQ.Code == "23502", errPQ.Code == "23514": // string_data_right_truncation, not_null_violation, check_violation
+			return fmt.Errorf("%w: %w", ErrInvalidData, err)
+		case errPQ.Code.Class() == "08", errPQ.Code == "53300", errPQ.Code == "57P01": // connection_exception, too_many_connections, admin_shutdown
+			return fmt.Errorf("%w: %w", ErrUnavailable, err)
+		}
+	}
+
+	var errLite *sqlite.Error
+	if errors.As(err, &errLite) {
+		switch errLite.Code() {
+		case sqlite3.SQLITE_CONSTRAINT_UNIQUE, sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY:
+			// message of sqlite: ... UNIQUE constraint failed: users.login (2067)
+			constraint := ""
+			if _, column, found := strings.Cut(errLite.Error(), "failed: users."); found {
+				column, _, _ = strings.Cut(column, " ")
+				constraint = "users_" + column + "_key"
+			}
+
+			return fmt.Errorf("%w: %w", duplicate(constraint), err)
+		case sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY:
+			return fmt.Errorf("%w: %w", ErrNotFound, err)
+		case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+			return fmt.Errorf("%w: %w", ErrConflict, err)
+		case sqlite3.SQLITE_CONSTRAINT_NOTNULL, sqlite3.SQLITE_CONSTRAINT_CHECK, sqlite3.SQLITE_TOOBIG:
+			return fmt.Errorf("%w: %w", ErrInvalidData, err)
+		}
+	}
+
 	return err
 }
+
+// duplicate - error of unique constraint by its name in postgres (<table>_<column>_key)
+func duplicate(constraint string) error {
+	switch constraint {
+	case "users_login_key":
+		return ErrDuplicateLogin
+	case "users_email_key":
+		return ErrDuplicateEmail
+	}
+
+	return ErrDuplicate
+}
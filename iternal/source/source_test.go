@@ -3,12 +3,16 @@ package source
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"path/filepath"
 	"strconv"
+	"syscall"
 	"testing"
 
 	"github.com/Ekvo/bellerophon/iternal/connect"
+	"github.com/Ekvo/bellerophon/iternal/migrate"
 )
 
 var (
@@ -34,6 +38,59 @@ func startBase() error {
 	return nil
 }
 
+func startLite(t *testing.T) (*sql.DB, *LiteSource) {
+	conn := connect.Connect{
+		Driver: connect.DriverSqlite,
+		DSN:    filepath.Join(t.TempDir(), "bellerophon.db"),
+	}
+
+	dbLite, errDB := sql.Open(conn.Driver, conn.DataSourceName())
+	require.NoError(t, errDB)
+
+	m, errMig := migrate.New(dbLite, conn.Driver)
+	require.NoError(t, errMig)
+
+	_, errUp := m.Up(context.Background())
+	require.NoError(t, errUp)
+
+	return dbLite, NewLiteSource(dbLite)
+}
+
+// forEachBackend - runs the same test on every backend: postgres, sqlite and memory.
+// db is nil for memory, stores of other tables are built from db by test
+func forEachBackend(t *testing.T, test func(t *testing.T, db *sql.DB, store Store)) {
+	t.Run("postgres", func(t *testing.T) {
+		errStart := startBase()
+		require.NoError(t, errStart)
+		defer db.Close()
+
+		// without running Postgres the suite is checked on other backends
+		if errPing := db.Ping(); errors.Is(errPing, syscall.ECONNREFUSED) {
+			t.Skipf("no postgres - %v", errPing)
+		}
+
+		test(t, db, store)
+	})
+
+	t.Run("sqlite", func(t *testing.T) {
+		dbLite, lite := startLite(t)
+		defer dbLite.Close()
+
+		test(t, dbLite, lite)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		test(t, nil, NewMemorySource())
+	})
+}
+
+// forEachStore - runs the same test on every implementation of Store
+func forEachStore(t *testing.T, test func(t *testing.T, store Store)) {
+	forEachBackend(t, func(t *testing.T, _ *sql.DB, store Store) {
+		test(t, store)
+	})
+}
+
 func NewUser() *UserSourceData {
 	hashedPas := HashData("qwert1234")
 
@@ -59,40 +116,38 @@ func NewUser() *UserSourceData {
 }
 
 func TestUserCreateGetDelete(t *testing.T) {
-	errStart := startBase()
-	require.NoError(t, errStart)
-	defer db.Close()
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
 
-	ctx := context.Background()
+		userSign := NewUser()
 
-	userSign := NewUser()
+		id, errCreate := store.UserCreate(ctx, userSign)
+		require.NoError(t, errCreate)
+		require.NotZero(t, id)
 
-	id, errCreate := store.UserCreate(ctx, userSign)
-	require.NoError(t, errCreate)
-	require.NotZero(t, id)
+		strID := strconv.Itoa(id)
 
-	strID := strconv.Itoa(id)
+		u, errData := store.UserData(ctx, strID)
+		require.NoError(t, errData)
+		require.NotEmpty(t, u)
 
-	u, errData := store.UserData(ctx, strID)
-	require.NoError(t, errData)
-	require.NotEmpty(t, u)
+		assert.Empty(t, u.HashPassword)
 
-	assert.Empty(t, u.HashPassword)
+		assert.Equal(t, id, u.ID)
+		assert.Equal(t, userSign.Login, u.Login)
+		assert.Equal(t, userSign.Name, u.Name)
+		assert.Equal(t, userSign.Surname, u.Surname)
+		assert.Equal(t, userSign.Email, u.Email)
 
-	assert.Equal(t, id, u.ID)
-	assert.Equal(t, userSign.Login, u.Login)
-	assert.Equal(t, userSign.Name, u.Name)
-	assert.Equal(t, userSign.Surname, u.Surname)
-	assert.Equal(t, userSign.Email, u.Email)
+		errDelete := store.UserDataDelete(ctx, strID)
 
-	errDelete := store.UserDataDelete(ctx, strID)
+		require.NoError(t, errDelete)
 
-	require.NoError(t, errDelete)
+		u, errData = store.UserData(ctx, strID)
+		assert.ErrorIs(t, errData, ErrNotFound)
 
-	u, errData = store.UserData(ctx, strID)
-	assert.ErrorIs(t, errData, sql.ErrNoRows)
-
-	assert.Empty(t, u)
+		assert.Empty(t, u)
+	})
 }
 
 func newChangeUser(id int) *UserSourceData {
@@ -120,77 +175,142 @@ func newChangeUser(id int) *UserSourceData {
 }
 
 func TestUserNewLoginPasswordNameEmail(t *testing.T) {
-	errStart := startBase()
-	require.NoError(t, errStart)
-	defer db.Close()
-
-	ctx := context.Background()
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
 
-	userSign := NewUser()
+		userSign := NewUser()
 
-	id, errCreate := store.UserCreate(ctx, userSign)
-	require.NoError(t, errCreate)
+		id, errCreate := store.UserCreate(ctx, userSign)
+		require.NoError(t, errCreate)
 
-	userChange := newChangeUser(id)
+		userChange := newChangeUser(id)
 
-	userChange.Direct = NewLogin
-	errNewLog := store.UserDataLoginUpdate(ctx, userChange)
-	assert.NoError(t, errNewLog)
+		userChange.Direct = NewLogin
+		errNewLog := store.UserDataLoginUpdate(ctx, userChange)
+		assert.NoError(t, errNewLog)
 
-	userChange.Direct = NewPassword
-	errNewPas := store.UserDataPasswordUpdate(ctx, userChange)
-	assert.NoError(t, errNewPas)
+		userChange.Direct = NewPassword
+		errNewPas := store.UserDataPasswordUpdate(ctx, userChange)
+		assert.NoError(t, errNewPas)
 
-	userChange.Direct = NewName
-	errNewName := store.UserDataNameUpdate(ctx, userChange)
-	assert.NoError(t, errNewName)
+		userChange.Direct = NewName
+		errNewName := store.UserDataNameUpdate(ctx, userChange)
+		assert.NoError(t, errNewName)
 
-	userChange.Direct = NewEmail
-	errNewEmail := store.UserDataEmailUpdate(ctx, userChange)
-	assert.NoError(t, errNewEmail)
+		userChange.Direct = NewEmail
+		errNewEmail := store.UserDataEmailUpdate(ctx, userChange)
+		assert.NoError(t, errNewEmail)
 
-	strID := strconv.Itoa(id)
+		strID := strconv.Itoa(id)
 
-	u, errData := store.UserData(ctx, strID)
-	require.NoError(t, errData)
+		u, errData := store.UserData(ctx, strID)
+		require.NoError(t, errData)
 
-	assert.Equal(t, u.ID, id)
-	assert.Equal(t, u.Login, userChange.Login)
-	assert.Equal(t, u.Name, userChange.Name)
-	assert.Equal(t, u.Surname, userChange.Surname)
-	assert.Equal(t, u.Email, userChange.Email)
+		assert.Equal(t, u.ID, id)
+		assert.Equal(t, u.Login, userChange.Login)
+		assert.Equal(t, u.Name, userChange.Name)
+		assert.Equal(t, u.Surname, userChange.Surname)
+		assert.Equal(t, u.Email, userChange.Email)
 
-	errDel := store.UserDataDelete(ctx, strID)
-	require.NoError(t, errDel)
+		errDel := store.UserDataDelete(ctx, strID)
+		require.NoError(t, errDel)
+	})
 }
 
 func TestGetInfoNewInfo(t *testing.T) {
-	errStart := startBase()
-	require.NoError(t, errStart)
-	defer db.Close()
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		userSign := NewUser()
+
+		id, errCreate := store.UserCreate(ctx, userSign)
+		require.NoError(t, errCreate)
+
+		strID := strconv.Itoa(id)
+
+		secret, errInfo := store.InfoByID(ctx, strID)
+		require.Error(t, errInfo)
+		assert.Empty(t, secret)
+
+		newSecret := "so big secret"
+
+		errNewInfo := store.InfoChangeByID(ctx, strID, newSecret)
+		require.NoError(t, errNewInfo)
+
+		secret, errInfo = store.InfoByID(ctx, strID)
+		require.NoError(t, errInfo)
+		assert.Equal(t, secret, newSecret)
+
+		errDel := store.UserDataDelete(ctx, strID)
+		require.NoError(t, errDel)
+
+		_, errInfo = store.InfoByID(ctx, strID)
+		assert.ErrorIs(t, errInfo, ErrNotFound)
+	})
+}
+
+func TestUniqueLoginEmail(t *testing.T) {
+	forEachStore(t, func(t *testing.T, store Store) {
+		ctx := context.Background()
+
+		id, errCreate := store.UserCreate(ctx, NewUser())
+		require.NoError(t, errCreate)
+
+		sameLogin := NewUser()
+		sameLogin.Email = "other@gmail.com"
+		_, errCreate = store.UserCreate(ctx, sameLogin)
+		assert.ErrorIs(t, errCreate, ErrDuplicate)
+		assert.ErrorIs(t, errCreate, ErrDuplicateLogin)
+
+		sameEmail := NewUser()
+		sameEmail.Login = "Other"
+		_, errCreate = store.UserCreate(ctx, sameEmail)
+		assert.ErrorIs(t, errCreate, ErrDuplicateEmail)
+
+		sameEmail.Email = "other@gmail.com"
+		idOther, errCreate := store.UserCreate(ctx, sameEmail)
+		require.NoError(t, errCreate)
+		assert.Greater(t, idOther, id)
+
+		change := newChangeUser(idOther)
+		change.Login = NewUser().Login
+		assert.ErrorIs(t, store.UserDataLoginUpdate(ctx, change), ErrDuplicateLogin)
+
+		change.Email = NewUser().Email
+		assert.ErrorIs(t, store.UserDataEmailUpdate(ctx, change), ErrDuplicateEmail)
 
-	ctx := context.Background()
+		// taken email, new login is not written too
+		change.Login = "Another"
+		assert.ErrorIs(t, store.UserDataProfileUpdate(ctx, change), ErrDuplicateEmail)
 
-	userSign := NewUser()
+		other, errData := store.UserData(ctx, strconv.Itoa(idOther))
+		require.NoError(t, errData)
+		assert.Equal(t, "Other", other.Login)
 
-	id, errCreate := store.UserCreate(ctx, userSign)
-	require.NoError(t, errCreate)
+		change.Email = "another@gmail.com"
+		require.NoError(t, store.UserDataProfileUpdate(ctx, change))
 
-	strID := strconv.Itoa(id)
+		other, errData = store.UserData(ctx, strconv.Itoa(idOther))
+		require.NoError(t, errData)
+		assert.Equal(t, "Another", other.Login)
+		assert.Equal(t, "another@gmail.com", other.Email)
 
-	secret, errInfo := store.InfoByID(ctx, strID)
-	require.Error(t, errInfo)
-	assert.Empty(t, secret)
+		change.Login = NewUser().Login
+		change.Email = NewUser().Email
 
-	newSecret := "so big secret"
+		// own values are not duplicates
+		change.ID = id
+		assert.NoError(t, store.UserDataLoginUpdate(ctx, change))
+		assert.NoError(t, store.UserDataEmailUpdate(ctx, change))
 
-	errNewInfo := store.InfoChangeByID(ctx, strID, newSecret)
-	require.NoError(t, errNewInfo)
+		assert.ErrorIs(t, store.InfoCreate(ctx, strconv.Itoa(id)), ErrDuplicate)
 
-	secret, errInfo = store.InfoByID(ctx, strID)
-	require.NoError(t, errInfo)
-	assert.Equal(t, secret, newSecret)
+		require.NoError(t, store.UserDataDelete(ctx, strconv.Itoa(idOther)))
+		require.NoError(t, store.UserDataDelete(ctx, strconv.Itoa(id)))
 
-	errDel := store.UserDataDelete(ctx, strID)
-	require.NoError(t, errDel)
+		change.ID = id
+		assert.ErrorIs(t, store.UserDataNameUpdate(ctx, change), ErrNotFound)
+		assert.ErrorIs(t, store.InfoCreate(ctx, strconv.Itoa(id)), ErrNotFound)
+		assert.ErrorIs(t, store.UserDataDelete(ctx, strconv.Itoa(id)), ErrNotFound)
+	})
 }
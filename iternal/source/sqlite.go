@@ -0,0 +1,54 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// LiteSource - Store on SQLite for single-node deployments,
+// all queries except UserCreate are shared with SqlSource
+type LiteSource struct {
+	*SqlSource
+}
+
+func NewLiteSource(source *sql.DB) *LiteSource {
+	return &LiteSource{SqlSource: NewSqlSource(source)}
+}
+
+// UserCreate - SQLite has no INSERT inside WITH, so users and info are written in one transaction
+func (s *LiteSource) UserCreate(ctx context.Context, u *UserSourceData) (int, error) {
+	tx, err := s.source.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	id := 0
+
+	err = tx.QueryRowContext(ctx, `
+INSERT INTO users (login,
+                   hashed_password,
+                   name,
+                   surname,
+                   email)
+VALUES ($1,$2,$3,$4,$5)
+RETURNING id;`,
+		u.Login, u.PasswordOne, u.Name, u.Surname, u.Email).Scan(&id)
+	if err == nil {
+		_, err = tx.ExecContext(ctx, `INSERT INTO info (id) VALUES ($1);`, id)
+	}
+	if err != nil {
+		errBack := tx.Rollback()
+		if errBack != nil {
+			return 0, fmt.Errorf("UserCreate first error - %w, second error -%w", err, errBack)
+		}
+
+		return 0, sqlError(err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		return 0, err
+	}
+	// return ID
+	return id, nil
+}
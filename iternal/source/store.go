@@ -0,0 +1,48 @@
+package source
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// errors of stores, errors of drivers are wrapped into them by sqlError, text of driver stays only for logs
+var (
+	ErrNotFound  = errors.New("source: not found")
+	ErrDuplicate = errors.New("source: duplicate")
+	// ErrDuplicateLogin, ErrDuplicateEmail - taken login or email of users, both are ErrDuplicate
+	ErrDuplicateLogin = fmt.Errorf("%w login", ErrDuplicate)
+	ErrDuplicateEmail = fmt.Errorf("%w email", ErrDuplicate)
+	// ErrConflict - concurrent transaction (serialization failure, deadlock, lock), request can be repeated
+	ErrConflict = errors.New("source: conflict")
+	// ErrInvalidData - value breaks column (too long, null, check)
+	ErrInvalidData = errors.New("source: invalid data")
+	// ErrUnavailable - DB is not reachable or does not accept connections
+	ErrUnavailable = errors.New("source: unavailable")
+)
+
+// Store - storage of users and their secret information
+type Store interface {
+	UserCreate(ctx context.Context, u *UserSourceData) (int, error)
+	// UserLogin - user by login with HashPassword
+	UserLogin(ctx context.Context, u *UserSourceData) (User, error)
+	UserData(ctx context.Context, id string) (User, error)
+
+	UserDataLoginUpdate(ctx context.Context, u *UserSourceData) error
+	UserDataPasswordUpdate(ctx context.Context, u *UserSourceData) error
+	UserDataNameUpdate(ctx context.Context, u *UserSourceData) error
+	UserDataEmailUpdate(ctx context.Context, u *UserSourceData) error
+	// UserDataProfileUpdate - login, name, surname and email at once, nothing is changed on error
+	UserDataProfileUpdate(ctx context.Context, u *UserSourceData) error
+	UserDataDelete(ctx context.Context, id string) error
+
+	InfoCreate(ctx context.Context, id string) error
+	InfoByID(ctx context.Context, id string) (string, error)
+	InfoChangeByID(ctx context.Context, id, secret string) error
+}
+
+var (
+	_ Store = (*SqlSource)(nil)
+	_ Store = (*LiteSource)(nil)
+	_ Store = (*MemorySource)(nil)
+)
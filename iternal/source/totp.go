@@ -0,0 +1,123 @@
+package source
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// parameters of RFC 6238 understood by every authenticator app
+const (
+	TOTPPeriod = 30 * time.Second
+	TOTPDigits = 6
+	// TOTPSkew - codes of neighbour steps are accepted for clock drift of phone
+	TOTPSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewTOTPSecret - 160 bit secret in base32 for authenticator app
+func NewTOTPSecret() (string, error) {
+	buf := make([]byte, 20)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return totpEncoding.EncodeToString(buf), nil
+}
+
+// TOTPStep - number of period of moment
+func TOTPStep(t time.Time) int64 {
+	return t.Unix() / int64(TOTPPeriod/time.Second)
+}
+
+// TOTPCode - code of secret for step (HMAC-SHA1, dynamic truncation of RFC 4226)
+func TOTPCode(secret string, step int64) (string, error) {
+	key, errKey := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if errKey != nil {
+		return "", errKey
+	}
+
+	msg := make([]byte, 8)
+	binary.BigEndian.PutUint64(msg, uint64(step))
+
+	h := hmac.New(sha1.New, key)
+	h.Write(msg)
+	sum := h.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	mod := uint32(1)
+	for i := 0; i < TOTPDigits; i++ {
+		mod *= 10
+	}
+
+	return fmt.Sprintf("%0*d", TOTPDigits, value%mod), nil
+}
+
+// VerifyTOTP - step of code at moment t with TOTPSkew, ok is false for wrong code,
+// caller must refuse step which was already used
+func VerifyTOTP(secret, code string, t time.Time) (step int64, ok bool) {
+	code = strings.TrimSpace(code)
+	if len(code) != TOTPDigits {
+		return 0, false
+	}
+
+	now := TOTPStep(t)
+
+	for s := now - TOTPSkew; s <= now+TOTPSkew; s++ {
+		expected, errCode := TOTPCode(secret, s)
+		if errCode != nil {
+			return 0, false
+		}
+		if hmac.Equal([]byte(expected), []byte(code)) {
+			return s, true
+		}
+	}
+
+	return 0, false
+}
+
+// TOTPURI - otpauth:// URI for QR code of authenticator app
+func TOTPURI(issuer, account, secret string) string {
+	v := url.Values{}
+	v.Set("secret", secret)
+	v.Set("issuer", issuer)
+	v.Set("algorithm", "SHA1")
+	v.Set("digits", fmt.Sprint(TOTPDigits))
+	v.Set("period", fmt.Sprint(int(TOTPPeriod/time.Second)))
+
+	label := url.PathEscape(issuer + ":" + account)
+
+	return "otpauth://totp/" + label + "?" + v.Encode()
+}
+
+// NewRecoveryCodes - n single-use codes "xxxx-xxxx" for user and their HashData for storage
+func NewRecoveryCodes(n int) (codes []string, hashes []string, err error) {
+	for i := 0; i < n; i++ {
+		buf := make([]byte, 5)
+		if _, err = rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+
+		line := strings.ToLower(totpEncoding.EncodeToString(buf))
+		code := line[:4] + "-" + line[4:]
+
+		codes = append(codes, code)
+		hashes = append(hashes, RecoveryCodeHash(code))
+	}
+
+	return codes, hashes, nil
+}
+
+// RecoveryCodeHash - hash of code as user typed it: case and "-" do not matter
+func RecoveryCodeHash(code string) string {
+	return HashData(strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", "")))
+}
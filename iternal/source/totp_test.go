@@ -0,0 +1,149 @@
+package source
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base32"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	// test vectors of RFC 6238 for SHA1, last 6 digits
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	for unix, code := range map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	} {
+		got, errCode := TOTPCode(secret, TOTPStep(time.Unix(unix, 0)))
+		require.NoError(t, errCode)
+		assert.Equal(t, code, got, unix)
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret, errSecret := NewTOTPSecret()
+	require.NoError(t, errSecret)
+
+	now := time.Unix(1700000000, 0)
+	step := TOTPStep(now)
+
+	for _, s := range []int64{step - 1, step, step + 1} {
+		code, errCode := TOTPCode(secret, s)
+		require.NoError(t, errCode)
+
+		got, ok := VerifyTOTP(secret, code, now)
+		assert.True(t, ok)
+		assert.Equal(t, s, got)
+	}
+
+	old, errCode := TOTPCode(secret, step-2)
+	require.NoError(t, errCode)
+
+	_, ok := VerifyTOTP(secret, old, now)
+	assert.False(t, ok)
+
+	for _, bad := range []string{"", "12345", "1234567", "abcdef"} {
+		_, ok = VerifyTOTP(secret, bad, now)
+		assert.False(t, ok, bad)
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("bellerophon", "Loko", "JBSWY3DPEHPK3PXP")
+
+	parsed, errParse := url.Parse(uri)
+	require.NoError(t, errParse)
+	assert.Equal(t, "otpauth", parsed.Scheme)
+	assert.Equal(t, "totp", parsed.Host)
+	assert.Equal(t, "/bellerophon:Loko", parsed.Path)
+	assert.Equal(t, "JBSWY3DPEHPK3PXP", parsed.Query().Get("secret"))
+	assert.Equal(t, "bellerophon", parsed.Query().Get("issuer"))
+	assert.Equal(t, "30", parsed.Query().Get("period"))
+}
+
+func TestNewRecoveryCodes(t *testing.T) {
+	codes, hashes, errCodes := NewRecoveryCodes(10)
+	require.NoError(t, errCodes)
+	require.Len(t, codes, 10)
+	require.Len(t, hashes, 10)
+
+	unique := map[string]struct{}{}
+	for i, code := range codes {
+		assert.Regexp(t, `^[a-z2-7]{4}-[a-z2-7]{4}$`, code)
+		assert.Equal(t, hashes[i], RecoveryCodeHash(code))
+		unique[code] = struct{}{}
+	}
+	assert.Len(t, unique, 10)
+
+	assert.Equal(t, RecoveryCodeHash("abcd-efgh"), RecoveryCodeHash(" ABCDEFGH "))
+}
+
+// forEachMFAStore - runs the same test on every MFAStore with Store of the same backend
+func forEachMFAStore(t *testing.T, test func(t *testing.T, store Store, mfa MFAStore)) {
+	forEachBackend(t, func(t *testing.T, db *sql.DB, store Store) {
+		var mfa MFAStore = NewMemoryMFA()
+		if db != nil {
+			mfa = NewSqlMFA(db)
+		}
+
+		test(t, store, mfa)
+	})
+}
+
+func TestMFAStore(t *testing.T) {
+	forEachMFAStore(t, func(t *testing.T, store Store, mfa MFAStore) {
+		ctx := context.Background()
+
+		id, errCreate := store.UserCreate(ctx, NewUser())
+		require.NoError(t, errCreate)
+		defer store.UserDataDelete(ctx, strconv.Itoa(id))
+
+		_, errGet := mfa.Get(ctx, id)
+		assert.ErrorIs(t, errGet, ErrNotFound)
+		assert.ErrorIs(t, mfa.Confirm(ctx, id, 1, nil), ErrNotFound)
+
+		require.NoError(t, mfa.Enroll(ctx, id, "FIRST"))
+		require.NoError(t, mfa.Enroll(ctx, id, "SECOND"))
+
+		got, errGet := mfa.Get(ctx, id)
+		require.NoError(t, errGet)
+		assert.Equal(t, "SECOND", got.Secret)
+		assert.False(t, got.Confirmed)
+
+		_, hashes, errCodes := NewRecoveryCodes(2)
+		require.NoError(t, errCodes)
+
+		require.NoError(t, mfa.Confirm(ctx, id, 100, hashes))
+		assert.ErrorIs(t, mfa.Confirm(ctx, id, 100, hashes), ErrNotFound)
+		assert.ErrorIs(t, mfa.Enroll(ctx, id, "THIRD"), ErrDuplicate)
+
+		got, errGet = mfa.Get(ctx, id)
+		require.NoError(t, errGet)
+		assert.True(t, got.Confirmed)
+		assert.Equal(t, int64(100), got.LastStep)
+
+		assert.ErrorIs(t, mfa.UseStep(ctx, id, 100), ErrCodeReused)
+		require.NoError(t, mfa.UseStep(ctx, id, 101))
+		assert.ErrorIs(t, mfa.UseStep(ctx, id, 99), ErrCodeReused)
+
+		require.NoError(t, mfa.UseRecoveryCode(ctx, id, hashes[0]))
+		assert.ErrorIs(t, mfa.UseRecoveryCode(ctx, id, hashes[0]), ErrNotFound)
+		assert.ErrorIs(t, mfa.UseRecoveryCode(ctx, id+1, hashes[1]), ErrNotFound)
+
+		require.NoError(t, mfa.Disable(ctx, id))
+
+		_, errGet = mfa.Get(ctx, id)
+		assert.ErrorIs(t, errGet, ErrNotFound)
+		assert.ErrorIs(t, mfa.UseRecoveryCode(ctx, id, hashes[1]), ErrNotFound)
+	})
+}
@@ -28,7 +28,10 @@ type ChangeLogin struct {
 }
 
 const (
-	Hashed   = 100
+	// Hashed - password is SHA-256 made by client, deprecated: the hash is as good as password
+	// for anyone who sees it, server accepts it only in deprecation period (app.WithPrehashMode)
+	Hashed = 100
+	// NoHashed - plain password over TLS, server keeps only result of slow PasswordHasher
 	NoHashed = 110
 )
 
@@ -54,6 +57,23 @@ func (c *ChangePassword) HashPassword() error {
 	return incorrectHashStatus
 }
 
+// SealPassword - replaces password by PasswordHasher result, which is stored in users.hashed_password
+func (c *ChangePassword) SealPassword(h PasswordHasher) error {
+	if err := c.HashPassword(); err != nil {
+		return err
+	}
+
+	hashed, errHash := h.Hash(c.PasswordOne)
+	if errHash != nil {
+		return errHash
+	}
+
+	c.PasswordOne = hashed
+	c.PasswordTwo = hashed
+
+	return nil
+}
+
 func HashData(line string) string {
 	hash := sha256.Sum256([]byte(line))
 	hashStr := hex.EncodeToString(hash[:])
@@ -73,7 +93,7 @@ type ChangeEmail struct {
 type UserSourceData struct {
 	Direct         int `json:"direct"`
 	ID             int `json:"id,omitempty"`
-	ChangeLogin    `json:"change_login,omitempty "`
+	ChangeLogin    `json:"change_login,omitempty"`
 	ChangePassword `json:"change_password,omitempty"`
 	ChangeName     `json:"change_name,omitempty"`
 	ChangeEmail    `json:"change_email,omitempty"`